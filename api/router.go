@@ -4,54 +4,136 @@ import (
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/middleware"
 	"github.com/divyam234/teldrive/pkg/controller"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/divyam234/teldrive/ui"
 	"github.com/gin-gonic/gin"
 )
 
 func InitRouter(r *gin.Engine, c *controller.Controller, cnf *config.Config) *gin.Engine {
-	authmiddleware := middleware.Authmiddleware(cnf.JWT.Secret)
+	authmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.TokenService, middleware.TokenRules{})
+	// Routes that check the paths they touch also accept tokens restricted to a path.
+	pathmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.TokenService, middleware.TokenRules{Paths: true})
+	uploadmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.TokenService,
+		middleware.TokenRules{Scope: types.ScopeUpload, Paths: true})
+	tusmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.TokenService,
+		middleware.TokenRules{Scope: types.ScopeUpload})
+	adminmiddleware := middleware.Authmiddleware(cnf.JWT.Secret, c.TokenService,
+		middleware.TokenRules{Scope: types.ScopeAdmin})
 	api := r.Group("/api")
 	{
 		auth := api.Group("/auth")
 		{
 			auth.GET("/session", c.GetSession)
 			auth.POST("/login", c.LogIn)
-			auth.POST("/logout", authmiddleware, c.Logout)
+			auth.POST("/logout", authmiddleware, middleware.SessionOnly(), c.Logout)
 			auth.GET("/ws", c.HandleMultipleLogin)
 
 		}
 		files := api.Group("/files")
 		{
-			files.GET("", authmiddleware, c.ListFiles)
-			files.POST("", authmiddleware, c.CreateFile)
-			files.GET(":fileID", authmiddleware, c.GetFileByID)
+			files.GET("", pathmiddleware, c.ListFiles)
+			files.POST("", uploadmiddleware, c.CreateFile)
+			files.GET(":fileID", pathmiddleware, c.GetFileByID)
 			files.PATCH(":fileID", authmiddleware, c.UpdateFile)
 			files.HEAD(":fileID/stream/:fileName", c.GetFileStream)
 			files.GET(":fileID/stream/:fileName", c.GetFileStream)
+			files.HEAD(":fileID/thumbnail", c.GetThumbnail)
+			files.GET(":fileID/thumbnail", c.GetThumbnail)
+			files.GET(":fileID/versions", authmiddleware, c.ListVersions)
+			files.POST(":fileID/versions/:versionID/restore", authmiddleware, c.RestoreVersion)
+			files.DELETE(":fileID/versions/:versionID", authmiddleware, c.DeleteVersion)
+			files.GET(":fileID/grants", authmiddleware, c.ListGrants)
+			files.POST(":fileID/grants", authmiddleware, middleware.SessionOnly(), c.CreateGrant)
+			files.DELETE(":fileID/grants/:userID", authmiddleware, middleware.SessionOnly(), c.DeleteGrant)
+			files.GET("/shared", authmiddleware, c.ListSharedWithMe)
 			files.GET("/category/stats", authmiddleware, c.GetCategoryStats)
-			files.POST("/move", authmiddleware, c.MoveFiles)
-			files.POST("/directories", authmiddleware, c.MakeDirectory)
-			files.POST("/delete", authmiddleware, c.DeleteFiles)
-			files.POST("/copy", authmiddleware, c.CopyFile)
-			files.POST("/directories/move", authmiddleware, c.MoveDirectory)
+			files.GET("/archive/:fileName", authmiddleware, c.GetArchive)
+			files.POST("/archive/:fileName", authmiddleware, c.GetArchive)
+			files.POST("/move", pathmiddleware, c.MoveFiles)
+			files.POST("/directories", pathmiddleware, c.MakeDirectory)
+			files.POST("/delete", pathmiddleware, c.DeleteFiles)
+			files.POST("/copy", pathmiddleware, c.CopyFile)
+			files.POST("/directories/move", pathmiddleware, c.MoveDirectory)
+			files.POST("/channel-moves", authmiddleware, c.MoveToChannel)
+			files.GET("/channel-moves/:moveID", authmiddleware, c.GetChannelMove)
 		}
 		uploads := api.Group("/uploads")
 		{
-			uploads.Use(authmiddleware)
+			uploads.Use(uploadmiddleware)
 			uploads.GET("/stats", c.UploadStats)
 			uploads.GET(":id", c.GetUploadFileById)
 			uploads.POST(":id", c.UploadFile)
 			uploads.DELETE(":id", c.DeleteUploadFile)
 		}
+		tus := api.Group("/tus")
+		{
+			tus.OPTIONS("", c.TusOptions)
+			tus.OPTIONS(":id", c.TusOptions)
+			tus.POST("", tusmiddleware, c.TusCreate)
+			tus.HEAD(":id", tusmiddleware, c.TusHead)
+			tus.PATCH(":id", tusmiddleware, c.TusPatch)
+			tus.DELETE(":id", tusmiddleware, c.TusDelete)
+		}
 		users := api.Group("/users")
 		{
 			users.Use(authmiddleware)
 			users.GET("/profile", c.GetProfilePhoto)
 			users.GET("/stats", c.GetStats)
 			users.GET("/channels", c.ListChannels)
-			users.PATCH("/channels", c.UpdateChannel)
-			users.POST("/bots", c.AddBots)
-			users.DELETE("/bots", c.RemoveBots)
+			users.PATCH("/channels", middleware.SessionOnly(), c.UpdateChannel)
+			users.GET("/channels/stats", c.ListChannelStats)
+			users.POST("/bots", middleware.SessionOnly(), c.AddBots)
+			users.DELETE("/bots", middleware.SessionOnly(), c.RemoveBots)
+			users.GET("/keys", middleware.SessionOnly(), c.ListAccessKeys)
+			users.POST("/keys", middleware.SessionOnly(), c.CreateAccessKey)
+			users.DELETE("/keys/:id", middleware.SessionOnly(), c.DeleteAccessKey)
+			users.GET("/encryption-keys", c.ListEncryptionKeys)
+			users.POST("/encryption-keys", middleware.SessionOnly(), c.CreateEncryptionKey)
+			users.DELETE("/encryption-keys/:id", middleware.SessionOnly(), c.RetireEncryptionKey)
+		}
+		trash := api.Group("/trash")
+		{
+			trash.Use(authmiddleware)
+			trash.GET("", c.ListTrash)
+			trash.DELETE("", c.EmptyTrash)
+			trash.POST("/restore", c.RestoreTrash)
+			trash.POST("/delete", c.DeleteTrash)
+		}
+		admin := api.Group("/admin")
+		{
+			admin.Use(adminmiddleware, middleware.AdminMiddleware(cnf.JWT.AdminUsers))
+			admin.POST("/check", c.CheckFiles)
+			admin.POST("/quarantine/release", c.ReleaseQuarantine)
+			admin.POST("/orphans", c.ReconcileOrphans)
+			admin.GET("/quotas", c.ListQuotas)
+			admin.PUT("/quotas/:userID", c.UpdateQuota)
+		}
+		tokens := api.Group("/tokens")
+		{
+			tokens.Use(authmiddleware, middleware.SessionOnly())
+			tokens.GET("", c.ListTokens)
+			tokens.POST("", c.CreateToken)
+			tokens.DELETE(":id", c.RevokeToken)
+		}
+		shares := api.Group("/shares")
+		{
+			shares.GET("", authmiddleware, c.ListShares)
+			shares.POST("", authmiddleware, middleware.SessionOnly(), c.CreateShare)
+			shares.PATCH(":shareID", authmiddleware, middleware.SessionOnly(), c.UpdateShare)
+			shares.DELETE(":shareID", authmiddleware, middleware.SessionOnly(), c.DeleteShare)
+			shares.GET(":shareID", c.GetShare)
+			shares.POST(":shareID/unlock", c.UnlockShare)
+			shares.GET(":shareID/files", c.ListShareFiles)
+		}
+	}
+
+	webdavAuth := middleware.WebdavAuthmiddleware(cnf.JWT.Secret)
+	webdav := r.Group("/webdav", webdavAuth)
+	{
+		for _, method := range []string{"OPTIONS", "GET", "HEAD", "PUT", "DELETE", "MKCOL", "COPY", "MOVE",
+			"PROPFIND", "PROPPATCH", "LOCK", "UNLOCK"} {
+			webdav.Handle(method, "", c.HandleWebdav)
+			webdav.Handle(method, "/*path", c.HandleWebdav)
 		}
 	}
 
@@ -59,3 +141,8 @@ func InitRouter(r *gin.Engine, c *controller.Controller, cnf *config.Config) *gi
 
 	return r
 }
+
+func InitS3Router(r *gin.Engine, c *controller.Controller) *gin.Engine {
+	r.Any("/*path", c.HandleS3)
+	return r
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+func NewCheck() *cobra.Command {
+	config := config.Config{}
+	opts := schemas.CheckIn{}
+	var report string
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Verify that the parts of every file exist in Telegram",
+		Long: "Verify that the part messages of every file still exist in their channel and that their sizes " +
+			"add up to the size of the file. A JSON report of missing, mismatched and duplicated parts is written " +
+			"to stdout or to --report. With --quarantine broken files are hidden until they are released.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			if report != "" && report != "-" {
+				f, err := os.Create(report)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return runCheck(cmd.Context(), &config, &opts, out)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&opts.UserID, "user-id", 0, "Only check files of this user")
+	cmd.Flags().Int64Var(&opts.ChannelID, "channel-id", 0, "Only check files stored in this channel")
+	cmd.Flags().BoolVar(&opts.Quarantine, "quarantine", false, "Quarantine files with missing or mismatched parts")
+	cmd.Flags().StringVar(&report, "report", "-", "File the JSON report is written to, - for stdout")
+
+	return cmd
+}
+
+func runCheck(ctx context.Context, conf *config.Config, opts *schemas.CheckIn, out io.Writer) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	report, err := services.NewFileService(db, conf, nil).CheckFiles(ctx, opts)
+	if report != nil {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
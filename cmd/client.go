@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/divyam234/teldrive/internal/client"
+	"github.com/divyam234/teldrive/internal/http_range"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/spf13/cobra"
+)
+
+// clientCmd holds the options shared by the client subcommands.
+type clientCmd struct {
+	server     string
+	token      string
+	configFile string
+	json       bool
+	quiet      bool
+
+	config *client.Config
+	client *client.Client
+}
+
+func NewClient() *cobra.Command {
+	cl := &clientCmd{}
+	cmd := &cobra.Command{
+		Use:   "client",
+		Short: "Manage files on a running teldrive server",
+		Long: "Manage files on a running teldrive server through its REST API. Log in once with " +
+			"client login, the server and session token are stored in " + client.ConfigPath() + ".",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return cl.init(cmd)
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return cl.saveToken()
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&cl.server, "server", "", "Server URL, defaults to $TELDRIVE_SERVER or the stored server")
+	flags.StringVar(&cl.token, "token", "", "Session token, defaults to $TELDRIVE_TOKEN or the stored token")
+	flags.StringVar(&cl.configFile, "client-config", client.ConfigPath(), "Stored client config")
+	flags.BoolVar(&cl.json, "json", false, "Print JSON output for scripts")
+	flags.BoolVarP(&cl.quiet, "quiet", "q", false, "Do not print progress")
+
+	cmd.AddCommand(cl.newLogin(), cl.newLs(), cl.newGet(), cl.newPut(), cl.newMkdir(), cl.newMv(), cl.newCp(), cl.newRm())
+
+	return cmd
+}
+
+func (cl *clientCmd) init(cmd *cobra.Command) error {
+	config, err := client.LoadConfig(cl.configFile)
+	if err != nil {
+		return err
+	}
+	cl.config = config
+
+	if cl.server == "" {
+		cl.server = os.Getenv("TELDRIVE_SERVER")
+	}
+	if cl.token == "" {
+		cl.token = os.Getenv("TELDRIVE_TOKEN")
+	}
+
+	server, token := cl.server, cl.token
+	if server == "" {
+		server = config.Server
+	}
+	if token == "" {
+		token = config.Token
+	}
+
+	if cmd.Name() != "login" && (server == "" || token == "") {
+		return errors.New("not logged in, run teldrive client login first")
+	}
+
+	cl.client = client.New(server, token)
+	return nil
+}
+
+// saveToken stores the session token extended by the server, so that a stored session
+// does not expire while the client is in use.
+func (cl *clientCmd) saveToken() error {
+	if cl.client == nil || cl.token != "" || cl.config.Token == "" || cl.client.Token == cl.config.Token {
+		return nil
+	}
+	cl.config.Token = cl.client.Token
+	return cl.config.Save(cl.configFile)
+}
+
+func (cl *clientCmd) context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(cmd.Context(), os.Interrupt)
+}
+
+func (cl *clientCmd) progress() io.Writer {
+	if cl.json || cl.quiet {
+		return nil
+	}
+	return os.Stderr
+}
+
+// print writes v as JSON with --json, otherwise it calls text.
+func (cl *clientCmd) print(cmd *cobra.Command, v any, text func(w io.Writer)) error {
+	if cl.json {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(cmd.OutOrStdout())
+	return nil
+}
+
+func (cl *clientCmd) stat(ctx context.Context, p string) (*schemas.FileOut, error) {
+	file, err := cl.client.Stat(ctx, p)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return file, err
+}
+
+// target returns the folder and name dest refers to, for commands that put src there.
+// An existing folder or a path ending in a slash is the folder src is put into.
+func (cl *clientCmd) target(ctx context.Context, dest, name string) (string, string, error) {
+	clean := path.Clean("/" + dest)
+	if strings.HasSuffix(dest, "/") {
+		return clean, name, nil
+	}
+	file, err := cl.client.Stat(ctx, clean)
+	switch {
+	case err == nil && file.Type == "folder":
+		return clean, name, nil
+	case err != nil && !errors.Is(err, client.ErrNotFound):
+		return "", "", err
+	}
+	dir, base := path.Split(clean)
+	return path.Clean(dir), base, nil
+}
+
+func (cl *clientCmd) newLogin() *cobra.Command {
+	return &cobra.Command{
+		Use:   "login",
+		Short: "Check and store the server URL and session token",
+		Long:  "Check and store the server URL and session token. The token is the value of the user-session cookie of a browser session.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cl.client.Server == "" || cl.client.Token == "" {
+				return errors.New("--server and --token are required")
+			}
+
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			session, err := cl.client.Session(ctx)
+			if err != nil {
+				return err
+			}
+
+			cl.config.Server, cl.config.Token = cl.client.Server, cl.client.Token
+			if err := cl.config.Save(cl.configFile); err != nil {
+				return err
+			}
+
+			return cl.print(cmd, session, func(w io.Writer) {
+				fmt.Fprintf(w, "logged in to %s as %s\n", cl.client.Server, session.UserName)
+			})
+		},
+	}
+}
+
+func (cl *clientCmd) newLs() *cobra.Command {
+	query := schemas.FileQuery{Op: "list", Sort: "name", Order: "asc"}
+	var pages int
+	cmd := &cobra.Command{
+		Use:   "ls [path]",
+		Short: "List a folder",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			query.Path = "/"
+			if len(args) > 0 {
+				query.Path = path.Clean("/" + args[0])
+			}
+
+			res := &schemas.FileResponse{Files: []schemas.FileOut{}}
+			for page := 0; pages <= 0 || page < pages; page++ {
+				next, err := cl.client.List(ctx, &query)
+				if err != nil {
+					return err
+				}
+				res.Files = append(res.Files, next.Files...)
+				res.NextPageToken = next.NextPageToken
+				if next.NextPageToken == "" {
+					break
+				}
+				query.NextPageToken = next.NextPageToken
+			}
+
+			return cl.print(cmd, res, func(w io.Writer) {
+				tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+				for _, file := range res.Files {
+					size := "-"
+					name := file.Name
+					if file.Type == "folder" {
+						name += "/"
+					} else {
+						size = client.FormatSize(file.Size)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", file.UpdatedAt.Local().Format("2006-01-02 15:04"), size, name)
+				}
+				tw.Flush()
+				if res.NextPageToken != "" {
+					fmt.Fprintf(w, "more files, continue with --page-token %s\n", res.NextPageToken)
+				}
+			})
+		},
+	}
+
+	cmd.Flags().IntVar(&query.PerPage, "per-page", 500, "Files per page")
+	cmd.Flags().IntVar(&pages, "pages", 0, "Pages to list, 0 lists all pages")
+	cmd.Flags().StringVar(&query.NextPageToken, "page-token", "", "Continue a listing from the token of its last page")
+	cmd.Flags().StringVar(&query.Sort, "sort", "name", "Sort by name, size or updatedAt")
+	cmd.Flags().StringVar(&query.Order, "order", "asc", "Sort order, asc or desc")
+
+	return cmd
+}
+
+func (cl *clientCmd) newGet() *cobra.Command {
+	opts := client.DownloadOptions{}
+	var byteRange string
+	cmd := &cobra.Command{
+		Use:   "get <path> [local]",
+		Short: "Download a file, - writes it to stdout",
+		Long: "Download a file. Chunks are read in parallel and an interrupted download continues " +
+			"where it stopped when it is run again. With - as local the file is written to stdout.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			file, err := cl.stat(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if file.Type == "folder" {
+				return fmt.Errorf("%s is a folder", args[0])
+			}
+
+			opts.Start, opts.End = 0, -1
+			if byteRange != "" {
+				ranges, err := http_range.Parse("bytes="+byteRange, file.Size)
+				if err != nil || len(ranges) != 1 {
+					return fmt.Errorf("invalid range %q", byteRange)
+				}
+				opts.Start, opts.End = ranges[0].Start, ranges[0].End
+			}
+			opts.Progress = cl.progress()
+
+			local := file.Name
+			if len(args) > 1 {
+				local = args[1]
+			}
+
+			if local == "-" {
+				return cl.client.Stream(ctx, file, cmd.OutOrStdout(), &opts)
+			}
+
+			if info, err := os.Stat(local); err == nil && info.IsDir() {
+				local = filepath.Join(local, file.Name)
+			}
+
+			if err := cl.client.Download(ctx, file, local, &opts); err != nil {
+				return err
+			}
+
+			return cl.print(cmd, map[string]any{"id": file.ID, "path": args[0], "local": local}, func(w io.Writer) {
+				if cl.quiet {
+					return
+				}
+				fmt.Fprintf(w, "downloaded %s to %s\n", args[0], local)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&byteRange, "range", "", "Download only a byte range such as 0-1023, 1024- or -512")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 4, "Chunks downloaded at once")
+	cmd.Flags().Int64Var(&opts.ChunkSize, "chunk-size", 64*1024*1024, "Chunk size in bytes")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 3, "Retries of a failed chunk")
+
+	return cmd
+}
+
+func (cl *clientCmd) newPut() *cobra.Command {
+	opts := client.UploadOptions{}
+	cmd := &cobra.Command{
+		Use:   "put <local> [path]",
+		Short: "Upload a file",
+		Long: "Upload a file, replacing an existing file of the same name. An interrupted upload " +
+			"does not send the parts that were sent already when it is run again.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			info, err := os.Stat(args[0])
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return fmt.Errorf("%s is not a file", args[0])
+			}
+
+			dest := "/"
+			if len(args) > 1 {
+				dest = args[1]
+			}
+			dir, name, err := cl.target(ctx, dest, filepath.Base(args[0]))
+			if err != nil {
+				return err
+			}
+
+			opts.Progress = cl.progress()
+
+			out, err := cl.client.Upload(ctx, args[0], path.Join(dir, name), &opts)
+			if err != nil {
+				return err
+			}
+
+			return cl.print(cmd, out, func(w io.Writer) {
+				if cl.quiet {
+					return
+				}
+				fmt.Fprintf(w, "uploaded %s to %s\n", args[0], path.Join(dir, name))
+			})
+		},
+	}
+
+	cmd.Flags().Int64Var(&opts.PartSize, "part-size", 1000*1024*1024, "Part size in bytes")
+	cmd.Flags().IntVar(&opts.Concurrency, "concurrency", 1, "Parts uploaded at once, file checksums are only computed with 1")
+	cmd.Flags().BoolVar(&opts.Encrypted, "encrypt", false, "Encrypt the file on the server")
+	cmd.Flags().Int64Var(&opts.ChannelID, "channel-id", 0, "Channel the file is stored in, defaults to the default channel")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 3, "Retries of a failed part")
+
+	return cmd
+}
+
+func (cl *clientCmd) newMkdir() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mkdir <path>...",
+		Short: "Create folders and their missing parents",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			created := []string{}
+			for _, arg := range args {
+				p := path.Clean("/" + arg)
+				if err := cl.client.MakeDirectory(ctx, p); err != nil {
+					return err
+				}
+				created = append(created, p)
+			}
+
+			return cl.print(cmd, created, func(w io.Writer) {})
+		},
+	}
+}
+
+func (cl *clientCmd) newMv() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mv <path> <dest>",
+		Short: "Move or rename a file or folder",
+		Long:  "Move or rename a file or folder. A file or folder is moved into dest when dest is an existing folder.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			file, err := cl.stat(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if file.ParentID == "" {
+				return errors.New("the root folder cannot be moved")
+			}
+
+			dir, name, err := cl.target(ctx, args[1], file.Name)
+			if err != nil {
+				return err
+			}
+			dest := path.Join(dir, name)
+
+			srcDir, _ := path.Split(path.Clean("/" + args[0]))
+			srcDir = path.Clean(srcDir)
+
+			if file.Type == "folder" {
+				err = cl.client.MoveDirectory(ctx, path.Clean("/"+args[0]), dest)
+			} else {
+				if dir != srcDir {
+					err = cl.client.Move(ctx, []string{file.ID}, dir)
+				}
+				if err == nil && name != file.Name {
+					_, err = cl.client.Update(ctx, file.ID, &schemas.FileUpdate{Name: name})
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			return cl.print(cmd, map[string]string{"id": file.ID, "path": dest}, func(w io.Writer) {})
+		},
+	}
+}
+
+func (cl *clientCmd) newCp() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cp <path> <dest>",
+		Short: "Copy a file",
+		Long:  "Copy a file. The file is copied into dest when dest is an existing folder.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			file, err := cl.stat(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if file.Type == "folder" {
+				return fmt.Errorf("%s is a folder, only files can be copied", args[0])
+			}
+
+			dir, name, err := cl.target(ctx, args[1], file.Name)
+			if err != nil {
+				return err
+			}
+
+			if dir != "/" {
+				if err := cl.client.MakeDirectory(ctx, dir); err != nil {
+					return err
+				}
+			}
+
+			out, err := cl.client.Copy(ctx, file.ID, name, dir)
+			if err != nil {
+				return err
+			}
+
+			return cl.print(cmd, out, func(w io.Writer) {})
+		},
+	}
+}
+
+func (cl *clientCmd) newRm() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <path>...",
+		Short: "Delete files and folders",
+		Long:  "Delete files and folders. They are moved to the trash when the server keeps deleted files.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := cl.context(cmd)
+			defer stop()
+
+			ids := []string{}
+			for _, arg := range args {
+				file, err := cl.stat(ctx, arg)
+				if err != nil {
+					return err
+				}
+				if file.ParentID == "" {
+					return errors.New("the root folder cannot be deleted")
+				}
+				ids = append(ids, file.ID)
+			}
+
+			if err := cl.client.Delete(ctx, ids); err != nil {
+				return err
+			}
+
+			return cl.print(cmd, ids, func(w io.Writer) {})
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+// rcloneFlags describe the rclone crypt remote files are exported to or imported from,
+// with the options of the same name in the rclone config.
+type rcloneFlags struct {
+	password                string
+	password2               string
+	filenameEncryption      string
+	directoryNameEncryption bool
+}
+
+func addRcloneFlags(cmd *cobra.Command, flags *rcloneFlags) {
+	cmd.Flags().StringVar(&flags.password, "rclone-password", "", "Password of the rclone crypt remote, as shown by rclone reveal")
+	cmd.Flags().StringVar(&flags.password2, "rclone-password2", "", "Salt (password2) of the rclone crypt remote, as shown by rclone reveal")
+	cmd.Flags().StringVar(&flags.filenameEncryption, "rclone-filename-encryption", "standard", "Filename encryption of the rclone crypt remote, standard or off")
+	cmd.Flags().BoolVar(&flags.directoryNameEncryption, "rclone-directory-name-encryption", true, "Whether the rclone crypt remote encrypts directory names")
+}
+
+func (flags *rcloneFlags) remote() (*crypt.Rclone, error) {
+	return crypt.NewRclone(flags.password, flags.password2, flags.filenameEncryption, flags.directoryNameEncryption)
+}
+
+func NewExport() *cobra.Command {
+	config := config.Config{}
+	opts := services.ExportOptions{}
+	var (
+		format string
+		rclone rcloneFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export files to a local directory, decrypted or in rclone crypt format",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch format {
+			case "plain":
+			case "rclone":
+				remote, err := rclone.remote()
+				if err != nil {
+					return err
+				}
+				opts.Rclone = remote
+			default:
+				return fmt.Errorf("unknown format %q", format)
+			}
+			return runExport(cmd.Context(), &config, &opts)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&opts.UserID, "user-id", 0, "User whose files are exported")
+	cmd.Flags().StringVar(&opts.Path, "path", "/", "File or folder to export")
+	cmd.Flags().StringVar(&opts.Dir, "dest", "", "Local directory to write the files to")
+	cmd.Flags().StringVar(&format, "format", "plain", "Format of the exported files, plain or rclone")
+	addRcloneFlags(cmd, &rclone)
+
+	cmd.MarkFlagRequired("user-id")
+	cmd.MarkFlagRequired("dest")
+
+	return cmd
+}
+
+func runExport(ctx context.Context, conf *config.Config, opts *services.ExportOptions) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	count, err := services.NewFileService(db, conf, nil).Export(ctx, opts)
+
+	logging.DefaultLogger().Infow("files exported", "count", count)
+
+	return err
+}
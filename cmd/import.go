@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+func NewImport() *cobra.Command {
+	config := config.Config{}
+	opts := services.ImportOptions{}
+	var rclone rcloneFlags
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import the files of an rclone crypt remote as encrypted files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remote, err := rclone.remote()
+			if err != nil {
+				return err
+			}
+			opts.Rclone = remote
+			return runImport(cmd.Context(), &config, &opts)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&opts.UserID, "user-id", 0, "User the files are imported for")
+	cmd.Flags().StringVar(&opts.Dir, "source", "", "Local directory with the files of the rclone crypt remote")
+	cmd.Flags().StringVar(&opts.Path, "path", "/", "Folder to store the files in")
+	addRcloneFlags(cmd, &rclone)
+
+	cmd.MarkFlagRequired("user-id")
+	cmd.MarkFlagRequired("source")
+	cmd.MarkFlagRequired("rclone-password")
+
+	return cmd
+}
+
+func runImport(ctx context.Context, conf *config.Config, opts *services.ImportOptions) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	count, err := services.NewFileService(db, conf, nil).Import(ctx, opts)
+
+	logging.DefaultLogger().Infow("files imported", "count", count)
+
+	return err
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/pressly/goose/v3"
+	"github.com/spf13/cobra"
+)
+
+func NewMigrate() *cobra.Command {
+	config := config.Config{}
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate up|down|status|redo",
+		Short: "Run, roll back or list the database migrations",
+		Long: "Run, roll back or list the database migrations. up applies all pending migrations, down rolls " +
+			"back the latest one and redo rolls it back and applies it again. The migrations hold an advisory " +
+			"lock, so a server starting meanwhile waits for them instead of migrating too.",
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"up", "down", "status", "redo"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigrate(cmd.Context(), &config, args[0], dryRun, cmd.OutOrStdout())
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the SQL that would run without changing the database")
+
+	return cmd
+}
+
+func runMigrate(ctx context.Context, conf *config.Config, command string, dryRun bool, out io.Writer) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	conf.DB.Migrate.Enable = false
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	rawDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer rawDB.Close()
+
+	migrator, err := database.NewMigrator(rawDB)
+	if err != nil {
+		return err
+	}
+
+	if command == "status" {
+		return printMigrationStatus(ctx, migrator, out)
+	}
+
+	if dryRun {
+		return printMigrationPlan(ctx, migrator, command, out)
+	}
+
+	logger := logging.DefaultLogger()
+
+	logResult := func(res *goose.MigrationResult) {
+		logger.Infow("migration "+res.Direction, "migration", res.Source.Path, "duration", res.Duration)
+	}
+
+	switch command {
+	case "up":
+		results, err := migrator.Up(ctx)
+		for _, res := range results {
+			logResult(res)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			logger.Info("no pending migrations")
+		}
+
+	case "down", "redo":
+		res, err := migrator.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			return errors.New("no applied migrations to roll back")
+		}
+		if err != nil {
+			return err
+		}
+		logResult(res)
+
+		if command == "redo" {
+			res, err := migrator.ApplyVersion(ctx, res.Source.Version, true)
+			if err != nil {
+				return err
+			}
+			logResult(res)
+		}
+	}
+
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, migrator *goose.Provider, out io.Writer) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Applied At\tMigration")
+	for _, s := range status {
+		appliedAt := "Pending"
+		if s.State == goose.StateApplied {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", appliedAt, s.Source.Path)
+	}
+	return tw.Flush()
+}
+
+// printMigrationPlan prints the SQL a migrate command would run, in the order it would run.
+func printMigrationPlan(ctx context.Context, migrator *goose.Provider, command string, out io.Writer) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	type step struct {
+		source *goose.Source
+		up     bool
+	}
+
+	steps := []step{}
+
+	switch command {
+	case "up":
+		for _, s := range status {
+			if s.State == goose.StatePending {
+				steps = append(steps, step{s.Source, true})
+			}
+		}
+	case "down", "redo":
+		// Like goose, the applied migration with the highest version is rolled back.
+		var latest *goose.MigrationStatus
+		for _, s := range status {
+			if s.State == goose.StateApplied && (latest == nil || s.Source.Version > latest.Source.Version) {
+				latest = s
+			}
+		}
+		if latest == nil {
+			return errors.New("no applied migrations to roll back")
+		}
+		steps = append(steps, step{latest.Source, false})
+		if command == "redo" {
+			steps = append(steps, step{latest.Source, true})
+		}
+	}
+
+	if len(steps) == 0 {
+		fmt.Fprintln(out, "-- no pending migrations")
+		return nil
+	}
+
+	for _, step := range steps {
+		query, err := database.MigrationSQL(step.source, step.up)
+		if err != nil {
+			return err
+		}
+		direction := "down"
+		if step.up {
+			direction = "up"
+		}
+		fmt.Fprintf(out, "-- %s (%s)\n%s\n\n", step.source.Path, direction, query)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+type moveChannelOptions struct {
+	UserID    int64
+	Path      string
+	ChannelID int64
+}
+
+func NewMoveChannel() *cobra.Command {
+	config := config.Config{}
+	opts := moveChannelOptions{}
+	cmd := &cobra.Command{
+		Use:   "move-channel",
+		Short: "Move the parts of a file or folder to another channel",
+		Long: "Send the part messages of a file, or of every file below a folder, to another channel of the " +
+			"user again and point the files at the new messages. The old messages are deleted by the cleanup " +
+			"job of the server. The move is recorded like one started through the API and prints its result as JSON.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMoveChannel(cmd.Context(), &config, &opts, cmd.OutOrStdout())
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&opts.UserID, "user-id", 0, "User whose files are moved")
+	cmd.Flags().StringVar(&opts.Path, "path", "/", "File or folder to move")
+	cmd.Flags().Int64Var(&opts.ChannelID, "channel-id", 0, "Channel the parts are moved to")
+
+	cmd.MarkFlagRequired("user-id")
+	cmd.MarkFlagRequired("channel-id")
+
+	return cmd
+}
+
+func runMoveChannel(ctx context.Context, conf *config.Config, opts *moveChannelOptions, out io.Writer) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	fs := services.NewFileService(db, conf, nil)
+
+	file, appErr := fs.GetFileByPath(opts.UserID, opts.Path)
+	if appErr != nil {
+		return appErr.Error
+	}
+
+	job, appErr := fs.CreateChannelMove(opts.UserID, &schemas.ChannelMoveIn{ID: file.ID, ChannelID: opts.ChannelID})
+	if appErr != nil {
+		return appErr.Error
+	}
+
+	err = fs.RunChannelMove(ctx, job.ID)
+
+	job, appErr = fs.GetChannelMove(opts.UserID, job.ID)
+	if appErr != nil {
+		return appErr.Error
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(job); err != nil {
+		return err
+	}
+
+	return err
+}
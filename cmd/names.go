@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+func NewNames() *cobra.Command {
+	config := config.Config{}
+	cmd := &cobra.Command{
+		Use:       "names encrypt|decrypt",
+		Short:     "Encrypt or decrypt the stored names of existing files and folders",
+		Long:      "Encrypt or decrypt the stored names of existing files and folders. Run it with the server stopped when turning --tg-uploads-encrypt-names on or off.",
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"encrypt", "decrypt"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNames(cmd.Context(), &config, args[0] == "encrypt")
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	return cmd
+}
+
+func runNames(ctx context.Context, conf *config.Config, encrypt bool) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	count, err := services.ConvertNames(ctx, db, &conf.TG, encrypt)
+
+	logging.DefaultLogger().Infow("names converted", "count", count)
+
+	return err
+}
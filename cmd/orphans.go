@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+func NewOrphans() *cobra.Command {
+	config := config.Config{}
+	opts := schemas.OrphansIn{}
+	var report string
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "Find channel messages that no file references",
+		Long: "Page through the history of the storage channels and find the documents that no file, file " +
+			"version, thumbnail or unfinished upload references. A JSON report of the orphans and their sizes is " +
+			"written to stdout or to --report. With --delete orphans older than --orphans-grace-period are deleted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			if report != "" && report != "-" {
+				f, err := os.Create(report)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			return runOrphans(cmd.Context(), &config, &opts, out)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&opts.UserID, "user-id", 0, "Only reconcile channels of this user")
+	cmd.Flags().Int64Var(&opts.ChannelID, "channel-id", 0, "Only reconcile this channel")
+	cmd.Flags().BoolVar(&opts.Delete, "delete", false, "Delete orphans older than the grace period")
+	cmd.Flags().StringVar(&report, "report", "-", "File the JSON report is written to, - for stdout")
+
+	return cmd
+}
+
+func runOrphans(ctx context.Context, conf *config.Config, opts *schemas.OrphansIn, out io.Writer) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	report, err := services.NewFileService(db, conf, nil).ReconcileOrphans(ctx, opts)
+	if report != nil {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
@@ -12,6 +12,7 @@ import (
 	"unicode"
 
 	"github.com/divyam234/teldrive/api"
+	"github.com/divyam234/teldrive/internal/chunkcache"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/database"
 	"github.com/divyam234/teldrive/internal/duration"
@@ -48,60 +49,139 @@ func NewRun() *cobra.Command {
 		},
 	}
 
-	runCmd.Flags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
-	runCmd.Flags().IntVarP(&config.Server.Port, "server-port", "p", 8080, "Server port")
-	duration.DurationVar(runCmd.Flags(), &config.Server.GracefulShutdown, "server-graceful-shutdown", 15*time.Second, "Server graceful shutdown timeout")
-
-	runCmd.Flags().IntVarP(&config.Log.Level, "log-level", "", -1, "Logging level")
-	runCmd.Flags().StringVar(&config.Log.File, "log-file", "", "Logging file path")
-	runCmd.Flags().BoolVar(&config.Log.Development, "log-development", false, "Enable development mode")
-
-	runCmd.Flags().StringVar(&config.JWT.Secret, "jwt-secret", "", "JWT secret key")
-	duration.DurationVar(runCmd.Flags(), &config.JWT.SessionTime, "jwt-session-time", (30*24)*time.Hour, "JWT session duration")
-	runCmd.Flags().StringSliceVar(&config.JWT.AllowedUsers, "jwt-allowed-users", []string{}, "Allowed users")
-
-	runCmd.Flags().StringVar(&config.DB.DataSource, "db-data-source", "", "Database connection string")
-	runCmd.Flags().IntVar(&config.DB.LogLevel, "db-log-level", 1, "Database log level")
-	runCmd.Flags().BoolVar(&config.DB.Migrate.Enable, "db-migrate-enable", true, "Enable database migration")
-	runCmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-open-connections", 25, "Database max open connections")
-	runCmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-idle-connections", 25, "Database max idle connections")
-	duration.DurationVar(runCmd.Flags(), &config.DB.Pool.MaxLifetime, "db-pool-max-lifetime", 10*time.Minute, "Database max connection lifetime")
-
-	runCmd.Flags().IntVar(&config.TG.AppId, "tg-app-id", 0, "Telegram app ID")
-	runCmd.Flags().StringVar(&config.TG.AppHash, "tg-app-hash", "", "Telegram app hash")
-	runCmd.Flags().StringVar(&config.TG.SessionFile, "tg-session-file", "", "Bot session file path")
-	runCmd.Flags().BoolVar(&config.TG.RateLimit, "tg-rate-limit", true, "Enable rate limiting")
-	runCmd.Flags().IntVar(&config.TG.RateBurst, "tg-rate-burst", 5, "Limiting burst")
-	runCmd.Flags().IntVar(&config.TG.Rate, "tg-rate", 100, "Limiting rate")
-	runCmd.Flags().StringVar(&config.TG.DeviceModel, "tg-device-model",
-		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/116.0", "Device model")
-	runCmd.Flags().StringVar(&config.TG.SystemVersion, "tg-system-version", "Win32", "System version")
-	runCmd.Flags().StringVar(&config.TG.AppVersion, "tg-app-version", "4.6.3 K", "App version")
-	runCmd.Flags().StringVar(&config.TG.LangCode, "tg-lang-code", "en", "Language code")
-	runCmd.Flags().StringVar(&config.TG.SystemLangCode, "tg-system-lang-code", "en-US", "System language code")
-	runCmd.Flags().StringVar(&config.TG.LangPack, "tg-lang-pack", "webk", "Language pack")
-	runCmd.Flags().IntVar(&config.TG.BgBotsLimit, "tg-bg-bots-limit", 5, "Background bots limit")
-	runCmd.Flags().BoolVar(&config.TG.DisableStreamBots, "tg-disable-stream-bots", false, "Disable stream bots")
-	runCmd.Flags().StringVar(&config.TG.Uploads.EncryptionKey, "tg-uploads-encryption-key", "", "Uploads encryption key")
-	runCmd.Flags().IntVar(&config.TG.Uploads.Threads, "tg-uploads-threads", 16, "Uploads threads")
-	duration.DurationVar(runCmd.Flags(), &config.TG.Uploads.Retention, "tg-uploads-retention", (24*7)*time.Hour,
-		"Uploads retention duration")
+	addConfigFlags(runCmd, &config)
 
-	runCmd.MarkFlagRequired("tg-app-id")
-	runCmd.MarkFlagRequired("tg-app-hash")
-	runCmd.MarkFlagRequired("db-data-source")
 	runCmd.MarkFlagRequired("jwt-secret")
 
 	return runCmd
 }
 
-func runApplication(conf *config.Config) {
+// addConfigFlags registers a flag for every field of config. Commands that load the
+// configuration need all of them for the config file and environment to be applied.
+func addConfigFlags(cmd *cobra.Command, config *config.Config) {
+	cmd.Flags().StringP("config", "c", "", "config file (default is $HOME/.teldrive/config.toml)")
+	cmd.Flags().IntVarP(&config.Server.Port, "server-port", "p", 8080, "Server port")
+	duration.DurationVar(cmd.Flags(), &config.Server.GracefulShutdown, "server-graceful-shutdown", 15*time.Second, "Server graceful shutdown timeout")
+
+	cmd.Flags().IntVarP(&config.Log.Level, "log-level", "", -1, "Logging level")
+	cmd.Flags().StringVar(&config.Log.File, "log-file", "", "Logging file path")
+	cmd.Flags().BoolVar(&config.Log.Development, "log-development", false, "Enable development mode")
+
+	cmd.Flags().StringVar(&config.JWT.Secret, "jwt-secret", "", "JWT secret key")
+	duration.DurationVar(cmd.Flags(), &config.JWT.SessionTime, "jwt-session-time", (30*24)*time.Hour, "JWT session duration")
+	cmd.Flags().StringSliceVar(&config.JWT.AllowedUsers, "jwt-allowed-users", []string{}, "Allowed users")
+	cmd.Flags().StringSliceVar(&config.JWT.AdminUsers, "jwt-admin-users", []string{}, "Users allowed to use the admin API")
+
+	cmd.Flags().StringVar(&config.DB.DataSource, "db-data-source", "", "Database connection string")
+	cmd.Flags().IntVar(&config.DB.LogLevel, "db-log-level", 1, "Database log level")
+	cmd.Flags().BoolVar(&config.DB.Migrate.Enable, "db-migrate-enable", true, "Enable database migration")
+	cmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-open-connections", 25, "Database max open connections")
+	cmd.Flags().IntVar(&config.DB.Pool.MaxIdleConnections, "db-pool-max-idle-connections", 25, "Database max idle connections")
+	duration.DurationVar(cmd.Flags(), &config.DB.Pool.MaxLifetime, "db-pool-max-lifetime", 10*time.Minute, "Database max connection lifetime")
+
+	cmd.Flags().IntVar(&config.TG.AppId, "tg-app-id", 0, "Telegram app ID")
+	cmd.Flags().StringVar(&config.TG.AppHash, "tg-app-hash", "", "Telegram app hash")
+	cmd.Flags().StringVar(&config.TG.SessionFile, "tg-session-file", "", "Bot session file path")
+	cmd.Flags().BoolVar(&config.TG.RateLimit, "tg-rate-limit", true, "Enable rate limiting")
+	cmd.Flags().IntVar(&config.TG.RateBurst, "tg-rate-burst", 5, "Limiting burst")
+	cmd.Flags().IntVar(&config.TG.Rate, "tg-rate", 100, "Limiting rate")
+	cmd.Flags().StringVar(&config.TG.DeviceModel, "tg-device-model",
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/116.0", "Device model")
+	cmd.Flags().StringVar(&config.TG.SystemVersion, "tg-system-version", "Win32", "System version")
+	cmd.Flags().StringVar(&config.TG.AppVersion, "tg-app-version", "4.6.3 K", "App version")
+	cmd.Flags().StringVar(&config.TG.LangCode, "tg-lang-code", "en", "Language code")
+	cmd.Flags().StringVar(&config.TG.SystemLangCode, "tg-system-lang-code", "en-US", "System language code")
+	cmd.Flags().StringVar(&config.TG.LangPack, "tg-lang-pack", "webk", "Language pack")
+	cmd.Flags().IntVar(&config.TG.BgBotsLimit, "tg-bg-bots-limit", 5, "Background bots limit")
+	cmd.Flags().BoolVar(&config.TG.DisableStreamBots, "tg-disable-stream-bots", false, "Disable stream bots")
+	cmd.Flags().IntVar(&config.TG.Stream.Concurrency, "tg-stream-concurrency", 4,
+		"Number of chunk requests kept in flight per stream")
+	cmd.Flags().Int64Var(&config.TG.Stream.BufferSize, "tg-stream-buffer-size", 16*1024*1024,
+		"Memory in bytes a stream may use for prefetched chunks")
+	cmd.Flags().BoolVar(&config.TG.Stream.MultiBots, "tg-stream-multi-bots", false,
+		"Spread the chunk requests of a stream over all stream bots of the channel")
+	cmd.Flags().StringVar(&config.TG.Stream.CacheDir, "tg-stream-cache-dir", "",
+		"Directory of the chunk cache (defaults to a folder in the temp directory)")
+	cmd.Flags().Int64Var(&config.TG.Stream.CacheSize, "tg-stream-cache-size", 0,
+		"Disk space in bytes used to cache streamed chunks (0 disables the cache)")
+	cmd.Flags().IntVar(&config.TG.Stream.CacheWrites, "tg-stream-cache-writes", 4,
+		"Maximum number of chunks written to the cache at the same time")
+	cmd.Flags().StringVar(&config.TG.Uploads.EncryptionKey, "tg-uploads-encryption-key", "", "Uploads encryption key")
+	cmd.Flags().IntVar(&config.TG.Uploads.Threads, "tg-uploads-threads", 16, "Uploads threads")
+	duration.DurationVar(cmd.Flags(), &config.TG.Uploads.Retention, "tg-uploads-retention", (24*7)*time.Hour,
+		"Uploads retention duration")
+	cmd.Flags().Int64Var(&config.TG.Uploads.PartSize, "tg-uploads-part-size", 1000*1024*1024,
+		"Part size in bytes for server side uploads")
+	cmd.Flags().StringVar(&config.TG.Uploads.BufferDir, "tg-uploads-buffer-dir", "",
+		"Directory for buffering resumable uploads until a part is complete (default system temp dir)")
+
+	cmd.Flags().IntVar(&config.TG.Uploads.KeyRotationBatch, "tg-uploads-key-rotation-batch", 10,
+		"Files re-encrypted per hour after an encryption key is retired, 0 disables rotation")
+	cmd.Flags().BoolVar(&config.TG.Uploads.EncryptNames, "tg-uploads-encrypt-names", false,
+		"Store file and folder names encrypted with the uploads encryption key")
+	duration.DurationVar(cmd.Flags(), &config.Trash.Retention, "trash-retention", (24*30)*time.Hour,
+		"Duration to keep deleted items in trash before they are purged")
+
+	cmd.Flags().IntVar(&config.Versions.Keep, "versions-keep", 10,
+		"Number of previous versions to keep per file, 0 disables versioning")
+	duration.DurationVar(cmd.Flags(), &config.Versions.Retention, "versions-retention", 0,
+		"Duration to keep previous versions of files, 0 keeps them until pruned by count")
+
+	cmd.Flags().IntVar(&config.Thumbnails.Size, "thumbnails-size", 320,
+		"Maximum width and height in pixels of image thumbnails, 0 disables thumbnails")
+	cmd.Flags().Int64Var(&config.Thumbnails.MaxFileSize, "thumbnails-max-file-size", 20*1024*1024,
+		"Largest image in bytes that thumbnails are generated for")
+	cmd.Flags().IntVar(&config.Thumbnails.Workers, "thumbnails-workers", 2,
+		"Number of thumbnails generated at the same time after uploads")
+
+	duration.DurationVar(cmd.Flags(), &config.Orphans.Interval, "orphans-interval", 0,
+		"Interval of the job that finds channel messages no file references, 0 disables the job")
+	cmd.Flags().BoolVar(&config.Orphans.Delete, "orphans-delete", false,
+		"Delete orphaned messages found by the job once they are older than the grace period")
+	duration.DurationVar(cmd.Flags(), &config.Orphans.GracePeriod, "orphans-grace-period", 7*24*time.Hour,
+		"Age an orphaned message must reach before it is deleted")
+
+	cmd.Flags().Int64Var(&config.Channels.RolloverMessages, "channels-rollover-messages", 0,
+		"Messages in the default channel at which a new default channel is created, 0 disables the limit")
+	cmd.Flags().Int64Var(&config.Channels.RolloverSize, "channels-rollover-size", 0,
+		"Bytes in the default channel at which a new default channel is created, 0 disables the limit")
+
+	cmd.Flags().Int64Var(&config.Quota.Size, "quota-size", 0,
+		"Bytes each user may store unless an admin sets their quota, 0 is unlimited")
+	cmd.Flags().Int64Var(&config.Quota.Files, "quota-files", 0,
+		"Files each user may store unless an admin sets their quota, 0 is unlimited")
+
+	cmd.Flags().BoolVar(&config.S3.Enable, "s3-enable", false, "Enable S3 compatible gateway")
+	cmd.Flags().IntVar(&config.S3.Port, "s3-port", 8081, "S3 gateway port")
+
+	cmd.MarkFlagRequired("tg-app-id")
+	cmd.MarkFlagRequired("tg-app-hash")
+	cmd.MarkFlagRequired("db-data-source")
+}
+
+// setDefaults configures the packages that keep their settings globally.
+func setDefaults(conf *config.Config) {
 	logging.SetConfig(&logging.Config{
 		Level:       zapcore.Level(conf.Log.Level),
 		Development: conf.Log.Development,
 		FilePath:    conf.Log.File,
 	})
 
+	chunkcache.SetConfig(&chunkcache.Config{
+		Dir:       conf.TG.Stream.CacheDir,
+		Size:      conf.TG.Stream.CacheSize,
+		MaxWrites: conf.TG.Stream.CacheWrites,
+	})
+
+	// Streams read without the chunk cache when it can't be opened.
+	if _, err := chunkcache.Default(); err != nil {
+		logging.DefaultLogger().Errorw("failed to open chunk cache, streams are not cached", "err", err)
+	}
+}
+
+func runApplication(conf *config.Config) {
+	setDefaults(conf)
+
 	tgContext, cancel := context.WithCancel(context.Background())
 
 	defer func() {
@@ -127,6 +207,11 @@ func runApplication(conf *config.Config) {
 			services.NewFileService,
 			services.NewUploadService,
 			services.NewUserService,
+			services.NewWebdavService,
+			services.NewS3Service,
+			services.NewShareService,
+			services.NewTusService,
+			services.NewTokenService,
 			controller.NewController,
 		),
 	)
@@ -246,5 +331,39 @@ func initApp(lc fx.Lifecycle, cfg *config.Config, c *controller.Controller) *gin
 			return srv.Shutdown(ctx)
 		},
 	})
+
+	if cfg.S3.Enable {
+		initS3Server(lc, cfg, c)
+	}
+
 	return r
 }
+
+func initS3Server(lc fx.Lifecycle, cfg *config.Config, c *controller.Controller) {
+	r := gin.New()
+
+	r.Use(ginzap.GinzapWithConfig(logging.DefaultLogger().Desugar(), &ginzap.Config{
+		TimeFormat: time.RFC3339,
+		UTC:        true,
+	}))
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.S3.Port),
+		Handler: api.InitS3Router(r, c),
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			logging.FromContext(ctx).Infof("Started S3 gateway http://localhost:%d", cfg.S3.Port)
+			go func() {
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logging.DefaultLogger().Errorw("failed to close s3 server", "err", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			logging.FromContext(ctx).Info("Stopped S3 gateway")
+			return srv.Shutdown(ctx)
+		},
+	})
+}
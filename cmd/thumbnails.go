@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/spf13/cobra"
+)
+
+func NewThumbnails() *cobra.Command {
+	config := config.Config{}
+	var userId int64
+	cmd := &cobra.Command{
+		Use:   "thumbnails",
+		Short: "Generate missing thumbnails of existing images",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runThumbnails(cmd.Context(), &config, userId)
+		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return initViperConfig(cmd)
+		},
+	}
+
+	addConfigFlags(cmd, &config)
+
+	cmd.Flags().Int64Var(&userId, "user-id", 0, "Only generate thumbnails for files of this user")
+
+	return cmd
+}
+
+func runThumbnails(ctx context.Context, conf *config.Config, userId int64) error {
+	setDefaults(conf)
+
+	defer logging.DefaultLogger().Sync()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	db, err := database.NewDatabase(conf)
+	if err != nil {
+		return err
+	}
+
+	count, err := services.NewFileService(db, conf, nil).BackfillThumbnails(ctx, userId)
+
+	logging.DefaultLogger().Infow("thumbnails generated", "count", count)
+
+	return err
+}
@@ -0,0 +1,70 @@
+// Package checksum computes the SHA-256 and MD5 hashes stored for uploaded files.
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+)
+
+var ErrInvalidState = errors.New("checksum: invalid state")
+
+// Hasher computes SHA-256 and MD5 over the same data.
+type Hasher struct {
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+func New() *Hasher {
+	return &Hasher{sha256: sha256.New(), md5: md5.New()}
+}
+
+// Resume restores a Hasher from a state returned by State, so a file uploaded in
+// several requests can be hashed as a whole.
+func Resume(state []byte) (*Hasher, error) {
+	if len(state) < 4 {
+		return nil, ErrInvalidState
+	}
+	n := int(binary.BigEndian.Uint32(state))
+	if len(state) < 4+n {
+		return nil, ErrInvalidState
+	}
+	h := New()
+	if err := h.sha256.(encoding.BinaryUnmarshaler).UnmarshalBinary(state[4 : 4+n]); err != nil {
+		return nil, err
+	}
+	if err := h.md5.(encoding.BinaryUnmarshaler).UnmarshalBinary(state[4+n:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	h.md5.Write(p)
+	return len(p), nil
+}
+
+// State returns the intermediate state of both hashes.
+func (h *Hasher) State() ([]byte, error) {
+	shaState, err := h.sha256.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	md5State, err := h.md5.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	state := binary.BigEndian.AppendUint32(nil, uint32(len(shaState)))
+	state = append(state, shaState...)
+	return append(state, md5State...), nil
+}
+
+// Sums returns the hex encoded SHA-256 and MD5 of the data written so far.
+func (h *Hasher) Sums() (string, string) {
+	return hex.EncodeToString(h.sha256.Sum(nil)), hex.EncodeToString(h.md5.Sum(nil))
+}
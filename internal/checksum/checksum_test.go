@@ -0,0 +1,37 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResume(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+
+	h := New()
+	h.Write(data[:10])
+
+	state, err := h.State()
+	assert.NoError(t, err)
+
+	resumed, err := Resume(state)
+	assert.NoError(t, err)
+	resumed.Write(data[10:])
+
+	shaSum, md5Sum := resumed.Sums()
+
+	expectedSha := sha256.Sum256(data)
+	expectedMd5 := md5.Sum(data)
+
+	assert.Equal(t, hex.EncodeToString(expectedSha[:]), shaSum)
+	assert.Equal(t, hex.EncodeToString(expectedMd5[:]), md5Sum)
+}
+
+func TestResumeInvalid(t *testing.T) {
+	_, err := Resume([]byte{0, 0})
+	assert.Equal(t, ErrInvalidState, err)
+}
@@ -0,0 +1,288 @@
+// Package chunkcache keeps chunks downloaded from Telegram on disk so that
+// repeated reads of the same bytes, such as seeking in a video, are served locally.
+package chunkcache
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const tmpSuffix = ".tmp"
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// Cache is a size bounded LRU cache of chunks stored as one file per chunk.
+// Chunks are written to a temporary file and renamed into place, so a crash never
+// leaves a partial chunk behind.
+type Cache struct {
+	dir       string
+	maxSize   int64
+	mu        sync.Mutex
+	lru       *list.List
+	items     map[string]*list.Element
+	size      int64
+	writes    chan struct{}
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+	skipped   atomic.Int64
+}
+
+type Stats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Skipped   int64
+	Entries   int
+	Size      int64
+}
+
+// New opens the cache in dir, picking up chunks written by earlier runs.
+func New(dir string, maxSize int64, maxWrites int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+		writes:  make(chan struct{}, max(maxWrites, 1)),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load indexes the chunks on disk, oldest first, and removes unfinished writes.
+func (c *Cache) load() error {
+	type file struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+
+	files := []file{}
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(d.Name(), tmpSuffix) {
+			os.Remove(path)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{key: d.Name(), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range files {
+		c.items[f.key] = c.lru.PushFront(&entry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+	c.evict()
+
+	return nil
+}
+
+func Key(documentID, offset, limit int64) string {
+	return fmt.Sprintf("%d-%d-%d", documentID, offset, limit)
+}
+
+func (c *Cache) path(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return filepath.Join(c.dir, fmt.Sprintf("%02x", h.Sum32()&0xff), key)
+}
+
+// Get returns the chunk stored under key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.mu.Lock()
+		if elem, ok := c.items[key]; ok {
+			c.remove(elem)
+		}
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return data, true
+}
+
+// Put stores data under key in the background. Chunks are dropped when the
+// maximum number of writes is already in progress.
+func (c *Cache) Put(key string, data []byte) {
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	_, ok := c.items[key]
+	c.mu.Unlock()
+	if ok {
+		return
+	}
+
+	select {
+	case c.writes <- struct{}{}:
+	default:
+		c.skipped.Add(1)
+		return
+	}
+
+	go func() {
+		defer func() { <-c.writes }()
+		c.write(key, data)
+	}()
+}
+
+func (c *Cache) write(key string, data []byte) error {
+	path := c.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*"+tmpSuffix)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[key]; ok {
+		return nil
+	}
+	c.items[key] = c.lru.PushFront(&entry{key: key, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		c.remove(elem)
+		c.evictions.Add(1)
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.lru.Remove(elem)
+	delete(c.items, e.key)
+	c.size -= e.size
+	os.Remove(c.path(e.key))
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Skipped:   c.skipped.Load(),
+		Entries:   len(c.items),
+		Size:      c.size,
+	}
+}
+
+type Config struct {
+	Dir       string
+	Size      int64
+	MaxWrites int
+}
+
+var (
+	conf         = &Config{}
+	defaultCache *Cache
+	defaultOnce  sync.Once
+	defaultErr   error
+)
+
+func SetConfig(c *Config) {
+	conf = &Config{
+		Dir:       c.Dir,
+		Size:      c.Size,
+		MaxWrites: c.MaxWrites,
+	}
+}
+
+// Default returns the cache shared by all readers, or nil when it is disabled.
+func Default() (*Cache, error) {
+	defaultOnce.Do(func() {
+		if conf.Size <= 0 {
+			return
+		}
+		dir := conf.Dir
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "teldrive-chunks")
+		}
+		defaultCache, defaultErr = New(dir, conf.Size, conf.MaxWrites)
+	})
+	return defaultCache, defaultErr
+}
@@ -0,0 +1,69 @@
+package chunkcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPut(t *testing.T) {
+	c, err := New(t.TempDir(), 10, 1)
+	assert.NoError(t, err)
+
+	_, ok := c.Get(Key(1, 0, 4))
+	assert.False(t, ok)
+
+	assert.NoError(t, c.write(Key(1, 0, 4), []byte("abcd")))
+
+	data, ok := c.Get(Key(1, 0, 4))
+	assert.True(t, ok)
+	assert.Equal(t, "abcd", string(data))
+
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(4), stats.Size)
+}
+
+func TestEviction(t *testing.T) {
+	c, err := New(t.TempDir(), 10, 1)
+	assert.NoError(t, err)
+
+	c.write(Key(1, 0, 4), []byte("aaaa"))
+	c.write(Key(1, 4, 4), []byte("bbbb"))
+
+	// Touch the first chunk so that the second one is the least recently used.
+	c.Get(Key(1, 0, 4))
+
+	c.write(Key(1, 8, 4), []byte("cccc"))
+
+	_, ok := c.Get(Key(1, 4, 4))
+	assert.False(t, ok)
+	_, ok = c.Get(Key(1, 0, 4))
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), c.Stats().Size)
+	assert.Equal(t, int64(1), c.Stats().Evictions)
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := New(dir, 10, 1)
+	assert.NoError(t, err)
+	c.write(Key(2, 0, 3), []byte("xyz"))
+
+	tmp := filepath.Join(dir, "partial"+tmpSuffix)
+	assert.NoError(t, os.WriteFile(tmp, []byte("partial"), 0600))
+
+	c, err = New(dir, 10, 1)
+	assert.NoError(t, err)
+
+	data, ok := c.Get(Key(2, 0, 3))
+	assert.True(t, ok)
+	assert.Equal(t, "xyz", string(data))
+
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+}
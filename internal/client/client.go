@@ -0,0 +1,289 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// Error is an error response of the API.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+}
+
+// Client talks to the REST API of a teldrive server with the token of a session.
+type Client struct {
+	Server string
+	Token  string
+	HTTP   *http.Client
+}
+
+func New(server, token string) *Client {
+	return &Client{Server: strings.TrimSuffix(server, "/"), Token: token, HTTP: http.DefaultClient}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, p string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.Server + "/api" + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// checkResponse turns an error response into an *Error.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	var apiErr httputil.HTTPError
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(res.StatusCode)
+		}
+	}
+	return &Error{Status: res.StatusCode, Message: apiErr.Message}
+}
+
+func (c *Client) call(ctx context.Context, method, p string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, p, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+// Session returns the current session. The server extends the session on every call,
+// the extended token replaces Token.
+func (c *Client) Session(ctx context.Context) (*schemas.Session, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/auth/session", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(&http.Cookie{Name: "user-session", Value: c.Token})
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := checkResponse(res); err != nil {
+		return nil, err
+	}
+
+	session := &schemas.Session{}
+	if err := json.NewDecoder(res.Body).Decode(session); err != nil || session.Hash == "" {
+		return nil, errors.New("session expired, log in again")
+	}
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "user-session" && cookie.Value != "" {
+			c.Token = cookie.Value
+		}
+	}
+	return session, nil
+}
+
+// List returns a page of the files matching query.
+func (c *Client) List(ctx context.Context, query *schemas.FileQuery) (*schemas.FileResponse, error) {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("op", query.Op)
+	set("path", query.Path)
+	set("name", query.Name)
+	set("search", query.Search)
+	set("type", query.Type)
+	set("sort", query.Sort)
+	set("order", query.Order)
+	set("nextPageToken", query.NextPageToken)
+	if query.PerPage > 0 {
+		values.Set("perPage", fmt.Sprint(query.PerPage))
+	}
+
+	res := &schemas.FileResponse{}
+	if err := c.call(ctx, http.MethodGet, "/files", values, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Stat returns the file or folder at a path, ErrNotFound if there is none.
+func (c *Client) Stat(ctx context.Context, p string) (*schemas.FileOut, error) {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return &schemas.FileOut{Name: "/", Type: "folder", Path: "/"}, nil
+	}
+
+	dir, name := path.Split(p)
+	res, err := c.List(ctx, &schemas.FileQuery{Op: "find", Path: path.Clean(dir), Name: name, PerPage: 1})
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(res.Files) == 0 {
+		return nil, ErrNotFound
+	}
+	file := &res.Files[0]
+	if file.Path == "" || file.Type == "file" {
+		file.Path = p
+	}
+	return file, nil
+}
+
+func (c *Client) File(ctx context.Context, id string) (*schemas.FileOutFull, error) {
+	file := &schemas.FileOutFull{}
+	if err := c.call(ctx, http.MethodGet, "/files/"+id, nil, nil, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (c *Client) MakeDirectory(ctx context.Context, p string) error {
+	return c.call(ctx, http.MethodPost, "/files/directories", nil, &schemas.MkDir{Path: p}, nil)
+}
+
+func (c *Client) Move(ctx context.Context, ids []string, destination string) error {
+	return c.call(ctx, http.MethodPost, "/files/move", nil,
+		&schemas.FileOperation{Files: ids, Destination: destination}, nil)
+}
+
+func (c *Client) MoveDirectory(ctx context.Context, source, destination string) error {
+	return c.call(ctx, http.MethodPost, "/files/directories/move", nil,
+		&schemas.DirMove{Source: source, Destination: destination}, nil)
+}
+
+func (c *Client) Update(ctx context.Context, id string, update *schemas.FileUpdate) (*schemas.FileOut, error) {
+	out := &schemas.FileOut{}
+	if err := c.call(ctx, http.MethodPatch, "/files/"+id, nil, update, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) Copy(ctx context.Context, id, name, destination string) (*schemas.FileOut, error) {
+	out := &schemas.FileOut{}
+	if err := c.call(ctx, http.MethodPost, "/files/copy", nil,
+		&schemas.Copy{ID: id, Name: name, Destination: destination}, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) Delete(ctx context.Context, ids []string) error {
+	return c.call(ctx, http.MethodPost, "/files/delete", nil, &schemas.FileOperation{Files: ids}, nil)
+}
+
+func (c *Client) CreateFile(ctx context.Context, file *schemas.FileIn) (*schemas.FileOut, error) {
+	out := &schemas.FileOut{}
+	if err := c.call(ctx, http.MethodPost, "/files", nil, file, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploadedParts returns the parts uploaded for an upload so far.
+func (c *Client) UploadedParts(ctx context.Context, uploadId string) ([]schemas.UploadPartOut, error) {
+	out := &schemas.UploadOut{}
+	if err := c.call(ctx, http.MethodGet, "/uploads/"+uploadId, nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out.Parts, nil
+}
+
+// UploadPart sends size bytes of body as a part of an upload.
+func (c *Client) UploadPart(ctx context.Context, uploadId string, query *schemas.UploadQuery,
+	body io.Reader, size int64) (*schemas.UploadPartOut, error) {
+	values := url.Values{}
+	values.Set("partName", query.PartName)
+	values.Set("fileName", query.FileName)
+	values.Set("partNo", fmt.Sprint(query.PartNo))
+	values.Set("encrypted", fmt.Sprint(query.Encrypted))
+	if query.ChannelID != 0 {
+		values.Set("channelId", fmt.Sprint(query.ChannelID))
+	}
+	if query.Path != "" {
+		values.Set("path", query.Path)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/uploads/"+uploadId, values, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	out := &schemas.UploadPartOut{}
+	if err := c.do(req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) DeleteUpload(ctx context.Context, uploadId string) error {
+	return c.call(ctx, http.MethodDelete, "/uploads/"+uploadId, nil, nil, nil)
+}
+
+// streamURL returns the URL the content of a file is read from.
+func (c *Client) streamURL(file *schemas.FileOut, hash string) string {
+	return fmt.Sprintf("%s/api/files/%s/stream/%s?hash=%s", c.Server, file.ID,
+		url.PathEscape(file.Name), url.QueryEscape(hash))
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Config is the server and token the client commands use, stored by client login.
+type Config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// ConfigPath returns the default location of the stored config.
+func ConfigPath() string {
+	home, _ := homedir.Dir()
+	return filepath.Join(home, ".teldrive", "client.json")
+}
+
+// LoadConfig reads the stored config, a missing file is an empty config.
+func LoadConfig(file string) (*Config, error) {
+	config := &Config{}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Save stores the config readable by the current user only, it holds a session token.
+func (c *Config) Save(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
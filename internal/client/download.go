@@ -0,0 +1,313 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/schemas"
+)
+
+var ErrFileChanged = errors.New("file changed on the server during the download")
+
+// DownloadOptions control how a file is read from the server.
+type DownloadOptions struct {
+	// Start and End are the first and the last byte to read, End is the last byte of the
+	// file when it is negative.
+	Start, End int64
+	// Concurrency is the number of chunks read at once.
+	Concurrency int
+	ChunkSize   int64
+	Retries     int
+	// Progress reports the transfer, it may be nil.
+	Progress io.Writer
+}
+
+// downloadState is stored next to an unfinished download so that it can be resumed.
+// The chunks are only reused for the same version of the file and the same range.
+type downloadState struct {
+	ID        string    `json:"id"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ETag      string    `json:"etag"`
+	Start     int64     `json:"start"`
+	End       int64     `json:"end"`
+	ChunkSize int64     `json:"chunkSize"`
+	Done      []bool    `json:"done"`
+}
+
+func (s *downloadState) matches(other *downloadState) bool {
+	return s.ID == other.ID && s.Size == other.Size && s.UpdatedAt.Equal(other.UpdatedAt) &&
+		s.Start == other.Start && s.End == other.End && s.ChunkSize == other.ChunkSize &&
+		len(s.Done) == len(other.Done)
+}
+
+func (s *downloadState) save(file string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0600)
+}
+
+func (opts *DownloadOptions) bounds(size int64) (int64, int64, error) {
+	end := opts.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	if opts.Start < 0 || (size > 0 && opts.Start > end) {
+		return 0, 0, fmt.Errorf("range %d-%d is outside the file of %d bytes", opts.Start, opts.End, size)
+	}
+	return opts.Start, end, nil
+}
+
+// Download writes the content of a file to dest. The chunks are read in parallel into
+// dest.part and the chunks that are done are recorded in dest.part.json, an interrupted
+// download continues where it stopped when it is started again. dest.part is renamed to
+// dest when all chunks are done.
+func (c *Client) Download(ctx context.Context, file *schemas.FileOut, dest string, opts *DownloadOptions) error {
+	start, end, err := opts.bounds(file.Size)
+	if err != nil {
+		return err
+	}
+
+	partFile, stateFile := dest+".part", dest+".part.json"
+
+	session, err := c.Session(ctx)
+	if err != nil {
+		return err
+	}
+	streamURL := c.streamURL(file, session.Hash)
+
+	length := end - start + 1
+	chunkSize := max(opts.ChunkSize, 1)
+	chunks := int((length + chunkSize - 1) / chunkSize)
+
+	state := &downloadState{ID: file.ID, Size: file.Size, UpdatedAt: file.UpdatedAt, Start: start, End: end,
+		ChunkSize: chunkSize, Done: make([]bool, chunks)}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if data, err := os.ReadFile(stateFile); err == nil {
+		previous := &downloadState{}
+		if json.Unmarshal(data, previous) == nil && previous.matches(state) {
+			state = previous
+			flags = os.O_CREATE | os.O_WRONLY
+		}
+	}
+
+	out, err := os.OpenFile(partFile, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := out.Truncate(max(length, 0)); err != nil {
+		return err
+	}
+
+	progress := NewProgress(opts.Progress, file.Name, max(length, 0))
+	defer progress.Stop()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	readChunk := func(i int) error {
+		from := start + int64(i)*chunkSize
+		to := min(from+chunkSize-1, end)
+
+		mu.Lock()
+		etag := state.ETag
+		mu.Unlock()
+
+		etag, err := c.readChunk(ctx, streamURL, etag, from, to,
+			io.NewOffsetWriter(out, from-start), progress, opts.Retries)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if state.ETag == "" {
+			state.ETag = etag
+		}
+		state.Done[i] = true
+		return state.save(stateFile)
+	}
+
+	pending := []int{}
+	for i := range chunks {
+		if state.Done[i] {
+			progress.Add(min(chunkSize, length-int64(i)*chunkSize))
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	// The first chunk is read on its own so that the others are requested with its ETag
+	// and fail instead of mixing two versions of the file.
+	if state.ETag == "" && len(pending) > 0 {
+		if err := readChunk(pending[0]); err != nil {
+			return err
+		}
+		pending = pending[1:]
+	}
+
+	work := make(chan int)
+
+	for range max(opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if err := readChunk(i); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, i := range pending {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partFile, dest); err != nil {
+		return err
+	}
+	os.Remove(stateFile)
+
+	return os.Chtimes(dest, file.UpdatedAt, file.UpdatedAt)
+}
+
+// readChunk copies the bytes from to to of the stream to w, retrying failed requests. A
+// partly written chunk is written again from its start on a retry.
+func (c *Client) readChunk(ctx context.Context, streamURL, etag string, from, to int64,
+	w io.WriterAt, progress *Progress, retries int) (string, error) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+
+		var (
+			res     *http.Response
+			written int64
+		)
+		res, err = c.openRange(ctx, streamURL, etag, from, to)
+		if err != nil {
+			if errors.Is(err, ErrFileChanged) || ctx.Err() != nil {
+				return "", err
+			}
+			continue
+		}
+		written, err = io.Copy(io.MultiWriter(io.NewOffsetWriter(w, 0), progress), res.Body)
+		res.Body.Close()
+		if err == nil && written != to-from+1 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return res.Header.Get("ETag"), nil
+		}
+		progress.Add(-written)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+	return "", err
+}
+
+func (c *Client) openRange(ctx context.Context, streamURL, etag string, from, to int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	if etag != "" {
+		req.Header.Set("If-Range", etag)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK && etag != "" {
+		res.Body.Close()
+		return nil, ErrFileChanged
+	}
+	if err := checkResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, fmt.Errorf("server did not return a range: %s", res.Status)
+	}
+	return res, nil
+}
+
+// Stream writes the content of a file to w in a single request.
+func (c *Client) Stream(ctx context.Context, file *schemas.FileOut, w io.Writer, opts *DownloadOptions) error {
+	start, end, err := opts.bounds(file.Size)
+	if err != nil || file.Size == 0 {
+		return err
+	}
+
+	session, err := c.Session(ctx)
+	if err != nil {
+		return err
+	}
+
+	progress := NewProgress(opts.Progress, file.Name, end-start+1)
+	defer progress.Stop()
+
+	res, err := c.openRange(ctx, c.streamURL(file, session.Hash), "", start, end)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(io.MultiWriter(w, progress), res.Body)
+	return err
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStreamServer(data []byte, etag string, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/session" {
+			json.NewEncoder(w).Encode(schemas.Session{Hash: "hash"})
+			return
+		}
+		if strings.Contains(r.URL.Path, "/stream/") {
+			requests.Add(1)
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var requests atomic.Int32
+	srv := newStreamServer(data, `"v1"`, &requests)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	file := &schemas.FileOut{ID: "1", Name: "file", Size: int64(len(data))}
+
+	c := New(srv.URL, "token")
+
+	err := c.Download(context.Background(), file, dest, &DownloadOptions{End: -1, Concurrency: 3, ChunkSize: 999})
+	assert.NoError(t, err)
+
+	got, _ := os.ReadFile(dest)
+	assert.Equal(t, data, got)
+	assert.Equal(t, int32(11), requests.Load())
+
+	err = c.Download(context.Background(), file, dest, &DownloadOptions{Start: 5, End: 24, Concurrency: 2, ChunkSize: 7})
+	assert.NoError(t, err)
+
+	got, _ = os.ReadFile(dest)
+	assert.Equal(t, data[5:25], got)
+}
+
+func TestDownloadResume(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefghij"), 100)
+
+	var requests atomic.Int32
+	srv := newStreamServer(data, `"v1"`, &requests)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	file := &schemas.FileOut{ID: "1", Name: "file", Size: int64(len(data))}
+
+	partial := append(data[:500:500], make([]byte, 500)...)
+	assert.NoError(t, os.WriteFile(dest+".part", partial, 0644))
+
+	state := &downloadState{ID: "1", Size: 1000, Start: 0, End: 999, ChunkSize: 100, ETag: `"v1"`,
+		Done: []bool{true, true, true, true, true, false, false, false, false, false}}
+	assert.NoError(t, state.save(dest+".part.json"))
+
+	err := New(srv.URL, "token").Download(context.Background(), file, dest,
+		&DownloadOptions{End: -1, Concurrency: 2, ChunkSize: 100})
+	assert.NoError(t, err)
+
+	got, _ := os.ReadFile(dest)
+	assert.Equal(t, data, got)
+	assert.Equal(t, int32(5), requests.Load())
+	assert.NoFileExists(t, dest+".part.json")
+}
+
+func TestDownloadChanged(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefghij"), 100)
+
+	var requests atomic.Int32
+	srv := newStreamServer(data, `"v2"`, &requests)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file")
+	file := &schemas.FileOut{ID: "1", Name: "file", Size: int64(len(data))}
+
+	state := &downloadState{ID: "1", Size: 1000, Start: 0, End: 999, ChunkSize: 500, ETag: `"v1"`,
+		Done: []bool{true, false}}
+	assert.NoError(t, state.save(dest+".part.json"))
+
+	err := New(srv.URL, "token").Download(context.Background(), file, dest,
+		&DownloadOptions{End: -1, Concurrency: 1, ChunkSize: 500})
+	assert.ErrorIs(t, err, ErrFileChanged)
+}
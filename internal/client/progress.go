@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress counts the bytes written to it and reports them on a terminal line until it
+// is stopped. A Progress without output only counts.
+type Progress struct {
+	name  string
+	total int64
+	done  atomic.Int64
+	start time.Time
+	out   io.Writer
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewProgress starts reporting the transfer of total bytes of name to out, out may be nil.
+func NewProgress(out io.Writer, name string, total int64) *Progress {
+	p := &Progress{name: name, total: total, start: time.Now(), out: out, stop: make(chan struct{})}
+	if out != nil {
+		p.wg.Add(1)
+		go p.run()
+	}
+	return p
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	p.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Add counts n bytes that were transferred earlier, such as the parts of a resumed transfer.
+func (p *Progress) Add(n int64) {
+	p.done.Add(n)
+}
+
+func (p *Progress) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.print("\r")
+		case <-p.stop:
+			p.print("\r")
+			fmt.Fprintln(p.out)
+			return
+		}
+	}
+}
+
+func (p *Progress) print(prefix string) {
+	done := p.done.Load()
+	elapsed := time.Since(p.start).Seconds()
+	speed := int64(0)
+	if elapsed > 0 {
+		speed = int64(float64(done) / elapsed)
+	}
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(done) * 100 / float64(p.total)
+	}
+	fmt.Fprintf(p.out, "%s%s  %s / %s  %5.1f%%  %s/s   ", prefix, p.name, FormatSize(done),
+		FormatSize(p.total), percent, FormatSize(speed))
+}
+
+// Stop prints the final state of the transfer.
+func (p *Progress) Stop() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.wg.Wait()
+}
+
+// FormatSize returns a size in binary units.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
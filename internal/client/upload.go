@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/pkg/schemas"
+)
+
+// UploadOptions control how a file is sent to the server.
+type UploadOptions struct {
+	PartSize int64
+	// Concurrency is the number of parts sent at once. The server only computes the
+	// checksums of the whole file when the parts arrive in order, with one part at a time.
+	Concurrency int
+	ChannelID   int64
+	Encrypted   bool
+	Retries     int
+	// Progress reports the transfer, it may be nil.
+	Progress io.Writer
+}
+
+// Upload stores the local file src as the file at dest. The file is sent in parts to
+// /uploads/:id and created from them with POST /files. The upload ID is derived from
+// dest and the size and modification time of src, parts that were sent by an earlier,
+// interrupted upload of the same file are not sent again.
+func (c *Client) Upload(ctx context.Context, src, dest string, opts *UploadOptions) (*schemas.FileOut, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	dest = path.Clean("/" + dest)
+	dir, name := path.Split(dest)
+	dir = path.Clean(dir)
+
+	if dir != "/" {
+		if err := c.MakeDirectory(ctx, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	size := info.Size()
+	partSize := max(opts.PartSize, 1)
+	totalParts := max(int((size+partSize-1)/partSize), 1)
+
+	uploadId := md5.FromString(fmt.Sprintf("%s:%d:%d:%t", dest, size, info.ModTime().UnixNano(), opts.Encrypted))
+
+	uploaded, err := c.UploadedParts(ctx, uploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*schemas.UploadPartOut, totalParts)
+	for i := range uploaded {
+		part := &uploaded[i]
+		if part.PartNo >= 1 && part.PartNo <= totalParts &&
+			part.Size == min(partSize, size-int64(part.PartNo-1)*partSize) {
+			parts[part.PartNo-1] = part
+		}
+	}
+
+	progress := NewProgress(opts.Progress, name, size)
+	defer progress.Stop()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+
+	for range max(opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				offset := int64(i) * partSize
+				length := min(partSize, size-offset)
+				query := &schemas.UploadQuery{
+					PartName:  partName(name, i+1, totalParts),
+					FileName:  name,
+					PartNo:    i + 1,
+					ChannelID: opts.ChannelID,
+					Encrypted: opts.Encrypted,
+					Path:      dir,
+				}
+				part, err := c.uploadPart(ctx, uploadId, query, io.NewSectionReader(f, offset, length),
+					progress, opts.Retries)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				parts[i] = part
+				mu.Unlock()
+
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i, part := range parts {
+		if part != nil {
+			progress.Add(part.Size)
+			continue
+		}
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file := &schemas.FileIn{
+		Name:      name,
+		Type:      "file",
+		MimeType:  mimeTypeByName(name),
+		Path:      dir,
+		Size:      size,
+		ChannelID: opts.ChannelID,
+		Encrypted: opts.Encrypted,
+	}
+	for _, part := range parts {
+		file.Parts = append(file.Parts, schemas.Part{ID: int64(part.PartId), Salt: part.Salt, KeyID: part.KeyID})
+		file.ChannelID = part.ChannelID
+	}
+
+	out, err := c.CreateFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	c.DeleteUpload(ctx, uploadId)
+
+	return out, nil
+}
+
+// uploadPart sends a part, retrying failed requests from the start of the part.
+func (c *Client) uploadPart(ctx context.Context, uploadId string, query *schemas.UploadQuery,
+	r *io.SectionReader, progress *Progress, retries int) (*schemas.UploadPartOut, error) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		counter := &countingReader{r: io.NewSectionReader(r, 0, r.Size()), progress: progress}
+
+		var part *schemas.UploadPartOut
+		part, err = c.UploadPart(ctx, uploadId, query, counter, r.Size())
+		if err == nil {
+			return part, nil
+		}
+		progress.Add(-counter.n)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	progress *Progress
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.progress.Add(int64(n))
+	return n, err
+}
+
+// partName names the parts like the server does for its own uploads.
+func partName(fileName string, partNo, totalParts int) string {
+	if totalParts > 1 {
+		return fmt.Sprintf("%s.part.%03d", fileName, partNo)
+	}
+	return fileName
+}
+
+func mimeTypeByName(name string) string {
+	if mimeType := mime.TypeByExtension(path.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
@@ -5,11 +5,18 @@ import (
 )
 
 type Config struct {
-	Server ServerConfig
-	Log    LoggingConfig
-	JWT    JWTConfig
-	DB     DBConfig
-	TG     TGConfig
+	Server     ServerConfig
+	Log        LoggingConfig
+	JWT        JWTConfig
+	DB         DBConfig
+	TG         TGConfig
+	S3         S3Config
+	Trash      TrashConfig
+	Versions   VersionsConfig
+	Thumbnails ThumbnailsConfig
+	Orphans    OrphansConfig
+	Channels   ChannelsConfig
+	Quota      QuotaConfig
 }
 
 type ServerConfig struct {
@@ -17,6 +24,42 @@ type ServerConfig struct {
 	GracefulShutdown time.Duration
 }
 
+type TrashConfig struct {
+	Retention time.Duration
+}
+
+type VersionsConfig struct {
+	Keep      int
+	Retention time.Duration
+}
+
+type ThumbnailsConfig struct {
+	Size        int
+	MaxFileSize int64
+	Workers     int
+}
+
+type OrphansConfig struct {
+	Interval    time.Duration
+	Delete      bool
+	GracePeriod time.Duration
+}
+
+type ChannelsConfig struct {
+	RolloverMessages int64
+	RolloverSize     int64
+}
+
+type QuotaConfig struct {
+	Size  int64
+	Files int64
+}
+
+type S3Config struct {
+	Enable bool
+	Port   int
+}
+
 type TGConfig struct {
 	AppId             int
 	AppHash           string
@@ -32,10 +75,22 @@ type TGConfig struct {
 	SessionFile       string
 	BgBotsLimit       int
 	DisableStreamBots bool
-	Uploads           struct {
-		EncryptionKey string
-		Threads       int
-		Retention     time.Duration
+	Stream            struct {
+		Concurrency int
+		BufferSize  int64
+		MultiBots   bool
+		CacheDir    string
+		CacheSize   int64
+		CacheWrites int
+	}
+	Uploads struct {
+		EncryptionKey    string
+		Threads          int
+		Retention        time.Duration
+		PartSize         int64
+		BufferDir        string
+		KeyRotationBatch int
+		EncryptNames     bool
 	}
 }
 
@@ -49,6 +104,7 @@ type JWTConfig struct {
 	Secret       string
 	SessionTime  time.Duration
 	AllowedUsers []string
+	AdminUsers   []string
 }
 
 type DBConfig struct {
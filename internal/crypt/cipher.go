@@ -62,11 +62,13 @@ type Cipher struct {
 	block      gocipher.Block
 	buffers    sync.Pool
 	cryptoRand io.Reader
+	magic      []byte
 }
 
 func NewCipher(password, salt string) (*Cipher, error) {
 	c := &Cipher{
 		cryptoRand: rand.Reader,
+		magic:      fileMagicBytes,
 	}
 	c.buffers.New = func() interface{} {
 		return new([blockSize]byte)
@@ -94,6 +96,11 @@ func (c *Cipher) Key(password, salt string) (err error) {
 	return err
 }
 
+// headerSize is the size of the magic and the nonce every encrypted file starts with.
+func (c *Cipher) headerSize() int {
+	return len(c.magic) + fileNonceSize
+}
+
 func (c *Cipher) getBlock() *[blockSize]byte {
 	return c.buffers.Get().(*[blockSize]byte)
 }
@@ -174,7 +181,7 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 		c:       c,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
-		bufSize: fileHeaderSize,
+		bufSize: c.headerSize(),
 	}
 
 	if nonce != nil {
@@ -186,9 +193,9 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 		}
 	}
 
-	copy((*fh.buf)[:], fileMagicBytes)
+	copy((*fh.buf)[:], c.magic)
 
-	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
+	copy((*fh.buf)[len(c.magic):], fh.nonce[:])
 	return fh, nil
 }
 
@@ -261,20 +268,20 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 		limit:   -1,
 	}
 
-	readBuf := (*fh.readBuf)[:fileHeaderSize]
+	readBuf := (*fh.readBuf)[:c.headerSize()]
 	n, err := readFill(fh.rc, readBuf)
-	if n < fileHeaderSize && err == io.EOF {
+	if n < c.headerSize() && err == io.EOF {
 
 		return nil, fh.finishAndClose(ErrorEncryptedFileTooShort)
 	} else if err != io.EOF && err != nil {
 		return nil, fh.finishAndClose(err)
 	}
 
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
+	if !bytes.Equal(readBuf[:len(c.magic)], c.magic) {
 		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
 	}
 
-	err = fh.nonce.fromBuf(readBuf[fileMagicSize:])
+	err = fh.nonce.fromBuf(readBuf[len(c.magic):])
 	if err != nil {
 		return nil, err
 	}
@@ -292,12 +299,12 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		rc, err = open(ctx, 0, -1)
 	} else if offset == 0 {
 
-		_, underlyingLimit, _, _ := calculateUnderlying(offset, limit)
-		rc, err = open(ctx, 0, int64(fileHeaderSize)+underlyingLimit)
+		_, underlyingLimit, _, _ := c.calculateUnderlying(offset, limit)
+		rc, err = open(ctx, 0, int64(c.headerSize())+underlyingLimit)
 		setLimit = true
 	} else {
 
-		rc, err = open(ctx, 0, int64(fileHeaderSize))
+		rc, err = open(ctx, 0, int64(c.headerSize()))
 		doRangeSeek = true
 	}
 	if err != nil {
@@ -381,11 +388,11 @@ func (fh *decrypter) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
-func calculateUnderlying(offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
+func (c *Cipher) calculateUnderlying(offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
 
 	blocks, discard = offset/blockDataSize, offset%blockDataSize
 
-	underlyingOffset = int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	underlyingOffset = int64(c.headerSize()) + blocks*(blockHeaderSize+blockDataSize)
 
 	underlyingLimit = int64(-1)
 	if limit >= 0 {
@@ -426,7 +433,7 @@ func (fh *decrypter) RangeSeek(ctx context.Context, offset int64, whence int, li
 		return 0, fh.err
 	}
 
-	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(offset, limit)
+	underlyingOffset, underlyingLimit, discard, blocks := fh.c.calculateUnderlying(offset, limit)
 
 	fh.nonce = fh.initialNonce
 	fh.nonce.add(uint64(blocks))
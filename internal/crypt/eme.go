@@ -0,0 +1,98 @@
+package crypt
+
+import gocipher "crypto/cipher"
+
+// EME (ECB-Mix-ECB) is the wide block mode rclone crypt encrypts names with. It turns
+// a block cipher into a tweakable cipher over 1 to 128 blocks, so equal names encrypt
+// to equal ciphertexts while a change anywhere in a name changes all of it.
+// See https://eprint.iacr.org/2003/147.
+
+type emeDirection bool
+
+const (
+	emeEncrypt emeDirection = true
+	emeDecrypt emeDirection = false
+)
+
+func multByTwo(out, in []byte) {
+	var tmp [16]byte
+	tmp[0] = 2 * in[0]
+	if in[15] >= 128 {
+		tmp[0] ^= 135
+	}
+	for j := 1; j < 16; j++ {
+		tmp[j] = 2 * in[j]
+		if in[j-1] >= 128 {
+			tmp[j]++
+		}
+	}
+	copy(out, tmp[:])
+}
+
+func xorBlocks(out, in1, in2 []byte) {
+	for i := range in1 {
+		out[i] = in1[i] ^ in2[i]
+	}
+}
+
+func emeBlock(dst, src []byte, direction emeDirection, bc gocipher.Block) {
+	if direction == emeEncrypt {
+		bc.Encrypt(dst, src)
+	} else {
+		bc.Decrypt(dst, src)
+	}
+}
+
+func tabulateL(bc gocipher.Block, m int) [][]byte {
+	li := make([]byte, 16)
+	bc.Encrypt(li, make([]byte, 16))
+	table := make([][]byte, m)
+	for i := range table {
+		multByTwo(li, li)
+		table[i] = append([]byte{}, li...)
+	}
+	return table
+}
+
+// emeTransform encrypts or decrypts data, a multiple of 16 bytes of at most 128 blocks,
+// with the 16 byte tweak.
+func emeTransform(bc gocipher.Block, tweak, data []byte, direction emeDirection) []byte {
+	m := len(data) / 16
+	out := make([]byte, len(data))
+	lTable := tabulateL(bc, m)
+
+	ppj := make([]byte, 16)
+	for j := 0; j < m; j++ {
+		xorBlocks(ppj, data[j*16:(j+1)*16], lTable[j])
+		emeBlock(out[j*16:(j+1)*16], ppj, direction, bc)
+	}
+
+	mp := make([]byte, 16)
+	xorBlocks(mp, out[0:16], tweak)
+	for j := 1; j < m; j++ {
+		xorBlocks(mp, mp, out[j*16:(j+1)*16])
+	}
+
+	mc := make([]byte, 16)
+	emeBlock(mc, mp, direction, bc)
+
+	mm := make([]byte, 16)
+	xorBlocks(mm, mp, mc)
+	for j := 1; j < m; j++ {
+		multByTwo(mm, mm)
+		xorBlocks(out[j*16:(j+1)*16], out[j*16:(j+1)*16], mm)
+	}
+
+	ccc1 := make([]byte, 16)
+	xorBlocks(ccc1, mc, tweak)
+	for j := 1; j < m; j++ {
+		xorBlocks(ccc1, ccc1, out[j*16:(j+1)*16])
+	}
+	copy(out[0:16], ccc1)
+
+	for j := 0; j < m; j++ {
+		emeBlock(out[j*16:(j+1)*16], out[j*16:(j+1)*16], direction, bc)
+		xorBlocks(out[j*16:(j+1)*16], out[j*16:(j+1)*16], lTable[j])
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const wrapSalt = "teldrive key wrap"
+
+var ErrorBadWrappedKey = errors.New("wrapped key can't be opened with this master key")
+
+// wrapKeys caches the key derived from each master key, scrypt is slow on purpose.
+var wrapKeys sync.Map
+
+func wrapKey(master string) (*[32]byte, error) {
+	if key, ok := wrapKeys.Load(master); ok {
+		return key.(*[32]byte), nil
+	}
+	derived, err := scrypt.Key([]byte(master), []byte(wrapSalt), 16384, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	key := new([32]byte)
+	copy(key[:], derived)
+	wrapKeys.Store(master, key)
+	return key, nil
+}
+
+// NewDataKey returns a random key to be used as the password of a Cipher.
+func NewDataKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// WrapKey seals key with master so that it can be stored in the database.
+func WrapKey(master, key string) (string, error) {
+	k, err := wrapKey(master)
+	if err != nil {
+		return "", err
+	}
+
+	var n nonce
+	if err := n.fromReader(rand.Reader); err != nil {
+		return "", err
+	}
+
+	sealed := secretbox.Seal(n[:], []byte(key), n.pointer(), k)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// UnwrapKey opens a key sealed by WrapKey.
+func UnwrapKey(master, wrapped string) (string, error) {
+	k, err := wrapKey(master)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(sealed) < fileNonceSize {
+		return "", ErrorBadWrappedKey
+	}
+
+	var n nonce
+	if err := n.fromBuf(sealed[:fileNonceSize]); err != nil {
+		return "", err
+	}
+
+	key, ok := secretbox.Open(nil, sealed[fileNonceSize:], n.pointer(), k)
+	if !ok {
+		return "", ErrorBadWrappedKey
+	}
+	return string(key), nil
+}
@@ -0,0 +1,26 @@
+package crypt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapKey(t *testing.T) {
+	key, err := NewDataKey()
+	assert.NoError(t, err)
+
+	wrapped, err := WrapKey("master", key)
+	assert.NoError(t, err)
+	assert.NotContains(t, wrapped, key)
+
+	unwrapped, err := UnwrapKey("master", wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+
+	_, err = UnwrapKey("other", wrapped)
+	assert.ErrorIs(t, err, ErrorBadWrappedKey)
+
+	_, err = UnwrapKey("master", "short")
+	assert.ErrorIs(t, err, ErrorBadWrappedKey)
+}
@@ -0,0 +1,99 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+// emeMaxBlocks is the longest input EME accepts, names up to 2047 bytes fit.
+const emeMaxBlocks = 128
+
+var (
+	ErrorBadEncryptedName = errors.New("bad encrypted name")
+	ErrorNameTooLong      = errors.New("name too long to encrypt")
+)
+
+// EncryptName encrypts a single file or folder name the way rclone crypt does in its
+// standard mode: the name is padded to the AES block size, encrypted with EME under the
+// name key and tweak, and encoded as lower case base32hex without padding. Encryption is
+// deterministic, so encrypted names can still be looked up and kept unique.
+func (c *Cipher) EncryptName(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	padding := nameCipherBlockSize - len(name)%nameCipherBlockSize
+	padded := append([]byte(name), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	if len(padded)/nameCipherBlockSize > emeMaxBlocks {
+		return "", ErrorNameTooLong
+	}
+
+	ciphertext := emeTransform(c.block, c.nameTweak[:], padded, emeEncrypt)
+
+	return strings.ToLower(strings.TrimRight(base32.HexEncoding.EncodeToString(ciphertext), "=")), nil
+}
+
+// DecryptName reverses EncryptName.
+func (c *Cipher) DecryptName(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	encoded := strings.ToUpper(name)
+	if rem := len(encoded) % 8; rem != 0 {
+		encoded += strings.Repeat("=", 8-rem)
+	}
+
+	ciphertext, err := base32.HexEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrorBadEncryptedName
+	}
+
+	if len(ciphertext) == 0 || len(ciphertext)%nameCipherBlockSize != 0 ||
+		len(ciphertext)/nameCipherBlockSize > emeMaxBlocks {
+		return "", ErrorBadEncryptedName
+	}
+
+	padded := emeTransform(c.block, c.nameTweak[:], ciphertext, emeDecrypt)
+
+	padding := int(padded[len(padded)-1])
+	if padding == 0 || padding > nameCipherBlockSize {
+		return "", ErrorBadEncryptedName
+	}
+	for _, b := range padded[len(padded)-padding:] {
+		if int(b) != padding {
+			return "", ErrorBadEncryptedName
+		}
+	}
+
+	return string(padded[:len(padded)-padding]), nil
+}
+
+// EncryptPath encrypts every segment of a slash separated path.
+func (c *Cipher) EncryptPath(path string) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		encrypted, err := c.EncryptName(segment)
+		if err != nil {
+			return "", err
+		}
+		segments[i] = encrypted
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// DecryptPath reverses EncryptPath.
+func (c *Cipher) DecryptPath(path string) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		decrypted, err := c.DecryptName(segment)
+		if err != nil {
+			return "", err
+		}
+		segments[i] = decrypted
+	}
+	return strings.Join(segments, "/"), nil
+}
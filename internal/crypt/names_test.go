@@ -0,0 +1,61 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zeroKeyCipher has the all zero keys rclone crypt uses for an empty password, which
+// its name encryption test vectors are generated with.
+func zeroKeyCipher(t *testing.T) *Cipher {
+	c := &Cipher{}
+	block, err := aes.NewCipher(c.nameKey[:])
+	assert.NoError(t, err)
+	c.block = block
+	return c
+}
+
+func TestEncryptNameRcloneVectors(t *testing.T) {
+	c := zeroKeyCipher(t)
+
+	for _, test := range []struct{ in, want string }{
+		{"1", "p0e52nreeaj0a5ea7s64m4j72s"},
+		{"12", "l42g6771hnv3an9cgc8cr2n1ng"},
+		{"123", "qgm4avr35m5loi1th53ato71v0"},
+	} {
+		got, err := c.EncryptName(test.in)
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, got)
+
+		plain, err := c.DecryptName(got)
+		assert.NoError(t, err)
+		assert.Equal(t, test.in, plain)
+	}
+}
+
+func TestEncryptPath(t *testing.T) {
+	c, err := NewCipher("password", "names")
+	assert.NoError(t, err)
+
+	for _, path := range []string{"/", "/docs", "/docs/a file.txt", "/" + strings.Repeat("x", 100)} {
+		encrypted, err := c.EncryptPath(path)
+		assert.NoError(t, err)
+		assert.Equal(t, strings.Count(path, "/"), strings.Count(encrypted, "/"))
+
+		again, _ := c.EncryptPath(path)
+		assert.Equal(t, encrypted, again)
+
+		decrypted, err := c.DecryptPath(encrypted)
+		assert.NoError(t, err)
+		assert.Equal(t, path, decrypted)
+	}
+
+	_, err = c.DecryptName("not encrypted")
+	assert.ErrorIs(t, err, ErrorBadEncryptedName)
+
+	_, err = c.EncryptName(strings.Repeat("x", 2048))
+	assert.ErrorIs(t, err, ErrorNameTooLong)
+}
@@ -0,0 +1,112 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+)
+
+// rclone crypt uses the same blocks as teldrive, its files only start with another magic.
+const rcloneMagic = "RCLONE\x00\x00"
+
+// rcloneDefaultSalt is the salt rclone uses when no password2 is configured.
+var rcloneDefaultSalt = string([]byte{0xA8, 0x0D, 0xF4, 0x3A, 0x8F, 0xBD, 0x03, 0x08, 0xA7, 0xCA, 0xB8, 0x3E,
+	0x58, 0x1F, 0x86, 0xB1})
+
+var (
+	ErrorRcloneNameEncryption = errors.New("filename encryption must be standard or off")
+	ErrorRcloneNotEncrypted   = errors.New("not an rclone crypt file name")
+	ErrorRcloneNoPassword     = errors.New("rclone crypt password is required")
+)
+
+// Rclone reads and writes files and names of an rclone crypt remote.
+type Rclone struct {
+	*Cipher
+	// FilenameEncryption is standard, names are encrypted, or off, names get a .bin suffix.
+	FilenameEncryption string
+	// DirectoryNameEncryption encrypts folder names too in standard mode.
+	DirectoryNameEncryption bool
+}
+
+// NewRclone returns the rclone crypt remote with the given password and password2, both
+// in plain text as shown by rclone reveal.
+func NewRclone(password, salt, filenameEncryption string, directoryNameEncryption bool) (*Rclone, error) {
+	if filenameEncryption != "standard" && filenameEncryption != "off" {
+		return nil, ErrorRcloneNameEncryption
+	}
+
+	if password == "" {
+		return nil, ErrorRcloneNoPassword
+	}
+
+	if salt == "" {
+		salt = rcloneDefaultSalt
+	}
+
+	c := &Cipher{
+		cryptoRand: rand.Reader,
+		magic:      []byte(rcloneMagic),
+	}
+	c.buffers.New = func() interface{} {
+		return new([blockSize]byte)
+	}
+	if err := c.Key(password, salt); err != nil {
+		return nil, err
+	}
+
+	return &Rclone{Cipher: c, FilenameEncryption: filenameEncryption,
+		DirectoryNameEncryption: directoryNameEncryption}, nil
+}
+
+// EncryptedSize returns the size of a file of size bytes on the remote.
+func (r *Rclone) EncryptedSize(size int64) int64 {
+	return EncryptedSize(size) - int64(fileMagicSize-len(rcloneMagic))
+}
+
+// DecryptedSize returns the size of the content of a file of size bytes on the remote.
+func (r *Rclone) DecryptedSize(size int64) (int64, error) {
+	return DecryptedSize(size + int64(fileMagicSize-len(rcloneMagic)))
+}
+
+// EncodePath returns the name on the remote of the slash separated relative path of a
+// file, or of a folder when dir is set.
+func (r *Rclone) EncodePath(rel string, dir bool) (string, error) {
+	segments := strings.Split(rel, "/")
+	for i, segment := range segments {
+		leaf := i == len(segments)-1 && !dir
+		switch {
+		case r.FilenameEncryption == "off" && leaf:
+			segments[i] = segment + ".bin"
+		case r.FilenameEncryption == "standard" && (leaf || r.DirectoryNameEncryption):
+			encrypted, err := r.EncryptName(segment)
+			if err != nil {
+				return "", err
+			}
+			segments[i] = encrypted
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// DecodePath reverses EncodePath.
+func (r *Rclone) DecodePath(rel string, dir bool) (string, error) {
+	segments := strings.Split(rel, "/")
+	for i, segment := range segments {
+		leaf := i == len(segments)-1 && !dir
+		switch {
+		case r.FilenameEncryption == "off" && leaf:
+			name, ok := strings.CutSuffix(segment, ".bin")
+			if !ok {
+				return "", ErrorRcloneNotEncrypted
+			}
+			segments[i] = name
+		case r.FilenameEncryption == "standard" && (leaf || r.DirectoryNameEncryption):
+			decrypted, err := r.DecryptName(segment)
+			if err != nil {
+				return "", err
+			}
+			segments[i] = decrypted
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,76 @@
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRcloneData(t *testing.T) {
+	r, err := NewRclone("password", "", "standard", true)
+	assert.NoError(t, err)
+
+	data := bytes.Repeat([]byte("teldrive"), 20000)
+
+	rc, err := r.EncryptData(bytes.NewReader(data))
+	assert.NoError(t, err)
+	encrypted, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []byte(rcloneMagic), encrypted[:len(rcloneMagic)])
+	assert.Equal(t, r.EncryptedSize(int64(len(data))), int64(len(encrypted)))
+
+	size, err := r.DecryptedSize(int64(len(encrypted)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	dec, err := r.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+	assert.NoError(t, err)
+	decrypted, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decrypted)
+
+	c, err := NewCipher("password", rcloneDefaultSalt)
+	assert.NoError(t, err)
+	_, err = c.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+	assert.ErrorIs(t, err, ErrorEncryptedBadMagic)
+}
+
+func TestRclonePath(t *testing.T) {
+	for _, test := range []struct {
+		encryption string
+		dirNames   bool
+	}{{"standard", true}, {"standard", false}, {"off", false}} {
+		r, err := NewRclone("password", "salt", test.encryption, test.dirNames)
+		assert.NoError(t, err)
+
+		file, err := r.EncodePath("docs/notes/a.txt", false)
+		assert.NoError(t, err)
+		dir, err := r.EncodePath("docs/notes", true)
+		assert.NoError(t, err)
+		assert.Equal(t, dir, file[:len(dir)])
+
+		switch {
+		case test.encryption == "off":
+			assert.Equal(t, "docs/notes/a.txt.bin", file)
+		case !test.dirNames:
+			assert.Equal(t, "docs/notes", dir)
+			assert.NotContains(t, file, "a.txt")
+		default:
+			assert.NotContains(t, file, "docs")
+		}
+
+		plain, err := r.DecodePath(file, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "docs/notes/a.txt", plain)
+	}
+
+	_, err := NewRclone("password", "", "obfuscate", false)
+	assert.ErrorIs(t, err, ErrorRcloneNameEncryption)
+
+	r, _ := NewRclone("password", "", "off", false)
+	_, err = r.DecodePath("a.txt", false)
+	assert.ErrorIs(t, err, ErrorRcloneNotEncrypted)
+}
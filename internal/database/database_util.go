@@ -1,14 +1,12 @@
 package database
 
 import (
-	"database/sql"
 	"embed"
 	"errors"
 	"fmt"
 	"testing"
 	"time"
 
-	"github.com/pressly/goose/v3"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -68,15 +66,3 @@ func DeleteRecordAll(_ testing.TB, db *gorm.DB, tableWhereClauses []string) erro
 	}
 	return nil
 }
-
-func migrateDB(db *sql.DB) error {
-	goose.SetBaseFS(embedMigrations)
-
-	if err := goose.SetDialect("postgres"); err != nil {
-		return fmt.Errorf("failed run migrate: %w", err)
-	}
-	if err := goose.Up(db, "migrations"); err != nil {
-		return fmt.Errorf("failed run migrate: %w", err)
-	}
-	return nil
-}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// migrationLockID is the Postgres advisory lock held while migrations run, so that two
+// instances starting at the same time never migrate the database concurrently.
+const migrationLockID = 5887940537704921958
+
+// NewMigrator returns the embedded migrations of db. Every operation holds the migration
+// lock, waiting up to five minutes for another instance to release it.
+func NewMigrator(db *sql.DB) (*goose.Provider, error) {
+	migrations, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	locker, err := lock.NewPostgresSessionLocker(lock.WithLockID(migrationLockID))
+	if err != nil {
+		return nil, err
+	}
+
+	return goose.NewProvider(goose.DialectPostgres, db, migrations, goose.WithSessionLocker(locker))
+}
+
+// MigrationSQL returns the up or down statements of a migration as they are run.
+func MigrationSQL(source *goose.Source, up bool) (string, error) {
+	data, err := fs.ReadFile(embedMigrations, "migrations/"+source.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		b       strings.Builder
+		section string
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if annotation, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose "); ok {
+			switch strings.ToLower(strings.TrimSpace(annotation)) {
+			case "up":
+				section = "up"
+				continue
+			case "down":
+				section = "down"
+				continue
+			}
+		}
+		if (up && section == "up") || (!up && section == "down") {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", source.Path, err)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+func migrateDB(db *sql.DB) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("failed run migrate: %w", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return fmt.Errorf("failed run migrate: %w", err)
+	}
+	return nil
+}
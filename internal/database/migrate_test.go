@@ -0,0 +1,23 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrationSQL(t *testing.T) {
+	source := &goose.Source{Path: "20240614081127_encryption_keys.sql", Version: 20240614081127}
+
+	up, err := MigrationSQL(source, true)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(up, "-- +goose StatementBegin\nCREATE TABLE IF NOT EXISTS teldrive.encryption_keys"))
+	assert.NotContains(t, up, "DROP TABLE")
+
+	down, err := MigrationSQL(source, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "-- +goose StatementBegin\nALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS key_id;\n"+
+		"DROP TABLE IF EXISTS teldrive.encryption_keys;\n-- +goose StatementEnd", down)
+}
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.access_keys (
+	access_key_id text NOT NULL PRIMARY KEY,
+	secret_key text NOT NULL,
+	"name" text,
+	user_id bigint NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	FOREIGN KEY (user_id) REFERENCES teldrive.users(user_id)
+);
+CREATE INDEX IF NOT EXISTS access_keys_user_id_idx ON teldrive.access_keys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.access_keys;
+-- +goose StatementEnd
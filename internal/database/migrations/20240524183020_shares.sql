@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.shares (
+	id text NOT NULL PRIMARY KEY,
+	file_id text NOT NULL,
+	user_id bigint NOT NULL,
+	"password" text,
+	expires_at timestamp,
+	max_downloads int,
+	downloads int NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	FOREIGN KEY (file_id) REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES teldrive.users(user_id)
+);
+CREATE INDEX IF NOT EXISTS shares_user_id_file_id_idx ON teldrive.shares (user_id, file_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.shares;
+-- +goose StatementEnd
@@ -0,0 +1,109 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS trashed_at timestamp;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS trash_root_id text;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS trash_path text;
+CREATE INDEX IF NOT EXISTS files_trash_root_id_idx ON teldrive.files (trash_root_id);
+
+-- Trashed items are detached from their parent and trashed folders lose their path, so that
+-- path lookups and create_directories never resolve to them. The parent path is kept in
+-- trash_path of the trashed item and every row below it points to it through trash_root_id.
+CREATE OR REPLACE FUNCTION teldrive.trash_files(file_ids text[], u_id bigint)
+RETURNS VOID AS $$
+BEGIN
+    WITH RECURSIVE items AS (
+        SELECT id, id AS root_id
+        FROM teldrive.files
+        WHERE id = ANY(file_ids) AND user_id = u_id AND status = 'active' AND parent_id != 'root'
+        UNION ALL
+        SELECT f.id, i.root_id
+        FROM teldrive.files f
+        INNER JOIN items i ON f.parent_id = i.id
+        WHERE f.status = 'active'
+    )
+    UPDATE teldrive.files
+    SET status = 'trashed',
+        trashed_at = timezone('utc'::text, now()),
+        trash_root_id = items.root_id,
+        trash_path = CASE WHEN items.id = items.root_id
+            THEN (SELECT p.path FROM teldrive.files p WHERE p.id = teldrive.files.parent_id) END,
+        parent_id = CASE WHEN items.id = items.root_id THEN NULL ELSE teldrive.files.parent_id END,
+        path = CASE WHEN teldrive.files.type = 'folder' THEN NULL ELSE teldrive.files.path END
+    FROM items
+    WHERE teldrive.files.id = items.id;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION teldrive.restore_files(file_ids text[], u_id bigint)
+RETURNS VOID AS $$
+DECLARE
+    rec RECORD;
+    dest_id TEXT;
+BEGIN
+    FOR rec IN
+        SELECT id, trash_path
+        FROM teldrive.files
+        WHERE id = ANY(file_ids) AND user_id = u_id AND status = 'trashed' AND id = trash_root_id
+    LOOP
+        SELECT id INTO dest_id FROM teldrive.files
+        WHERE path = rec.trash_path AND user_id = u_id AND type = 'folder' AND status = 'active';
+
+        IF dest_id IS NULL THEN
+            SELECT id INTO dest_id FROM teldrive.create_directories(u_id, rec.trash_path);
+        END IF;
+
+        UPDATE teldrive.files
+        SET status = 'active',
+            trashed_at = NULL,
+            trash_root_id = NULL,
+            trash_path = NULL,
+            parent_id = CASE WHEN id = rec.id THEN dest_id ELSE parent_id END
+        WHERE trash_root_id = rec.id AND status = 'trashed';
+
+        WITH RECURSIVE folders AS (
+            SELECT id,
+            CASE
+                WHEN rec.trash_path = '/' THEN '/' || name
+                ELSE rec.trash_path || '/' || name
+            END AS new_path
+            FROM teldrive.files
+            WHERE id = rec.id AND type = 'folder'
+            UNION ALL
+            SELECT f.id, fo.new_path || '/' || f.name
+            FROM teldrive.files f
+            INNER JOIN folders fo ON f.parent_id = fo.id
+            WHERE f.type = 'folder'
+        )
+        UPDATE teldrive.files
+        SET path = folders.new_path
+        FROM folders
+        WHERE teldrive.files.id = folders.id;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Files are handed over to the cleanup job through pending_deletion, folders are removed.
+CREATE OR REPLACE FUNCTION teldrive.purge_trash(root_ids text[])
+RETURNS VOID AS $$
+BEGIN
+    UPDATE teldrive.files SET status = 'pending_deletion'
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'file';
+
+    DELETE FROM teldrive.files
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'folder';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS teldrive.purge_trash;
+DROP FUNCTION IF EXISTS teldrive.restore_files;
+DROP FUNCTION IF EXISTS teldrive.trash_files;
+UPDATE teldrive.files SET status = 'pending_deletion' WHERE status = 'trashed' AND type = 'file';
+DELETE FROM teldrive.files WHERE status = 'trashed' AND type = 'folder';
+DROP INDEX IF EXISTS teldrive.files_trash_root_id_idx;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS trash_path;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS trash_root_id;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS trashed_at;
+-- +goose StatementEnd
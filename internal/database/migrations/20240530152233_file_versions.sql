@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.file_versions (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	file_id text,
+	user_id bigint NOT NULL,
+	parts jsonb,
+	"size" bigint NOT NULL,
+	channel_id bigint,
+	mime_type text,
+	encrypted boolean NOT NULL DEFAULT false,
+	status text NOT NULL DEFAULT 'active',
+	modified_at timestamp NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	FOREIGN KEY (file_id) REFERENCES teldrive.files(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS file_versions_file_id_idx ON teldrive.file_versions (file_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS file_versions_status_idx ON teldrive.file_versions (status);
+
+CREATE OR REPLACE FUNCTION teldrive.purge_trash(root_ids text[])
+RETURNS VOID AS $$
+BEGIN
+    UPDATE teldrive.file_versions SET status = 'pending_deletion'
+    WHERE file_id IN (SELECT id FROM teldrive.files
+        WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'file');
+
+    UPDATE teldrive.files SET status = 'pending_deletion'
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'file';
+
+    DELETE FROM teldrive.files
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'folder';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION teldrive.purge_trash(root_ids text[])
+RETURNS VOID AS $$
+BEGIN
+    UPDATE teldrive.files SET status = 'pending_deletion'
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'file';
+
+    DELETE FROM teldrive.files
+    WHERE trash_root_id = ANY(root_ids) AND status = 'trashed' AND type = 'folder';
+END;
+$$ LANGUAGE plpgsql;
+DROP TABLE IF EXISTS teldrive.file_versions;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS sha256 text;
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS md5 text;
+CREATE INDEX IF NOT EXISTS sha256_idx ON teldrive.files (user_id, sha256) WHERE sha256 IS NOT NULL;
+CREATE INDEX IF NOT EXISTS md5_idx ON teldrive.files (user_id, md5) WHERE md5 IS NOT NULL;
+
+ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS sha256 text;
+ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS md5 text;
+ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS hash_state bytea;
+
+ALTER TABLE teldrive.file_versions ADD COLUMN IF NOT EXISTS sha256 text;
+ALTER TABLE teldrive.file_versions ADD COLUMN IF NOT EXISTS md5 text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.file_versions DROP COLUMN IF EXISTS md5;
+ALTER TABLE teldrive.file_versions DROP COLUMN IF EXISTS sha256;
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS hash_state;
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS md5;
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS sha256;
+DROP INDEX IF EXISTS teldrive.md5_idx;
+DROP INDEX IF EXISTS teldrive.sha256_idx;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS md5;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS sha256;
+-- +goose StatementEnd
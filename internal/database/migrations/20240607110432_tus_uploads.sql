@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.tus_uploads (
+	id text NOT NULL PRIMARY KEY,
+	user_id bigint NOT NULL,
+	name text NOT NULL,
+	path text NOT NULL,
+	mime_type text,
+	channel_id bigint NOT NULL,
+	encrypted boolean NOT NULL DEFAULT false,
+	length bigint NOT NULL,
+	part_size bigint NOT NULL,
+	metadata text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	expires_at timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tus_uploads_expires_at_idx ON teldrive.tus_uploads (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.tus_uploads;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.files ADD COLUMN IF NOT EXISTS thumbnail jsonb;
+ALTER TABLE teldrive.file_versions ADD COLUMN IF NOT EXISTS thumbnail jsonb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.file_versions DROP COLUMN IF EXISTS thumbnail;
+ALTER TABLE teldrive.files DROP COLUMN IF EXISTS thumbnail;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.encryption_keys (
+	id bigserial NOT NULL PRIMARY KEY,
+	user_id bigint NOT NULL,
+	folder_id text REFERENCES teldrive.files(id) ON DELETE SET NULL,
+	wrapped_key text NOT NULL,
+	status text NOT NULL DEFAULT 'active',
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	retired_at timestamp
+);
+CREATE UNIQUE INDEX IF NOT EXISTS encryption_keys_active_idx ON teldrive.encryption_keys (user_id, coalesce(folder_id, ''))
+	WHERE status = 'active';
+
+ALTER TABLE teldrive.uploads ADD COLUMN IF NOT EXISTS key_id bigint NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.uploads DROP COLUMN IF EXISTS key_id;
+DROP TABLE IF EXISTS teldrive.encryption_keys;
+-- +goose StatementEnd
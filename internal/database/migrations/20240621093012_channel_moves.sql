@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.channel_moves (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL,
+	file_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	channel_id bigint NOT NULL,
+	status text NOT NULL DEFAULT 'pending',
+	files integer NOT NULL DEFAULT 0,
+	moved integer NOT NULL DEFAULT 0,
+	failed integer NOT NULL DEFAULT 0,
+	error text,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	updated_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS channel_moves_user_id_idx ON teldrive.channel_moves (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS channel_moves_status_idx ON teldrive.channel_moves (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.channel_moves;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.channels ADD COLUMN IF NOT EXISTS messages bigint NOT NULL DEFAULT 0;
+ALTER TABLE teldrive.channels ADD COLUMN IF NOT EXISTS size bigint NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.channels DROP COLUMN IF EXISTS size;
+ALTER TABLE teldrive.channels DROP COLUMN IF EXISTS messages;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE teldrive.users ADD COLUMN IF NOT EXISTS quota_size bigint;
+ALTER TABLE teldrive.users ADD COLUMN IF NOT EXISTS quota_files bigint;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE teldrive.users DROP COLUMN IF EXISTS quota_files;
+ALTER TABLE teldrive.users DROP COLUMN IF EXISTS quota_size;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.folder_grants (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	folder_id text NOT NULL REFERENCES teldrive.files(id) ON DELETE CASCADE,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	role text NOT NULL,
+	created_by bigint NOT NULL,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now()),
+	UNIQUE (folder_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS folder_grants_user_id_idx ON teldrive.folder_grants (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.folder_grants;
+-- +goose StatementEnd
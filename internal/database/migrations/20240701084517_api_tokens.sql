@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS teldrive.api_tokens (
+	id text NOT NULL DEFAULT teldrive.generate_uid(16) PRIMARY KEY,
+	user_id bigint NOT NULL REFERENCES teldrive.users(user_id) ON DELETE CASCADE,
+	name text NOT NULL DEFAULT '',
+	token_hash text NOT NULL UNIQUE,
+	scopes jsonb NOT NULL,
+	path text NOT NULL DEFAULT '',
+	expires_at timestamp,
+	last_used_at timestamp,
+	created_at timestamp NOT NULL DEFAULT timezone('utc'::text, now())
+);
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON teldrive.api_tokens (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS teldrive.api_tokens;
+-- +goose StatementEnd
@@ -2,6 +2,9 @@ package http_range
 
 import (
 	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
 	"strconv"
 	"strings"
 )
@@ -29,7 +32,10 @@ func Parse(header string, size int64) ([]*Range, error) {
 	ranges := make([]*Range, 0, len(arr))
 
 	for _, value := range arr {
-		r := strings.Split(value, "-")
+		r := strings.Split(strings.TrimSpace(value), "-")
+		if len(r) != 2 {
+			continue
+		}
 		start, startErr := strconv.ParseInt(r[0], 10, 64)
 		end, endErr := strconv.ParseInt(r[1], 10, 64)
 
@@ -65,3 +71,47 @@ func Parse(header string, size int64) ([]*Range, error) {
 
 	return ranges, nil
 }
+
+func (r *Range) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+func (r *Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// MIMEHeader returns the header of the part that holds r in a multipart/byteranges response.
+func (r *Range) MIMEHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.ContentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+// SumSize returns the number of bytes covered by ranges.
+func SumSize(ranges []*Range) (size int64) {
+	for _, r := range ranges {
+		size += r.Length()
+	}
+	return
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// MultipartSize returns the length of a multipart/byteranges body for ranges written
+// with boundary.
+func MultipartSize(ranges []*Range, contentType string, size int64, boundary string) int64 {
+	var w countingWriter
+	mw := multipart.NewWriter(&w)
+	mw.SetBoundary(boundary)
+	for _, r := range ranges {
+		mw.CreatePart(r.MIMEHeader(contentType, size))
+	}
+	mw.Close()
+	return int64(w) + SumSize(ranges)
+}
@@ -0,0 +1,31 @@
+package http_range
+
+import (
+	"bytes"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMultiple(t *testing.T) {
+	ranges, err := Parse("bytes=0-9, 20-29,-5", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Range{{0, 9}, {20, 29}, {95, 99}}, ranges)
+	assert.Equal(t, int64(25), SumSize(ranges))
+}
+
+func TestMultipartSize(t *testing.T) {
+	ranges := []*Range{{0, 9}, {20, 29}}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, r := range ranges {
+		part, _ := mw.CreatePart(r.MIMEHeader("text/plain", 100))
+		part.Write([]byte(strings.Repeat("a", int(r.Length()))))
+	}
+	mw.Close()
+
+	assert.Equal(t, int64(buf.Len()), MultipartSize(ranges, "text/plain", 100, mw.Boundary()))
+}
@@ -2,12 +2,16 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/divyam234/cors"
 	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-contrib/secure"
 	"github.com/go-jose/go-jose/v3/jwt"
 
@@ -32,7 +36,10 @@ func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 func Cors() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders: []string{"Authorization", "Content-Length", "Content-Type"},
+		AllowHeaders: []string{"Authorization", "Content-Length", "Content-Type", "Tus-Resumable", "Upload-Length",
+			"Upload-Metadata", "Upload-Offset", "If-None-Match", "If-Modified-Since", "If-Range"},
+		ExposeHeaders: []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Upload-Offset",
+			"Upload-Length", "Upload-Metadata", "Upload-Expires", "ETag"},
 		AllowOriginFunc: func(origin string) bool {
 			return true
 		},
@@ -40,28 +47,47 @@ func Cors() gin.HandlerFunc {
 	})
 }
 
-func Authmiddleware(secret string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var token string
+// TokenVerifier resolves an API token to the claims of its user.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*types.JWTClaims, error)
+}
 
-		cookie, err := c.Request.Cookie("user-session")
+// TokenRules tells which API tokens a route accepts, session tokens are always accepted.
+type TokenRules struct {
+	// Scope is the scope the token needs, read for GET and HEAD requests and write for
+	// other requests when it is empty.
+	Scope string
+	// Paths lets tokens restricted to a path through, the handler checks the paths the
+	// request touches.
+	Paths bool
+}
 
-		if err != nil {
-			authHeader := c.GetHeader("Authorization")
-			bearerToken := strings.Split(authHeader, "Bearer ")
-			if len(bearerToken) != 2 {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "missing auth token"})
-				c.Abort()
-				return
-			}
-			token = bearerToken[1]
-		} else {
-			token = cookie.Value
+func (r TokenRules) check(method string, claims *types.JWTClaims) error {
+	if claims.TokenID == "" {
+		return nil
+	}
+
+	scope := r.Scope
+	if scope == "" {
+		scope = types.ScopeWrite
+		if method == http.MethodGet || method == http.MethodHead {
+			scope = types.ScopeRead
 		}
+	}
 
-		now := time.Now().UTC()
+	if !claims.HasScope(scope) {
+		return fmt.Errorf("token lacks the %s scope", scope)
+	}
+	if claims.Path != "" && !r.Paths {
+		return errors.New("token is restricted to a path")
+	}
+	return nil
+}
 
-		jwePayload, err := auth.Decode(secret, token)
+// Authmiddleware accepts session tokens, and API tokens allowed by rules when tokens is set.
+func Authmiddleware(secret string, tokens TokenVerifier, rules TokenRules) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jwePayload, err := authenticate(c, secret, tokens)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -69,18 +95,105 @@ func Authmiddleware(secret string) gin.HandlerFunc {
 			return
 		}
 
-		if *jwePayload.Expiry < *jwt.NewNumericDate(now) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
+		if err := rules.check(c.Request.Method, jwePayload); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("jwtUser", jwePayload)
+
+		c.Next()
+	}
+}
+
+// SessionOnly turns away requests made with an API token, it must run after Authmiddleware.
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, _ := c.Get("jwtUser")
+		if jwtUser, ok := val.(*types.JWTClaims); ok && jwtUser.TokenID != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "not allowed with an API token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminMiddleware only lets the Telegram users named in admins through, it must run
+// after Authmiddleware.
+func AdminMiddleware(admins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, _ := c.Get("jwtUser")
+		jwtUser, ok := val.(*types.JWTClaims)
+		if !ok || jwtUser.UserName == "" || !slices.Contains(admins, jwtUser.UserName) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
 			c.Abort()
 			return
 		}
 
+		c.Next()
+	}
+}
+
+// WebdavAuthmiddleware accepts the same tokens as Authmiddleware but challenges
+// clients for HTTP Basic credentials, where the password carries the session token.
+func WebdavAuthmiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jwePayload, err := authenticate(c, secret, nil)
+
+		if err != nil {
+			c.Header("WWW-Authenticate", `Basic realm="teldrive"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
 		c.Set("jwtUser", jwePayload)
 
 		c.Next()
 	}
 }
 
+func authenticate(c *gin.Context, secret string, tokens TokenVerifier) (*types.JWTClaims, error) {
+	var token string
+
+	cookie, err := c.Request.Cookie("user-session")
+
+	if err != nil {
+		authHeader := c.GetHeader("Authorization")
+		if _, password, ok := c.Request.BasicAuth(); ok {
+			token = password
+		} else {
+			bearerToken := strings.Split(authHeader, "Bearer ")
+			if len(bearerToken) != 2 {
+				return nil, errors.New("missing auth token")
+			}
+			token = bearerToken[1]
+		}
+	} else {
+		token = cookie.Value
+	}
+
+	if tokens != nil && strings.HasPrefix(token, types.APITokenPrefix) {
+		return tokens.VerifyToken(c, token)
+	}
+
+	now := time.Now().UTC()
+
+	jwePayload, err := auth.Decode(secret, token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if *jwePayload.Expiry < *jwt.NewNumericDate(now) {
+		return nil, errors.New("token expired")
+	}
+
+	return jwePayload, nil
+}
+
 func SecurityMiddleware() gin.HandlerFunc {
 	return secure.New(secure.Config{
 		STSSeconds:            315360000,
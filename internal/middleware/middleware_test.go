@@ -1,12 +1,17 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/auth"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,3 +39,79 @@ func setupRouterWithHandler(middlewareFunc func(c *gin.Engine), handler func(c *
 	r.GET("/foo", handler)
 	return r
 }
+
+func TestWebdavAuthmiddleware(t *testing.T) {
+	secret := "secret"
+	now := time.Now().UTC()
+	token, err := auth.Encode(secret, &types.JWTClaims{Claims: jwt.Claims{
+		Subject: "123",
+		Expiry:  jwt.NewNumericDate(now.Add(time.Hour)),
+	}})
+	assert.NoError(t, err)
+
+	s := setupRouterWithHandler(func(c *gin.Engine) {
+		c.Use(WebdavAuthmiddleware(secret))
+	}, func(c *gin.Context) {
+		_, ok := c.Get("jwtUser")
+		assert.True(t, ok)
+	})
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+	s.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, `Basic realm="teldrive"`, res.Header().Get("WWW-Authenticate"))
+
+	res = httptest.NewRecorder()
+	req.SetBasicAuth("user", token)
+	s.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+type testTokens map[string]*types.JWTClaims
+
+func (t testTokens) VerifyToken(ctx context.Context, token string) (*types.JWTClaims, error) {
+	if claims, ok := t[token]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestAuthmiddlewareTokens(t *testing.T) {
+	tokens := testTokens{
+		"tdt_read":   {TokenID: "1", Scopes: []string{types.ScopeRead}},
+		"tdt_write":  {TokenID: "2", Scopes: []string{types.ScopeWrite}},
+		"tdt_folder": {TokenID: "3", Scopes: []string{types.ScopeRead}, Path: "/docs"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/files", Authmiddleware("secret", tokens, TokenRules{}), ok)
+	r.POST("/files", Authmiddleware("secret", tokens, TokenRules{}), ok)
+	r.GET("/paths", Authmiddleware("secret", tokens, TokenRules{Paths: true}), ok)
+	r.POST("/uploads", Authmiddleware("secret", tokens, TokenRules{Scope: types.ScopeUpload}), ok)
+	r.GET("/keys", Authmiddleware("secret", tokens, TokenRules{}), SessionOnly(), ok)
+
+	for _, tc := range []struct {
+		method, path, token string
+		code                int
+	}{
+		{"GET", "/files", "tdt_read", http.StatusOK},
+		{"POST", "/files", "tdt_read", http.StatusForbidden},
+		{"POST", "/files", "tdt_write", http.StatusOK},
+		{"GET", "/files", "tdt_write", http.StatusForbidden},
+		{"POST", "/uploads", "tdt_write", http.StatusOK},
+		{"POST", "/uploads", "tdt_read", http.StatusForbidden},
+		{"GET", "/files", "tdt_folder", http.StatusForbidden},
+		{"GET", "/paths", "tdt_folder", http.StatusOK},
+		{"GET", "/keys", "tdt_read", http.StatusForbidden},
+		{"GET", "/files", "tdt_unknown", http.StatusUnauthorized},
+	} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		r.ServeHTTP(res, req)
+		assert.Equal(t, tc.code, res.Code, "%s %s with %s", tc.method, tc.path, tc.token)
+	}
+}
@@ -6,35 +6,43 @@ import (
 
 	"github.com/divyam234/teldrive/internal/crypt"
 	"github.com/divyam234/teldrive/pkg/types"
-	"github.com/gotd/td/telegram"
 )
 
+// KeyFunc returns the password of the key with the given ID.
+type KeyFunc func(keyId int64) (string, error)
+
 type decrpytedReader struct {
-	ctx           context.Context
-	parts         []types.Part
-	ranges        []types.Range
-	pos           int
-	client        *telegram.Client
-	reader        io.ReadCloser
-	limit         int64
-	err           error
-	encryptionKey string
+	ctx     context.Context
+	sources []Source
+	ranges  []types.Range
+	pos     int
+	cnf     *Config
+	reader  io.ReadCloser
+	limit   int64
+	err     error
+	keys    KeyFunc
 }
 
+// NewDecryptedReader reads the decrypted bytes from start to end. Every part is
+// decrypted with the key it was encrypted with, looked up by its key ID.
 func NewDecryptedReader(
 	ctx context.Context,
-	client *telegram.Client,
-	parts []types.Part,
+	sources []Source,
 	start, end int64,
-	encryptionKey string) (io.ReadCloser, error) {
+	keys KeyFunc,
+	cnf *Config) (io.ReadCloser, error) {
+
+	if reader, err := emptyReader(sources, start, end); reader != nil || err != nil {
+		return reader, err
+	}
 
 	r := &decrpytedReader{
-		ctx:           ctx,
-		parts:         parts,
-		client:        client,
-		limit:         end - start + 1,
-		ranges:        calculatePartByteRanges(start, end, parts[0].DecryptedSize),
-		encryptionKey: encryptionKey,
+		ctx:     ctx,
+		sources: sources,
+		cnf:     cnf,
+		limit:   end - start + 1,
+		ranges:  calculatePartByteRanges(start, end, sources[0].Parts[0].DecryptedSize),
+		keys:    keys,
 	}
 	res, err := r.nextPart()
 
@@ -70,6 +78,7 @@ func (r *decrpytedReader) Read(p []byte) (n int, err error) {
 		}
 		r.pos++
 		if r.pos < len(r.ranges) {
+			r.reader.Close()
 			r.reader, err = r.nextPart()
 		}
 	}
@@ -88,11 +97,19 @@ func (r *decrpytedReader) Close() (err error) {
 
 func (r *decrpytedReader) nextPart() (io.ReadCloser, error) {
 
-	location := r.parts[r.ranges[r.pos].PartNo].Location
+	partNo := r.ranges[r.pos].PartNo
+	part := r.sources[0].Parts[partNo]
 	start := r.ranges[r.pos].Start
 	end := r.ranges[r.pos].End
-	salt := r.parts[r.ranges[r.pos].PartNo].Salt
-	cipher, _ := crypt.NewCipher(r.encryptionKey, salt)
+	salt := part.Salt
+	password, err := r.keys(part.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := crypt.NewCipher(password, salt)
+	if err != nil {
+		return nil, err
+	}
 
 	return cipher.DecryptDataSeek(r.ctx,
 		func(ctx context.Context,
@@ -102,10 +119,10 @@ func (r *decrpytedReader) nextPart() (io.ReadCloser, error) {
 			var end int64
 
 			if underlyingLimit >= 0 {
-				end = min(r.parts[r.ranges[r.pos].PartNo].Size-1, underlyingOffset+underlyingLimit-1)
+				end = min(part.Size-1, underlyingOffset+underlyingLimit-1)
 			}
 
-			return newTGReader(r.ctx, r.client, location, underlyingOffset, end)
+			return newTGReader(r.ctx, r.sources, partNo, underlyingOffset, end, r.cnf)
 		}, start, end-start+1)
 
 }
@@ -2,12 +2,26 @@ package reader
 
 import (
 	"context"
+	"errors"
 	"io"
+	"strings"
 
 	"github.com/divyam234/teldrive/pkg/types"
-	"github.com/gotd/td/telegram"
 )
 
+var ErrNoParts = errors.New("file has no parts")
+
+// emptyReader returns a reader for ranges without bytes, files without parts are empty.
+func emptyReader(sources []Source, start, end int64) (io.ReadCloser, error) {
+	if end < start {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if len(sources) == 0 || len(sources[0].Parts) == 0 {
+		return nil, ErrNoParts
+	}
+	return nil, nil
+}
+
 func calculatePartByteRanges(startByte, endByte, partSize int64) []types.Range {
 
 	partByteRanges := []types.Range{}
@@ -36,28 +50,32 @@ func calculatePartByteRanges(startByte, endByte, partSize int64) []types.Range {
 }
 
 type linearReader struct {
-	ctx    context.Context
-	parts  []types.Part
-	ranges []types.Range
-	pos    int
-	client *telegram.Client
-	reader io.ReadCloser
-	limit  int64
-	err    error
+	ctx     context.Context
+	sources []Source
+	ranges  []types.Range
+	pos     int
+	cnf     *Config
+	reader  io.ReadCloser
+	limit   int64
+	err     error
 }
 
 func NewLinearReader(ctx context.Context,
-	client *telegram.Client,
-	parts []types.Part,
+	sources []Source,
 	start, end int64,
+	cnf *Config,
 ) (reader io.ReadCloser, err error) {
 
+	if reader, err = emptyReader(sources, start, end); reader != nil || err != nil {
+		return reader, err
+	}
+
 	r := &linearReader{
-		ctx:    ctx,
-		parts:  parts,
-		client: client,
-		limit:  end - start + 1,
-		ranges: calculatePartByteRanges(start, end, parts[0].Size),
+		ctx:     ctx,
+		sources: sources,
+		cnf:     cnf,
+		limit:   end - start + 1,
+		ranges:  calculatePartByteRanges(start, end, sources[0].Parts[0].Size),
 	}
 
 	r.reader, err = r.nextPart()
@@ -91,6 +109,7 @@ func (r *linearReader) Read(p []byte) (n int, err error) {
 		}
 		r.pos++
 		if r.pos < len(r.ranges) {
+			r.reader.Close()
 			r.reader, err = r.nextPart()
 
 		}
@@ -101,11 +120,11 @@ func (r *linearReader) Read(p []byte) (n int, err error) {
 
 func (r *linearReader) nextPart() (io.ReadCloser, error) {
 
-	location := r.parts[r.ranges[r.pos].PartNo].Location
+	partNo := r.ranges[r.pos].PartNo
 	startByte := r.ranges[r.pos].Start
 	endByte := r.ranges[r.pos].End
 
-	return newTGReader(r.ctx, r.client, location, startByte, endByte)
+	return newTGReader(r.ctx, r.sources, partNo, startByte, endByte, r.cnf)
 }
 
 func (r *linearReader) Close() (err error) {
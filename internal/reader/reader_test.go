@@ -0,0 +1,21 @@
+package reader
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyFile(t *testing.T) {
+	r, err := NewLinearReader(context.Background(), []Source{{}}, 0, -1, nil)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	_, err = NewDecryptedReader(context.Background(), []Source{{}}, 0, 9, nil, nil)
+	assert.ErrorIs(t, err, ErrNoParts)
+}
@@ -5,21 +5,71 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/divyam234/teldrive/internal/chunkcache"
+	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 )
 
+// Source is a client together with the parts of a file as seen by that client.
+// File references are bound to the client that fetched the messages, so every
+// client brings its own part locations.
+type Source struct {
+	Client *telegram.Client
+	Parts  []types.Part
+}
+
+// Config controls how many chunks a reader prefetches.
+type Config struct {
+	// Concurrency is the number of chunk requests kept in flight.
+	Concurrency int
+	// BufferSize bounds the bytes held by chunks that are in flight or not read yet.
+	BufferSize int64
+	// Cache keeps downloaded chunks on disk when set.
+	Cache *chunkcache.Cache
+}
+
+func (c *Config) window(chunkSize int64) int {
+	if c == nil || c.Concurrency <= 1 {
+		return 1
+	}
+	n := c.Concurrency
+	if c.BufferSize > 0 {
+		n = min(n, int(c.BufferSize/chunkSize))
+	}
+	return max(n, 1)
+}
+
+// uploadGetFile downloads a chunk, tests replace it to read without Telegram.
+var uploadGetFile = func(ctx context.Context, client *telegram.Client, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+	return client.API().UploadGetFile(ctx, req)
+}
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// tgReader reads a byte range of a part in chunks. Up to window chunks are requested
+// ahead of the consumer, spread over the sources in turn, and handed out in order.
 type tgReader struct {
-	ctx       context.Context
-	client    *telegram.Client
-	location  *tg.InputDocumentFileLocation
-	start     int64
-	end       int64
-	next      func() ([]byte, error)
-	buffer    []byte
-	limit     int64
-	chunkSize int64
-	i         int64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	sources     []Source
+	partNo      int64
+	start       int64
+	end         int64
+	chunkSize   int64
+	offset      int64
+	window      int
+	totalChunks int
+	requested   int
+	consumed    int
+	pending     []chan chunkResult
+	buffer      []byte
+	limit       int64
+	cache       *chunkcache.Cache
+	getFile     func(ctx context.Context, client *telegram.Client, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error)
 }
 
 func calculateChunkSize(start, end int64) int64 {
@@ -34,23 +84,37 @@ func calculateChunkSize(start, end int64) int64 {
 
 func newTGReader(
 	ctx context.Context,
-	client *telegram.Client,
-	location *tg.InputDocumentFileLocation,
+	sources []Source,
+	partNo int64,
 	start int64,
 	end int64,
+	cnf *Config,
 
 ) (io.ReadCloser, error) {
 
+	chunkSize := calculateChunkSize(start, end)
+
+	offset := start - (start % chunkSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+
 	r := &tgReader{
-		ctx:       ctx,
-		location:  location,
-		client:    client,
-		start:     start,
-		end:       end,
-		chunkSize: calculateChunkSize(start, end),
-		limit:     end - start + 1,
-	}
-	r.next = r.partStream()
+		ctx:         ctx,
+		cancel:      cancel,
+		sources:     sources,
+		partNo:      partNo,
+		start:       start,
+		end:         end,
+		chunkSize:   chunkSize,
+		offset:      offset,
+		window:      cnf.window(chunkSize),
+		totalChunks: int((end - offset + chunkSize) / chunkSize),
+		limit:       end - start + 1,
+		getFile:     uploadGetFile,
+	}
+	if cnf != nil {
+		r.cache = cnf.Cache
+	}
 	return r, nil
 }
 
@@ -60,42 +124,101 @@ func (r *tgReader) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	if r.i >= int64(len(r.buffer)) {
+	if len(r.buffer) == 0 {
 		r.buffer, err = r.next()
 		if err != nil {
 			return 0, err
 		}
 		if len(r.buffer) == 0 {
-			r.next = r.partStream()
-			r.buffer, err = r.next()
-			if err != nil {
-				return 0, err
-			}
-
+			return 0, io.ErrUnexpectedEOF
 		}
-		r.i = 0
 	}
-	n = copy(p, r.buffer[r.i:])
-	r.i += int64(n)
+	n = copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
 	r.limit -= int64(n)
 
 	return
 }
 
-func (*tgReader) Close() error {
+func (r *tgReader) Close() error {
+	r.cancel()
+	r.pending = nil
 	return nil
 }
 
-func (r *tgReader) chunk(offset int64, limit int64) ([]byte, error) {
+// schedule requests chunks until the window is full.
+func (r *tgReader) schedule() {
+	for len(r.pending) < r.window && r.requested < r.totalChunks {
+		source := r.sources[r.requested%len(r.sources)]
+		offset := r.offset + int64(r.requested)*r.chunkSize
+		res := make(chan chunkResult, 1)
+		go func() {
+			data, err := r.chunk(source, offset, r.chunkSize)
+			res <- chunkResult{data: data, err: err}
+		}()
+		r.pending = append(r.pending, res)
+		r.requested++
+	}
+}
+
+func (r *tgReader) next() ([]byte, error) {
+	r.schedule()
+
+	if len(r.pending) == 0 {
+		return nil, io.EOF
+	}
+
+	var res chunkResult
+
+	select {
+	case res = <-r.pending[0]:
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	r.pending = r.pending[1:]
+
+	index := r.consumed
+	r.consumed++
+
+	r.schedule()
+
+	data := res.data
+
+	if index == r.totalChunks-1 {
+		data = data[:min(int64(len(data)), (r.end%r.chunkSize)+1)]
+	}
+	if index == 0 {
+		data = data[min(int64(len(data)), r.start-r.offset):]
+	}
+
+	return data, nil
+}
+
+func (r *tgReader) chunk(source Source, offset int64, limit int64) ([]byte, error) {
+
+	location := source.Parts[r.partNo].Location
+
+	var key string
+	if r.cache != nil {
+		key = chunkcache.Key(location.ID, offset, limit)
+		if data, ok := r.cache.Get(key); ok {
+			return data, nil
+		}
+	}
 
 	req := &tg.UploadGetFileRequest{
 		Offset:   offset,
 		Limit:    int(limit),
-		Location: r.location,
+		Location: location,
 		Precise:  true,
 	}
 
-	res, err := r.client.API().UploadGetFile(r.ctx, req)
+	res, err := r.getFile(r.ctx, source.Client, req)
 
 	if err != nil {
 		return nil, err
@@ -103,43 +226,11 @@ func (r *tgReader) chunk(offset int64, limit int64) ([]byte, error) {
 
 	switch result := res.(type) {
 	case *tg.UploadFile:
+		if r.cache != nil {
+			r.cache.Put(key, result.Bytes)
+		}
 		return result.Bytes, nil
 	default:
 		return nil, fmt.Errorf("unexpected type %T", r)
 	}
 }
-
-func (r *tgReader) partStream() func() ([]byte, error) {
-
-	start := r.start
-	end := r.end
-	offset := start - (start % r.chunkSize)
-
-	leftCut := start - offset
-	rightCut := (end % r.chunkSize) + 1
-	totalParts := int((end - offset + r.chunkSize) / r.chunkSize)
-	currentPart := 1
-
-	return func() ([]byte, error) {
-		if currentPart > totalParts {
-			return make([]byte, 0), nil
-		}
-		res, err := r.chunk(offset, r.chunkSize)
-		if err != nil {
-			return nil, err
-		}
-		if len(res) == 0 {
-			return res, nil
-		} else if totalParts == 1 {
-			res = res[leftCut:rightCut]
-		} else if currentPart == 1 {
-			res = res[leftCut:]
-		} else if currentPart == totalParts {
-			res = res[:rightCut]
-		}
-
-		currentPart++
-		offset += r.chunkSize
-		return res, nil
-	}
-}
@@ -0,0 +1,118 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChunkSize = 1024 * 1024
+
+func testPart(size int) ([]byte, []Source) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	parts := []types.Part{{Location: &tg.InputDocumentFileLocation{ID: 1}, Size: int64(size)}}
+	return data, []Source{{Parts: parts}, {Parts: parts}}
+}
+
+func setUploadGetFile(t *testing.T, fn func(ctx context.Context, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error)) {
+	uploadGetFile = func(ctx context.Context, _ *telegram.Client, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+		return fn(ctx, req)
+	}
+	t.Cleanup(func() {
+		uploadGetFile = func(ctx context.Context, client *telegram.Client, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+			return client.API().UploadGetFile(ctx, req)
+		}
+	})
+}
+
+func serveChunk(data []byte, req *tg.UploadGetFileRequest) *tg.UploadFile {
+	end := min(req.Offset+int64(req.Limit), int64(len(data)))
+	return &tg.UploadFile{Bytes: data[req.Offset:end]}
+}
+
+func TestTGReaderOrder(t *testing.T) {
+	data, sources := testPart(5*testChunkSize + 123)
+
+	// Later chunks are returned first so that the reader has to restore the order.
+	setUploadGetFile(t, func(ctx context.Context, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+		time.Sleep(time.Duration(10-req.Offset/testChunkSize) * 2 * time.Millisecond)
+		return serveChunk(data, req), nil
+	})
+
+	start, end := int64(1000), int64(len(data)-10)
+
+	r, err := newTGReader(context.Background(), sources, 0, start, end, &Config{Concurrency: 4})
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data[start:end+1], got)
+}
+
+func TestTGReaderError(t *testing.T) {
+	data, sources := testPart(4 * testChunkSize)
+
+	errChunk := errors.New("chunk failed")
+
+	setUploadGetFile(t, func(ctx context.Context, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+		if req.Offset == 2*testChunkSize {
+			return nil, errChunk
+		}
+		return serveChunk(data, req), nil
+	})
+
+	r, err := newTGReader(context.Background(), sources, 0, 0, int64(len(data)-1), &Config{Concurrency: 4})
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, errChunk)
+	assert.Equal(t, data[:2*testChunkSize], got)
+}
+
+func TestTGReaderCancel(t *testing.T) {
+	data, sources := testPart(4 * testChunkSize)
+
+	var inFlight atomic.Int32
+
+	// Only the first chunk is served, the others wait until the request is cancelled.
+	setUploadGetFile(t, func(ctx context.Context, req *tg.UploadGetFileRequest) (tg.UploadFileClass, error) {
+		if req.Offset == 0 {
+			return serveChunk(data, req), nil
+		}
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r, err := newTGReader(ctx, sources, 0, 0, int64(len(data)-1), &Config{Concurrency: 4})
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, testChunkSize)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, data[:testChunkSize], buf)
+
+	cancel()
+
+	_, err = r.Read(buf)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Eventually(t, func() bool { return inFlight.Load() == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,129 @@
+package sigv4
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxChunkSize = 16 * 1024 * 1024
+
+var ErrMalformedChunk = errors.New("malformed chunked payload")
+
+var emptyHash = hashHex(nil)
+
+type chunkedReader struct {
+	r        *bufio.Reader
+	res      *Result
+	unsigned bool
+	prevSig  string
+	buf      []byte
+	done     bool
+	err      error
+}
+
+// NewChunkedReader decodes an aws-chunked payload and verifies the signature of
+// every chunk against the seed signature of the request.
+func NewChunkedReader(body io.Reader, res *Result) io.Reader {
+	return &chunkedReader{r: bufio.NewReader(body), res: res, prevSig: res.Signature}
+}
+
+// newUnsignedChunkedReader decodes an aws-chunked payload without chunk signatures,
+// discarding the trailing headers after the final chunk.
+func newUnsignedChunkedReader(body io.Reader) io.Reader {
+	return &chunkedReader{r: bufio.NewReader(body), unsigned: true}
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.done {
+			return 0, io.EOF
+		}
+		cr.err = cr.readChunk()
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+func (cr *chunkedReader) readChunk() error {
+	line, err := cr.r.ReadString('\n')
+	if err != nil {
+		return ErrMalformedChunk
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	sizeHex, signature, ok := strings.Cut(line, ";chunk-signature=")
+	if !ok && !cr.unsigned {
+		return ErrMalformedChunk
+	}
+
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return ErrMalformedChunk
+	}
+
+	if size == 0 && cr.unsigned {
+		cr.done = true
+		return cr.skipTrailer()
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return ErrMalformedChunk
+	}
+
+	crlf := make([]byte, 2)
+	if _, err := io.ReadFull(cr.r, crlf); err != nil || string(crlf) != "\r\n" {
+		return ErrMalformedChunk
+	}
+
+	if cr.unsigned {
+		cr.buf = data
+		return nil
+	}
+
+	stringToSign := strings.Join([]string{
+		algorithm + "-PAYLOAD",
+		cr.res.AmzDate,
+		cr.res.Scope,
+		cr.prevSig,
+		emptyHash,
+		hashHex(data),
+	}, "\n")
+
+	expected := hex.EncodeToString(hmacSHA256(cr.res.signingKey, []byte(stringToSign)))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSignatureMismatch
+	}
+
+	cr.prevSig = signature
+	cr.buf = data
+	if size == 0 {
+		cr.done = true
+	}
+	return nil
+}
+
+func (cr *chunkedReader) skipTrailer() error {
+	for {
+		line, err := cr.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil {
+			return ErrMalformedChunk
+		}
+		if strings.TrimRight(line, "\r\n") == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm        = "AWS4-HMAC-SHA256"
+	timeFormat       = "20060102T150405Z"
+	maxSkew          = 15 * time.Minute
+	maxExpires       = 7 * 24 * 60 * 60
+	UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+	StreamingUnsignedTrailerPayload = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+var (
+	ErrMissingAuth          = errors.New("missing authentication")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+	ErrMalformedAuth        = errors.New("malformed authorization")
+	ErrRequestExpired       = errors.New("request expired")
+	ErrSignatureMismatch    = errors.New("signature does not match")
+	ErrUnsupportedPayload   = errors.New("unsupported payload type")
+	ErrContentHashMismatch  = errors.New("content sha256 does not match")
+)
+
+var now = time.Now
+
+// SecretFunc returns the secret key for an access key id.
+type SecretFunc func(accessKey string) (string, error)
+
+// Result holds the verified credentials of a request. For streaming uploads it
+// also carries what is needed to verify the signatures of the payload chunks.
+type Result struct {
+	AccessKey   string
+	Signature   string
+	Scope       string
+	AmzDate     string
+	PayloadHash string
+	signingKey  []byte
+}
+
+func (r *Result) Streaming() bool {
+	return r.PayloadHash == StreamingPayload || r.PayloadHash == StreamingUnsignedTrailerPayload
+}
+
+// Body wraps the request body according to the payload type of the signature:
+// chunked payloads are decoded and signed payloads are checked against their hash.
+func (r *Result) Body(body io.Reader) (io.Reader, error) {
+	switch {
+	case r.PayloadHash == UnsignedPayload:
+		return body, nil
+	case r.PayloadHash == StreamingPayload:
+		return NewChunkedReader(body, r), nil
+	case r.PayloadHash == StreamingUnsignedTrailerPayload:
+		return newUnsignedChunkedReader(body), nil
+	case len(r.PayloadHash) == sha256.Size*2:
+		return &hashReader{r: body, h: sha256.New(), expected: r.PayloadHash}, nil
+	default:
+		return nil, ErrUnsupportedPayload
+	}
+}
+
+// Verify checks the AWS Signature Version 4 of r, either from the Authorization
+// header or from presigned query parameters.
+func Verify(r *http.Request, secret SecretFunc) (*Result, error) {
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		return verifyPresigned(r, secret)
+	}
+	return verifyHeader(r, secret)
+}
+
+func verifyHeader(r *http.Request, secret SecretFunc) (*Result, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrMissingAuth
+	}
+
+	if !strings.HasPrefix(header, algorithm+" ") {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrMalformedAuth
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	credential, signedHeaders, signature := fields["Credential"], fields["SignedHeaders"], fields["Signature"]
+	if credential == "" || signedHeaders == "" || signature == "" {
+		return nil, ErrMalformedAuth
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		amzDate = r.Header.Get("Date")
+	}
+	t, err := time.Parse(timeFormat, amzDate)
+	if err != nil {
+		return nil, ErrMalformedAuth
+	}
+	if d := now().Sub(t); d > maxSkew || d < -maxSkew {
+		return nil, ErrRequestExpired
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = UnsignedPayload
+	}
+
+	return verify(r, secret, credential, signedHeaders, signature, amzDate, payloadHash, r.URL.Query())
+}
+
+func verifyPresigned(r *http.Request, secret SecretFunc) (*Result, error) {
+	query := r.URL.Query()
+
+	if query.Get("X-Amz-Algorithm") != algorithm {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	credential, signedHeaders, signature := query.Get("X-Amz-Credential"), query.Get("X-Amz-SignedHeaders"),
+		query.Get("X-Amz-Signature")
+	if credential == "" || signedHeaders == "" || signature == "" {
+		return nil, ErrMalformedAuth
+	}
+
+	amzDate := query.Get("X-Amz-Date")
+	t, err := time.Parse(timeFormat, amzDate)
+	if err != nil {
+		return nil, ErrMalformedAuth
+	}
+	// Presigned urls are valid for at most seven days.
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 0 || expires > maxExpires {
+		return nil, ErrMalformedAuth
+	}
+	if now().After(t.Add(time.Duration(expires) * time.Second)) {
+		return nil, ErrRequestExpired
+	}
+
+	query.Del("X-Amz-Signature")
+
+	return verify(r, secret, credential, signedHeaders, signature, amzDate, UnsignedPayload, query)
+}
+
+func verify(r *http.Request, secret SecretFunc, credential, signedHeaders, signature, amzDate,
+	payloadHash string, query url.Values) (*Result, error) {
+
+	// Credential is <access key>/<date>/<region>/<service>/aws4_request
+	parts := strings.SplitN(credential, "/", 2)
+	if len(parts) != 2 {
+		return nil, ErrMalformedAuth
+	}
+	accessKey, scope := parts[0], parts[1]
+	scopeParts := strings.Split(scope, "/")
+	if len(scopeParts) != 4 || scopeParts[3] != "aws4_request" {
+		return nil, ErrMalformedAuth
+	}
+
+	secretKey, err := secret(accessKey)
+	if err != nil {
+		return nil, err
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		encodePath(r.URL.Path),
+		canonicalQuery(query),
+		canonicalHeaders(r, signedHeaders),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := signingKey(secretKey, scopeParts[0], scopeParts[1], scopeParts[2])
+
+	expected := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrSignatureMismatch
+	}
+
+	return &Result{
+		AccessKey:   accessKey,
+		Signature:   signature,
+		Scope:       scope,
+		AmzDate:     amzDate,
+		PayloadHash: payloadHash,
+		signingKey:  key,
+	}, nil
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(date))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders string) string {
+	var b strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = r.Header.Get("Content-Length")
+			if value == "" && r.ContentLength >= 0 {
+				value = strconv.FormatInt(r.ContentLength, 10)
+			}
+		default:
+			values := r.Header.Values(name)
+			trimmed := make([]string, 0, len(values))
+			for _, v := range values {
+				trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(trimmed, ",")
+		}
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, encode(k, true)+"="+encode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func encodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return encode(path, false)
+}
+
+// encode applies the URI encoding rules of SigV4: everything except unreserved
+// characters is percent encoded, and '/' is kept as is in paths.
+func encode(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hexChars[c>>4])
+			b.WriteByte(hexChars[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type hashReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected string
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(hr.h.Sum(nil)) != hr.expected {
+		return n, ErrContentHashMismatch
+	}
+	return n, err
+}
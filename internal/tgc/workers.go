@@ -91,6 +91,24 @@ func (w *StreamWorker) Next(channelId int64) (*Client, int, error) {
 	return nextClient, index, nil
 }
 
+// Clients returns all bot clients of a channel together with their tokens, connecting
+// the ones that are not running yet.
+func (w *StreamWorker) Clients(channelId int64) ([]*Client, []string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, client := range w.clients[channelId] {
+		if client.Status == "idle" {
+			stop, err := bg.Connect(client.Tg)
+			if err != nil {
+				return nil, nil, err
+			}
+			client.Stop = stop
+			client.Status = "running"
+		}
+	}
+	return w.clients[channelId], w.bots[channelId], nil
+}
+
 func (w *StreamWorker) UserWorker(client *telegram.Client, userId int64) (*Client, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
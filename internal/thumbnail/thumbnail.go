@@ -0,0 +1,89 @@
+// Package thumbnail renders small JPEG previews of images.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"slices"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const MimeType = "image/jpeg"
+
+// MimeTypes lists the image types thumbnails can be generated for.
+var MimeTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// maxPixels bounds the size of decoded images so that a small file cannot claim a huge
+// amount of memory.
+const maxPixels = 50 * 1000 * 1000
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+// Supported reports whether thumbnails can be generated for images of mimeType.
+func Supported(mimeType string) bool {
+	return slices.Contains(MimeTypes, mimeType)
+}
+
+// tooLarge reports whether an image has more than maxPixels pixels, without overflowing
+// on the dimensions found in a crafted header.
+func tooLarge(width, height int) bool {
+	if width <= 0 || height <= 0 {
+		return width < 0 || height < 0
+	}
+	return width > maxPixels/height
+}
+
+// Generate decodes the image read from r and returns a JPEG that fits in a size x size box.
+// Images that already fit are re-encoded without scaling.
+func Generate(r io.Reader, size int) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if tooLarge(cfg.Width, cfg.Height) {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	width, height := scale(bounds.Dx(), bounds.Dy(), size)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// JPEG has no alpha channel, transparent areas are drawn on white.
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func scale(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(height*size/width, 1)
+	}
+	return max(width*size/height, 1), size
+}
@@ -0,0 +1,59 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	data, err := Generate(bytes.NewReader(encodePNG(t, 640, 320)), 320)
+	assert.NoError(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 320, 160), img.Bounds())
+}
+
+func TestGenerateSmallImage(t *testing.T) {
+	data, err := Generate(bytes.NewReader(encodePNG(t, 100, 200)), 320)
+	assert.NoError(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 200), img.Bounds())
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	_, err := Generate(bytes.NewReader([]byte("not an image")), 320)
+	assert.Error(t, err)
+}
+
+func TestScale(t *testing.T) {
+	w, h := scale(1000, 4000, 320)
+	assert.Equal(t, 80, w)
+	assert.Equal(t, 320, h)
+}
+
+func TestTooLarge(t *testing.T) {
+	assert.False(t, tooLarge(1000, 1000))
+	assert.False(t, tooLarge(0, 1000))
+	assert.True(t, tooLarge(maxPixels, 2))
+	assert.True(t, tooLarge(1<<40, 1<<40))
+	assert.True(t, tooLarge(-1, 10))
+}
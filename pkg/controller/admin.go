@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+)
+
+func (fc *Controller) CheckFiles(c *gin.Context) {
+	var payload schemas.CheckIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.CheckFiles(c, &payload)
+	if err != nil {
+		httputil.NewError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ReconcileOrphans(c *gin.Context) {
+	var payload schemas.OrphansIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.ReconcileOrphans(c, &payload)
+	if err != nil {
+		httputil.NewError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ReleaseQuarantine(c *gin.Context) {
+	var payload schemas.FileOperation
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.ReleaseQuarantine(payload.Files)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ListQuotas(c *gin.Context) {
+	res, err := fc.UserService.ListQuotas()
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) UpdateQuota(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var payload schemas.QuotaIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, appErr := fc.UserService.UpdateQuota(userId, &payload)
+	if appErr != nil {
+		httputil.NewError(c, appErr.Code, appErr.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -9,16 +9,31 @@ type Controller struct {
 	UserService   *services.UserService
 	UploadService *services.UploadService
 	AuthService   *services.AuthService
+	WebdavService *services.WebdavService
+	S3Service     *services.S3Service
+	ShareService  *services.ShareService
+	TusService    *services.TusService
+	TokenService  *services.TokenService
 }
 
 func NewController(fileService *services.FileService,
 	userService *services.UserService,
 	uploadService *services.UploadService,
-	authService *services.AuthService) *Controller {
+	authService *services.AuthService,
+	webdavService *services.WebdavService,
+	s3Service *services.S3Service,
+	shareService *services.ShareService,
+	tusService *services.TusService,
+	tokenService *services.TokenService) *Controller {
 	return &Controller{
 		FileService:   fileService,
 		UserService:   userService,
 		UploadService: uploadService,
 		AuthService:   authService,
+		WebdavService: webdavService,
+		S3Service:     s3Service,
+		ShareService:  shareService,
+		TusService:    tusService,
+		TokenService:  tokenService,
 	}
 }
@@ -24,6 +24,16 @@ func (fc *Controller) CreateFile(c *gin.Context) {
 
 	userId, _ := services.GetUserAuth(c)
 
+	ids, paths := []string{}, []string{fileIn.Path}
+	if fileIn.ParentID != "" {
+		ids, paths = []string{fileIn.ParentID}, nil
+	}
+
+	if err := fc.FileService.CheckTokenPath(c, ids, paths...); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.CreateFile(c, userId, &fileIn)
 	if err != nil {
 		logger.Error(err)
@@ -53,13 +63,20 @@ func (fc *Controller) UpdateFile(c *gin.Context) {
 }
 
 func (fc *Controller) GetFileByID(c *gin.Context) {
-	res, err := fc.FileService.GetFileByID(c.Param("fileID"))
+	userId, _ := services.GetUserAuth(c)
+
+	if err := fc.FileService.CheckTokenPath(c, []string{c.Param("fileID")}); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	res, err := fc.FileService.GetFileByID(userId, c.Param("fileID"))
 	if err != nil {
-		httputil.NewError(c, http.StatusNotFound, err.Error)
+		httputil.NewError(c, err.Code, err.Error)
 		return
 	}
 
-	c.JSON(http.StatusOK, res)
+	httputil.ConditionalJSON(c, res, res.UpdatedAt)
 }
 
 func (fc *Controller) ListFiles(c *gin.Context) {
@@ -78,6 +95,19 @@ func (fc *Controller) ListFiles(c *gin.Context) {
 		return
 	}
 
+	// Searches cover the whole drive.
+	ids, paths := []string{}, []string{fquery.Path}
+	if fquery.Op == "search" {
+		paths = []string{"/"}
+	} else if fquery.Path == "" && fquery.ParentID != "" {
+		ids, paths = []string{fquery.ParentID}, nil
+	}
+
+	if err := fc.FileService.CheckTokenPath(c, ids, paths...); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.ListFiles(userId, &fquery)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
@@ -96,6 +126,11 @@ func (fc *Controller) MakeDirectory(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
+	if err := fc.FileService.CheckTokenPath(c, nil, payload.Path); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.MakeDirectory(userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
@@ -115,6 +150,38 @@ func (fc *Controller) CopyFile(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (fc *Controller) MoveToChannel(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ChannelMoveIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.MoveToChannel(userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, res)
+}
+
+func (fc *Controller) GetChannelMove(c *gin.Context) {
+
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.GetChannelMove(userId, c.Param("moveID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 func (fc *Controller) MoveFiles(c *gin.Context) {
 
 	userId, _ := services.GetUserAuth(c)
@@ -124,6 +191,16 @@ func (fc *Controller) MoveFiles(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
+	ids, paths := payload.Files, []string{payload.Destination}
+	if payload.DestinationID != "" {
+		ids, paths = append([]string{payload.DestinationID}, payload.Files...), nil
+	}
+
+	if err := fc.FileService.CheckTokenPath(c, ids, paths...); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.MoveFiles(userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
@@ -142,6 +219,11 @@ func (fc *Controller) DeleteFiles(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
+	if err := fc.FileService.CheckTokenPath(c, payload.Files); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.DeleteFiles(userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
@@ -159,6 +241,11 @@ func (fc *Controller) MoveDirectory(c *gin.Context) {
 		httputil.NewError(c, http.StatusBadRequest, err)
 		return
 	}
+	if err := fc.FileService.CheckTokenPath(c, nil, payload.Source, payload.Destination); err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
 	res, err := fc.FileService.MoveDirectory(userId, &payload)
 	if err != nil {
 		httputil.NewError(c, err.Code, err.Error)
@@ -183,3 +270,11 @@ func (fc *Controller) GetCategoryStats(c *gin.Context) {
 func (fc *Controller) GetFileStream(c *gin.Context) {
 	fc.FileService.GetFileStream(c)
 }
+
+func (fc *Controller) GetThumbnail(c *gin.Context) {
+	fc.FileService.GetThumbnail(c)
+}
+
+func (fc *Controller) GetArchive(c *gin.Context) {
+	fc.FileService.GetArchive(c)
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (fc *Controller) ListGrants(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListGrants(userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) CreateGrant(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.GrantIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := fc.FileService.CreateGrant(userId, c.Param("fileID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (fc *Controller) DeleteGrant(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	granteeId, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, appErr := fc.FileService.DeleteGrant(userId, c.Param("fileID"), granteeId)
+	if appErr != nil {
+		httputil.NewError(c, appErr.Code, appErr.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) ListSharedWithMe(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListSharedWithMe(userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
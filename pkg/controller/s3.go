@@ -0,0 +1,9 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (sc *Controller) HandleS3(c *gin.Context) {
+	sc.S3Service.Handle(c)
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func shareKey(c *gin.Context) string {
+	if key := c.GetHeader("X-Share-Key"); key != "" {
+		return key
+	}
+	return c.Query("key")
+}
+
+func (sc *Controller) CreateShare(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ShareIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.ShareService.CreateShare(userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (sc *Controller) ListShares(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var query schemas.ShareQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.ShareService.ListShares(userId, &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) UpdateShare(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.ShareUpdate
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.ShareService.UpdateShare(userId, c.Param("shareID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) DeleteShare(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := sc.ShareService.DeleteShare(userId, c.Param("shareID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) GetShare(c *gin.Context) {
+	res, err := sc.ShareService.GetShare(c.Param("shareID"), shareKey(c))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) UnlockShare(c *gin.Context) {
+	var payload schemas.ShareUnlock
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.ShareService.UnlockShare(c.Param("shareID"), &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (sc *Controller) ListShareFiles(c *gin.Context) {
+	query := schemas.ShareFileQuery{
+		PerPage: 500,
+		Order:   "asc",
+		Sort:    "name",
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := sc.ShareService.ListShareFiles(c.Param("shareID"), shareKey(c), &query)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
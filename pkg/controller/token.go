@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (tc *Controller) ListTokens(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := tc.TokenService.ListTokens(userId)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (tc *Controller) CreateToken(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	var payload schemas.APITokenIn
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		httputil.NewError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := tc.TokenService.CreateToken(userId, &payload)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (tc *Controller) RevokeToken(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := tc.TokenService.RevokeToken(userId, c.Param("id"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
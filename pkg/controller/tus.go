@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (tc *Controller) TusOptions(c *gin.Context) {
+	tc.TusService.Options(c)
+}
+
+func (tc *Controller) TusCreate(c *gin.Context) {
+	tc.TusService.Create(c)
+}
+
+func (tc *Controller) TusHead(c *gin.Context) {
+	tc.TusService.Head(c)
+}
+
+func (tc *Controller) TusPatch(c *gin.Context) {
+	tc.TusService.Patch(c)
+}
+
+func (tc *Controller) TusDelete(c *gin.Context) {
+	tc.TusService.Delete(c)
+}
@@ -37,6 +37,16 @@ func (uc *Controller) ListChannels(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (uc *Controller) ListChannelStats(c *gin.Context) {
+	res, err := uc.UserService.ListChannelStats(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
 func (uc *Controller) AddBots(c *gin.Context) {
 	res, err := uc.UserService.AddBots(c)
 	if err != nil {
@@ -62,3 +72,63 @@ func (uc *Controller) GetProfilePhoto(c *gin.Context) {
 		uc.UserService.GetProfilePhoto(c)
 	}
 }
+
+func (uc *Controller) ListAccessKeys(c *gin.Context) {
+	res, err := uc.UserService.ListAccessKeys(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) CreateAccessKey(c *gin.Context) {
+	res, err := uc.UserService.CreateAccessKey(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (uc *Controller) DeleteAccessKey(c *gin.Context) {
+	res, err := uc.UserService.DeleteAccessKey(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) ListEncryptionKeys(c *gin.Context) {
+	res, err := uc.UserService.ListEncryptionKeys(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (uc *Controller) CreateEncryptionKey(c *gin.Context) {
+	res, err := uc.UserService.CreateEncryptionKey(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+func (uc *Controller) RetireEncryptionKey(c *gin.Context) {
+	res, err := uc.UserService.RetireEncryptionKey(c)
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+func (fc *Controller) ListVersions(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.ListVersions(userId, c.Param("fileID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) RestoreVersion(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.RestoreVersion(c, userId, c.Param("fileID"), c.Param("versionID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (fc *Controller) DeleteVersion(c *gin.Context) {
+	userId, _ := services.GetUserAuth(c)
+
+	res, err := fc.FileService.DeleteVersion(userId, c.Param("fileID"), c.Param("versionID"))
+	if err != nil {
+		httputil.NewError(c, err.Code, err.Error)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,9 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func (wc *Controller) HandleWebdav(c *gin.Context) {
+	wc.WebdavService.Handle(c)
+}
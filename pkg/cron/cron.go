@@ -7,10 +7,13 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/chunkcache"
 	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/kv"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
 	"github.com/divyam234/teldrive/pkg/services"
 	"github.com/go-co-op/gocron"
 	"github.com/gotd/td/tg"
@@ -20,8 +23,9 @@ import (
 
 type Files []File
 type File struct {
-	ID    string        `json:"id"`
-	Parts []models.Part `json:"parts"`
+	ID        string        `json:"id"`
+	Parts     []models.Part `json:"parts"`
+	Thumbnail *models.Part  `json:"thumbnail"`
 }
 
 func (a Files) Value() (driver.Value, error) {
@@ -65,15 +69,18 @@ type UploadResult struct {
 type CronService struct {
 	db     *gorm.DB
 	cnf    *config.Config
+	kv     kv.KV
 	logger *zap.SugaredLogger
 }
 
-func StartCronJobs(db *gorm.DB, cnf *config.Config) {
+func StartCronJobs(db *gorm.DB, cnf *config.Config, kv kv.KV) {
 	scheduler := gocron.NewScheduler(time.UTC)
 
 	ctx := context.Background()
 
-	cron := CronService{db: db, cnf: cnf, logger: logging.DefaultLogger()}
+	cron := CronService{db: db, cnf: cnf, kv: kv, logger: logging.DefaultLogger()}
+
+	scheduler.Every(1).Hour().Do(cron.PruneVersions)
 
 	scheduler.Every(1).Hour().Do(cron.CleanFiles, ctx)
 
@@ -81,14 +88,30 @@ func StartCronJobs(db *gorm.DB, cnf *config.Config) {
 
 	scheduler.Every(12).Hour().Do(cron.CleanUploads, ctx)
 
+	scheduler.Every(1).Hour().Do(cron.ChunkCacheStats)
+
+	scheduler.Every(1).Hour().Do(cron.RotateKeys, ctx)
+
+	scheduler.Every(10).Minutes().Do(cron.ResumeChannelMoves, ctx)
+
+	scheduler.Every(1).Hour().Do(cron.UpdateChannels, ctx)
+
+	if cnf.Orphans.Interval > 0 {
+		scheduler.Every(cnf.Orphans.Interval).Do(cron.ReconcileOrphans, ctx)
+	}
+
 	scheduler.StartAsync()
 }
 
 func (c *CronService) CleanFiles(ctx context.Context) {
 
+	c.purgeTrash()
+
+	c.cleanVersions(ctx)
+
 	var results []Result
 	if err := c.db.Model(&models.File{}).
-		Select("JSONB_AGG(jsonb_build_object('id',files.id, 'parts',files.parts)) as files", "files.channel_id", "files.user_id", "s.session").
+		Select("JSONB_AGG(jsonb_build_object('id',files.id, 'parts',files.parts, 'thumbnail',files.thumbnail)) as files", "files.channel_id", "files.user_id", "s.session").
 		Joins("left join teldrive.users as u  on u.user_id = files.user_id").
 		Joins("left join (select * from teldrive.sessions order by created_at desc limit 1) as s on u.user_id = s.user_id").
 		Where("type = ?", "file").
@@ -112,6 +135,9 @@ func (c *CronService) CleanFiles(ctx context.Context) {
 			for _, part := range file.Parts {
 				ids = append(ids, int(part.ID))
 			}
+			if file.Thumbnail != nil {
+				ids = append(ids, int(file.Thumbnail.ID))
+			}
 
 		}
 		err := deleteTGMessages(ctx, c.cnf, row.Session, row.ChannelId, row.UserId, ids)
@@ -125,8 +151,153 @@ func (c *CronService) CleanFiles(ctx context.Context) {
 	}
 }
 
+// pendingVersions groups the versions pending deletion by channel and user along with the
+// latest session of the user.
+func (c *CronService) pendingVersions() ([]Result, error) {
+	var results []Result
+	err := c.db.Model(&models.FileVersion{}).
+		Select("JSONB_AGG(jsonb_build_object('id',file_versions.id, 'parts',file_versions.parts, "+
+			"'thumbnail',file_versions.thumbnail)) as files",
+			"file_versions.channel_id", "file_versions.user_id", "s.session").
+		Joins("left join (select distinct on (user_id) * from teldrive.sessions order by user_id, created_at desc) as s "+
+			"on s.user_id = file_versions.user_id").
+		Where("file_versions.status = ?", "pending_deletion").
+		Group("file_versions.channel_id").Group("file_versions.user_id").Group("s.session").
+		Scan(&results).Error
+	return results, err
+}
+
+func (c *CronService) cleanVersions(ctx context.Context) {
+	results, err := c.pendingVersions()
+	if err != nil {
+		c.logger.Errorw("failed to find pending versions", "err", err)
+		return
+	}
+
+	for _, row := range results {
+		// The versions of users without a session are deleted once they log in again.
+		if row.Session == "" {
+			continue
+		}
+		ids := []int{}
+
+		versionIds := []string{}
+
+		for _, version := range row.Files {
+			versionIds = append(versionIds, version.ID)
+			for _, part := range version.Parts {
+				ids = append(ids, int(part.ID))
+			}
+			if version.Thumbnail != nil {
+				ids = append(ids, int(version.Thumbnail.ID))
+			}
+		}
+		err := deleteTGMessages(ctx, c.cnf, row.Session, row.ChannelId, row.UserId, ids)
+		if err != nil {
+			c.logger.Errorw("failed to clean versions", err)
+			continue
+		}
+		c.db.Where("id IN ?", versionIds).Delete(&models.FileVersion{})
+		c.logger.Infow("cleaned versions", "user", row.UserId, "channel", row.ChannelId)
+	}
+}
+
+func (c *CronService) PruneVersions() {
+	count, err := services.PruneVersions(c.db, &c.cnf.Versions)
+	if err != nil {
+		c.logger.Errorw("failed to prune versions", "err", err)
+		return
+	}
+	if count > 0 {
+		c.logger.Infow("pruned versions", "versions", count)
+	}
+}
+
+func (c *CronService) ChunkCacheStats() {
+	cache, _ := chunkcache.Default()
+	if cache == nil {
+		return
+	}
+	stats := cache.Stats()
+	c.logger.Infow("chunk cache", "hits", stats.Hits, "misses", stats.Misses, "evictions", stats.Evictions,
+		"skipped", stats.Skipped, "entries", stats.Entries, "size", stats.Size)
+}
+
+func (c *CronService) RotateKeys(ctx context.Context) {
+	if c.cnf.TG.Uploads.KeyRotationBatch <= 0 || c.cnf.TG.Uploads.EncryptionKey == "" {
+		return
+	}
+	count, err := services.NewFileService(c.db, c.cnf, nil).RotateKeys(ctx, c.cnf.TG.Uploads.KeyRotationBatch)
+	if err != nil {
+		c.logger.Errorw("failed to rotate encryption keys", "err", err)
+		return
+	}
+	if count > 0 {
+		c.logger.Infow("rotated encryption keys", "files", count)
+	}
+}
+
+// UpdateChannels recounts the contents of the channels and replaces the default channels
+// that are full.
+func (c *CronService) UpdateChannels(ctx context.Context) {
+	if err := services.UpdateChannelStats(c.db); err != nil {
+		c.logger.Errorw("failed to update channel stats", "err", err)
+		return
+	}
+	count, err := services.NewUserService(c.db, c.cnf, c.kv).RolloverChannels(ctx)
+	if err != nil {
+		c.logger.Errorw("failed to roll over channels", "err", err)
+		return
+	}
+	if count > 0 {
+		c.logger.Infow("rolled over channels", "channels", count)
+	}
+}
+
+func (c *CronService) ResumeChannelMoves(ctx context.Context) {
+	count, err := services.NewFileService(c.db, c.cnf, nil).ResumeChannelMoves(ctx)
+	if err != nil {
+		c.logger.Errorw("failed to resume channel moves", "err", err)
+		return
+	}
+	if count > 0 {
+		c.logger.Infow("resumed channel moves", "moves", count)
+	}
+}
+
+func (c *CronService) ReconcileOrphans(ctx context.Context) {
+	_, err := services.NewFileService(c.db, c.cnf, nil).ReconcileOrphans(ctx,
+		&schemas.OrphansIn{Delete: c.cnf.Orphans.Delete})
+	if err != nil {
+		c.logger.Errorw("failed to reconcile orphaned messages", "err", err)
+	}
+}
+
+func (c *CronService) purgeTrash() {
+	var ids []string
+	if err := c.db.Model(&models.File{}).Where("status = ?", "trashed").Where("id = trash_root_id").
+		Where("trashed_at < ?", time.Now().UTC().Add(-c.cnf.Trash.Retention)).
+		Pluck("id", &ids).Error; err != nil {
+		c.logger.Errorw("failed to find expired trash", "err", err)
+		return
+	}
+	if err := services.PurgeTrash(c.db, ids); err != nil {
+		c.logger.Errorw("failed to purge trash", "err", err)
+		return
+	}
+	if len(ids) > 0 {
+		c.logger.Infow("purged trash", "items", len(ids))
+	}
+}
+
 func (c *CronService) CleanUploads(ctx context.Context) {
 
+	if count, err := services.ExpireTusUploads(c.db, &c.cnf.TG); err != nil {
+		c.logger.Errorw("failed to expire tus uploads", "err", err)
+	} else if count > 0 {
+		c.logger.Infow("expired tus uploads", "uploads", count)
+	}
+
 	var upResults []UploadResult
 	if err := c.db.Model(&models.Upload{}).
 		Select("JSONB_AGG(uploads.part_id) as parts", "uploads.channel_id", "uploads.user_id", "s.session").
@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	db := database.NewTestDatabase(t, false)
+	db.Where("id is not NULL").Delete(&models.File{})
+
+	c := &CronService{db: db, cnf: &config.Config{Trash: config.TrashConfig{Retention: time.Hour}},
+		logger: zap.NewNop().Sugar()}
+
+	trashed := func(id, root, fileType string, trashedAt time.Time) models.File {
+		return models.File{ID: id, Name: id, Type: fileType, MimeType: "text/plain", UserID: 123456,
+			Status: "trashed", TrashRootID: &root, TrashedAt: &trashedAt}
+	}
+
+	expired, recent := time.Now().UTC().Add(-2*time.Hour), time.Now().UTC().Add(-time.Minute)
+
+	require.NoError(t, db.Create([]models.File{
+		trashed("old", "old", "folder", expired),
+		trashed("old-file", "old", "file", expired),
+		trashed("new", "new", "file", recent),
+	}).Error)
+
+	c.purgeTrash()
+
+	var files []models.File
+	require.NoError(t, db.Order("id").Find(&files).Error)
+
+	status := map[string]string{}
+	for _, file := range files {
+		status[file.ID] = file.Status
+	}
+	assert.Equal(t, map[string]string{"old-file": "pending_deletion", "new": "trashed"}, status)
+}
+
+func TestPendingVersions(t *testing.T) {
+	db := database.NewTestDatabase(t, false)
+	db.Where("id is not NULL").Delete(&models.FileVersion{})
+
+	c := &CronService{db: db, cnf: &config.Config{}, logger: zap.NewNop().Sugar()}
+
+	now := time.Now().UTC()
+
+	require.NoError(t, db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create([]models.User{{UserId: 111}, {UserId: 222}, {UserId: 333}}).Error)
+	db.Where("user_id IN ?", []int64{111, 222, 333}).Delete(&models.Session{})
+	for _, session := range []struct {
+		user      int64
+		name      string
+		createdAt time.Time
+	}{{111, "old", now.Add(-time.Hour)}, {111, "new", now}, {222, "other", now.Add(-time.Hour)}} {
+		require.NoError(t, db.Exec("INSERT INTO teldrive.sessions (session, user_id, hash, created_at) VALUES (?, ?, ?, ?)",
+			session.name, session.user, session.name, session.createdAt).Error)
+	}
+
+	require.NoError(t, db.Create([]models.FileVersion{
+		{ID: "v1", UserID: 111, ChannelID: 1, Status: "pending_deletion"},
+		{ID: "v2", UserID: 222, ChannelID: 1, Status: "pending_deletion"},
+		{ID: "v3", UserID: 333, ChannelID: 1, Status: "pending_deletion"},
+		{ID: "v4", UserID: 111, ChannelID: 1, Status: "active"},
+	}).Error)
+
+	results, err := c.pendingVersions()
+	require.NoError(t, err)
+
+	sessions := map[int64]string{}
+	for _, row := range results {
+		sessions[row.UserId] = row.Session
+		assert.Len(t, row.Files, 1)
+	}
+	assert.Equal(t, map[int64]string{111: "new", 222: "other", 333: ""}, sessions)
+}
@@ -0,0 +1,121 @@
+package httputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns a strong entity tag derived from values.
+func ETag(values ...string) string {
+	return fmt.Sprintf("\"%s\"", md5.FromString(strings.Join(values, ":")))
+}
+
+// NotModified reports whether a GET or HEAD request can be answered with 304 Not Modified.
+// If-None-Match takes precedence over If-Modified-Since as required by RFC 9110.
+func NotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag, false)
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modTime.IsZero() {
+		return false
+	}
+
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	return !modTime.Truncate(time.Second).After(t)
+}
+
+// RangeApplies reports whether the Range header of r should be honored. A Range with an
+// If-Range that no longer matches the representation is ignored and the full content
+// is sent instead.
+func RangeApplies(r *http.Request, etag string, modTime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ir, "\"") || strings.HasPrefix(ir, "W/") {
+		return matchETag(ir, etag, true)
+	}
+
+	if modTime.IsZero() {
+		return false
+	}
+
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+
+	return modTime.Truncate(time.Second).Equal(t)
+}
+
+// matchETag reports whether etag is in the comma separated list header. Weak tags only
+// match when strong is false.
+func matchETag(header, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" && !strong {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteNotModified sends a 304 response. Headers describing the body are removed since
+// there is none.
+func WriteNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// ConditionalJSON writes obj as JSON with an ETag of its encoding and a Last-Modified of
+// modTime, or 304 Not Modified when the client already has it.
+func ConditionalJSON(c *gin.Context, obj any, modTime time.Time) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		NewError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	etag := ETag(string(body))
+
+	c.Header("ETag", etag)
+	if !modTime.IsZero() {
+		c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if NotModified(c.Request, etag, modTime) {
+		WriteNotModified(c.Writer)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
@@ -0,0 +1,48 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var modTime = time.Date(2024, 6, 1, 10, 0, 0, 500, time.UTC)
+
+func request(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestNotModified(t *testing.T) {
+	etag := ETag("id", "10")
+
+	assert.False(t, NotModified(request(nil), etag, modTime))
+	assert.True(t, NotModified(request(map[string]string{"If-None-Match": etag}), etag, modTime))
+	assert.True(t, NotModified(request(map[string]string{"If-None-Match": `"other", W/` + etag}), etag, modTime))
+	assert.True(t, NotModified(request(map[string]string{"If-None-Match": "*"}), etag, modTime))
+	assert.False(t, NotModified(request(map[string]string{"If-None-Match": `"other"`}), etag, modTime))
+
+	since := modTime.Format(http.TimeFormat)
+	assert.True(t, NotModified(request(map[string]string{"If-Modified-Since": since}), etag, modTime))
+	assert.False(t, NotModified(request(map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)}), etag, modTime))
+
+	// If-None-Match wins over If-Modified-Since.
+	assert.False(t, NotModified(request(map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": since}), etag, modTime))
+}
+
+func TestRangeApplies(t *testing.T) {
+	etag := ETag("id", "10")
+
+	assert.True(t, RangeApplies(request(nil), etag, modTime))
+	assert.True(t, RangeApplies(request(map[string]string{"If-Range": etag}), etag, modTime))
+	assert.False(t, RangeApplies(request(map[string]string{"If-Range": "W/" + etag}), etag, modTime))
+	assert.False(t, RangeApplies(request(map[string]string{"If-Range": `"other"`}), etag, modTime))
+	assert.True(t, RangeApplies(request(map[string]string{"If-Range": modTime.Format(http.TimeFormat)}), etag, modTime))
+	assert.False(t, RangeApplies(request(map[string]string{"If-Range": modTime.Add(time.Hour).Format(http.TimeFormat)}), etag, modTime))
+}
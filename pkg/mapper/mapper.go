@@ -10,35 +10,57 @@ func ToFileOut(file models.File) *schemas.FileOut {
 	if file.Size != nil {
 		size = *file.Size
 	}
-	return &schemas.FileOut{
-		ID:        file.ID,
-		Name:      file.Name,
-		Type:      file.Type,
-		MimeType:  file.MimeType,
-		Category:  file.Category,
-		Path:      file.Path,
-		Size:      size,
-		Starred:   file.Starred,
-		ParentID:  file.ParentID,
-		UpdatedAt: file.UpdatedAt,
+	out := &schemas.FileOut{
+		ID:           file.ID,
+		Name:         file.Name,
+		Type:         file.Type,
+		MimeType:     file.MimeType,
+		Category:     file.Category,
+		Path:         file.Path,
+		Size:         size,
+		Starred:      file.Starred,
+		ParentID:     file.ParentID,
+		UpdatedAt:    file.UpdatedAt,
+		HasThumbnail: file.Thumbnail != nil,
 	}
+	if file.Sha256 != nil {
+		out.Sha256 = *file.Sha256
+	}
+	if file.Md5 != nil {
+		out.Md5 = *file.Md5
+	}
+	return out
 }
 
 func ToFileOutFull(file models.File) *schemas.FileOutFull {
 	parts := []schemas.Part{}
-	for _, part := range *file.Parts {
-		parts = append(parts, schemas.Part{
-			ID:   part.ID,
-			Salt: part.Salt,
-		})
+	if file.Parts != nil {
+		for _, part := range *file.Parts {
+			parts = append(parts, schemas.Part{
+				ID:     part.ID,
+				Salt:   part.Salt,
+				KeyID:  part.KeyID,
+				Sha256: part.Sha256,
+				Md5:    part.Md5,
+			})
+		}
 	}
 
-	return &schemas.FileOutFull{
+	var channelId int64
+	if file.ChannelID != nil {
+		channelId = *file.ChannelID
+	}
+
+	out := &schemas.FileOutFull{
 		FileOut:   ToFileOut(file),
 		Parts:     parts,
-		ChannelID: *file.ChannelID,
+		ChannelID: channelId,
 		Encrypted: file.Encrypted,
 	}
+	if file.Thumbnail != nil {
+		out.Thumbnail = &schemas.Part{ID: file.Thumbnail.ID, Salt: file.Thumbnail.Salt, KeyID: file.Thumbnail.KeyID}
+	}
+	return out
 }
 
 func ToUploadOut(in *models.Upload) *schemas.UploadPartOut {
@@ -50,6 +72,9 @@ func ToUploadOut(in *models.Upload) *schemas.UploadPartOut {
 		Size:      in.Size,
 		Encrypted: in.Encrypted,
 		Salt:      in.Salt,
+		KeyID:     in.KeyID,
+		Sha256:    in.Sha256,
+		Md5:       in.Md5,
 	}
 	return out
 }
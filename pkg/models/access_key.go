@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+type AccessKey struct {
+	AccessKeyID string    `gorm:"type:text;primaryKey"`
+	SecretKey   string    `gorm:"type:text"`
+	Name        string    `gorm:"type:text"`
+	UserID      int64     `gorm:"type:bigint"`
+	CreatedAt   time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// APIToken is a long-lived token for scripts, only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID         string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID     int64      `gorm:"type:bigint"`
+	Name       string     `gorm:"type:text"`
+	TokenHash  string     `gorm:"type:text"`
+	Scopes     []string   `gorm:"type:jsonb;serializer:json"`
+	Path       string     `gorm:"type:text"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp"`
+	LastUsedAt *time.Time `gorm:"type:timestamp"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -5,4 +5,6 @@ type Channel struct {
 	ChannelName string `gorm:"type:text"`
 	UserID      int64  `gorm:"type:bigint;"`
 	Selected    bool   `gorm:"type:boolean;"`
+	Messages    int64  `gorm:"type:bigint"`
+	Size        int64  `gorm:"type:bigint"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+type ChannelMove struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	UserID    int64     `gorm:"type:bigint"`
+	FileID    string    `gorm:"type:text"`
+	ChannelID int64     `gorm:"type:bigint"`
+	Status    string    `gorm:"type:text"`
+	Files     int       `gorm:"type:integer"`
+	Moved     int       `gorm:"type:integer"`
+	Failed    int       `gorm:"type:integer"`
+	Error     *string   `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
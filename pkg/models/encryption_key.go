@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type EncryptionKey struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement"`
+	UserID     int64      `gorm:"type:bigint"`
+	FolderID   *string    `gorm:"type:text"`
+	WrappedKey string     `gorm:"type:text"`
+	Status     string     `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	RetiredAt  *time.Time `gorm:"type:timestamp"`
+}
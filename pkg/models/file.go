@@ -7,29 +7,38 @@ import (
 )
 
 type File struct {
-	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
-	Name      string    `gorm:"type:text;not null"`
-	Type      string    `gorm:"type:text;not null"`
-	MimeType  string    `gorm:"type:text;not null"`
-	Path      string    `gorm:"type:text;index"`
-	Size      *int64    `gorm:"type:bigint"`
-	Starred   bool      `gorm:"default:false"`
-	Depth     *int      `gorm:"type:integer"`
-	Category  string    `gorm:"type:text"`
-	Encrypted bool      `gorm:"default:false"`
-	UserID    int64     `gorm:"type:bigint;not null"`
-	Status    string    `gorm:"type:text"`
-	ParentID  string    `gorm:"type:text;index"`
-	Parts     *Parts    `gorm:"type:jsonb"`
-	ChannelID *int64    `gorm:"type:bigint"`
-	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
-	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	ID          string     `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	Name        string     `gorm:"type:text;not null"`
+	Type        string     `gorm:"type:text;not null"`
+	MimeType    string     `gorm:"type:text;not null"`
+	Path        string     `gorm:"type:text;index"`
+	Size        *int64     `gorm:"type:bigint"`
+	Starred     bool       `gorm:"default:false"`
+	Depth       *int       `gorm:"type:integer"`
+	Category    string     `gorm:"type:text"`
+	Encrypted   bool       `gorm:"default:false"`
+	UserID      int64      `gorm:"type:bigint;not null"`
+	Status      string     `gorm:"type:text"`
+	ParentID    string     `gorm:"type:text;index"`
+	Parts       *Parts     `gorm:"type:jsonb"`
+	ChannelID   *int64     `gorm:"type:bigint"`
+	Sha256      *string    `gorm:"type:text"`
+	Md5         *string    `gorm:"type:text"`
+	Thumbnail   *Part      `gorm:"type:jsonb;serializer:json"`
+	TrashedAt   *time.Time `gorm:"type:timestamp"`
+	TrashRootID *string    `gorm:"type:text"`
+	TrashPath   *string    `gorm:"type:text"`
+	CreatedAt   time.Time  `gorm:"default:timezone('utc'::text, now())"`
+	UpdatedAt   time.Time  `gorm:"default:timezone('utc'::text, now())"`
 }
 
 type Parts []Part
 type Part struct {
-	ID   int64  `json:"id"`
-	Salt string `json:"salt,omitempty"`
+	ID     int64  `json:"id"`
+	Salt   string `json:"salt,omitempty"`
+	KeyID  int64  `json:"keyId,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	Md5    string `json:"md5,omitempty"`
 }
 
 func (a Parts) Value() (driver.Value, error) {
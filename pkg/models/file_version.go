@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+type FileVersion struct {
+	ID         string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	FileID     string    `gorm:"type:text"`
+	UserID     int64     `gorm:"type:bigint"`
+	Parts      *Parts    `gorm:"type:jsonb"`
+	Size       int64     `gorm:"type:bigint"`
+	ChannelID  int64     `gorm:"type:bigint"`
+	MimeType   string    `gorm:"type:text"`
+	Encrypted  bool      `gorm:"default:false"`
+	Sha256     *string   `gorm:"type:text"`
+	Md5        *string   `gorm:"type:text"`
+	Thumbnail  *Part     `gorm:"type:jsonb;serializer:json"`
+	Status     string    `gorm:"type:text"`
+	ModifiedAt time.Time `gorm:"type:timestamp"`
+	CreatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
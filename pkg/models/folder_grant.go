@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// FolderGrant gives another user access to a folder and everything below it.
+type FolderGrant struct {
+	ID        string    `gorm:"type:text;primaryKey;default:generate_uid(16)"`
+	FolderID  string    `gorm:"type:text"`
+	UserID    int64     `gorm:"type:bigint"`
+	Role      string    `gorm:"type:text"`
+	CreatedBy int64     `gorm:"type:bigint"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+type Share struct {
+	ID           string     `gorm:"type:text;primaryKey"`
+	FileID       string     `gorm:"type:text"`
+	UserID       int64      `gorm:"type:bigint"`
+	Password     string     `gorm:"type:text"`
+	ExpiresAt    *time.Time `gorm:"type:timestamp"`
+	MaxDownloads *int       `gorm:"type:integer"`
+	Downloads    int        `gorm:"type:integer;default:0"`
+	CreatedAt    time.Time  `gorm:"default:timezone('utc'::text, now())"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+type TusUpload struct {
+	ID        string    `gorm:"type:text;primaryKey"`
+	UserID    int64     `gorm:"type:bigint"`
+	Name      string    `gorm:"type:text"`
+	Path      string    `gorm:"type:text"`
+	MimeType  string    `gorm:"type:text"`
+	ChannelID int64     `gorm:"type:bigint"`
+	Encrypted bool      `gorm:"default:false"`
+	Length    int64     `gorm:"type:bigint"`
+	PartSize  int64     `gorm:"type:bigint"`
+	Metadata  string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	ExpiresAt time.Time `gorm:"type:timestamp"`
+}
@@ -14,5 +14,9 @@ type Upload struct {
 	Salt      string    `gorm:"type:text"`
 	ChannelID int64     `gorm:"type:bigint"`
 	Size      int64     `gorm:"type:bigint"`
+	Sha256    string    `gorm:"type:text"`
+	Md5       string    `gorm:"type:text"`
+	HashState []byte    `gorm:"type:bytea"`
+	KeyID     int64     `gorm:"type:bigint"`
 	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
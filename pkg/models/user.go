@@ -5,10 +5,13 @@ import (
 )
 
 type User struct {
-	UserId    int64     `gorm:"type:bigint;primaryKey"`
-	Name      string    `gorm:"type:text"`
-	UserName  string    `gorm:"type:text"`
-	IsPremium bool      `gorm:"type:bool"`
-	UpdatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
-	CreatedAt time.Time `gorm:"default:timezone('utc'::text, now())"`
+	UserId    int64  `gorm:"type:bigint;primaryKey"`
+	Name      string `gorm:"type:text"`
+	UserName  string `gorm:"type:text"`
+	IsPremium bool   `gorm:"type:bool"`
+	// QuotaSize and QuotaFiles override the quota of the server when set, 0 is unlimited.
+	QuotaSize  *int64    `gorm:"type:bigint"`
+	QuotaFiles *int64    `gorm:"type:bigint"`
+	UpdatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
+	CreatedAt  time.Time `gorm:"default:timezone('utc'::text, now())"`
 }
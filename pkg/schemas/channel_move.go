@@ -0,0 +1,23 @@
+package schemas
+
+import "time"
+
+type ChannelMoveIn struct {
+	// ID is the file or folder whose parts are moved.
+	ID        string `json:"id" binding:"required"`
+	ChannelID int64  `json:"channelId" binding:"required"`
+}
+
+type ChannelMoveOut struct {
+	ID        string `json:"id"`
+	FileID    string `json:"fileId"`
+	ChannelID int64  `json:"channelId"`
+	// Status is pending, running, done or failed.
+	Status    string    `json:"status"`
+	Files     int       `json:"files"`
+	Moved     int       `json:"moved"`
+	Failed    int       `json:"failed"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,31 @@
+package schemas
+
+type CheckIn struct {
+	UserID     int64 `json:"userId"`
+	ChannelID  int64 `json:"channelId"`
+	Quarantine bool  `json:"quarantine"`
+}
+
+type CheckIssue struct {
+	FileID    string `json:"fileId"`
+	Name      string `json:"name"`
+	UserID    int64  `json:"userId"`
+	ChannelID int64  `json:"channelId"`
+	// Issue is missing, size_mismatch or duplicate.
+	Issue string `json:"issue"`
+	// PartNo is the part the issue was found in, 0 for the file as a whole.
+	PartNo       int   `json:"partNo,omitempty"`
+	MessageID    int64 `json:"messageId,omitempty"`
+	ExpectedSize int64 `json:"expectedSize,omitempty"`
+	ActualSize   int64 `json:"actualSize,omitempty"`
+	// DuplicateOf is the file whose part references the same message.
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+type CheckReport struct {
+	Files       int          `json:"files"`
+	Parts       int          `json:"parts"`
+	Broken      int          `json:"broken"`
+	Quarantined int          `json:"quarantined"`
+	Issues      []CheckIssue `json:"issues"`
+}
@@ -5,8 +5,11 @@ import (
 )
 
 type Part struct {
-	ID   int64  `json:"id"`
-	Salt string `json:"salt"`
+	ID     int64  `json:"id"`
+	Salt   string `json:"salt"`
+	KeyID  int64  `json:"keyId,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	Md5    string `json:"md5,omitempty"`
 }
 
 type FileQuery struct {
@@ -19,6 +22,7 @@ type FileQuery struct {
 	ParentID      string     `form:"parentId"`
 	Category      string     `form:"category"`
 	UpdatedAt     *time.Time `form:"updatedAt"`
+	Hash          string     `form:"hash"`
 	Sort          string     `form:"sort"`
 	Order         string     `form:"order"`
 	PerPage       int        `form:"perPage"`
@@ -31,24 +35,28 @@ type FileIn struct {
 	Parts     []Part `json:"parts,omitempty"`
 	MimeType  string `json:"mimeType"`
 	ChannelID int64  `json:"channelId"`
-	Path      string `json:"path" binding:"required"`
+	Path      string `json:"path" binding:"required_without=ParentID"`
 	Size      int64  `json:"size"`
+	// ParentID creates the file in a folder shared with the user instead of at Path.
 	ParentID  string `json:"parentId"`
 	Encrypted bool   `json:"encrypted"`
 }
 
 type FileOut struct {
-	ID         string    `json:"id"`
-	Name       string    `json:"name"`
-	Type       string    `json:"type"`
-	MimeType   string    `json:"mimeType"`
-	Category   string    `json:"category,omitempty"`
-	Path       string    `json:"path,omitempty"`
-	Size       int64     `json:"size,omitempty"`
-	Starred    bool      `json:"starred"`
-	ParentID   string    `json:"parentId,omitempty"`
-	ParentPath string    `json:"parentPath,omitempty"`
-	UpdatedAt  time.Time `json:"updatedAt,omitempty"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	MimeType     string    `json:"mimeType"`
+	Category     string    `json:"category,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	Starred      bool      `json:"starred"`
+	ParentID     string    `json:"parentId,omitempty"`
+	ParentPath   string    `json:"parentPath,omitempty"`
+	Sha256       string    `json:"sha256,omitempty"`
+	Md5          string    `json:"md5,omitempty"`
+	HasThumbnail bool      `json:"hasThumbnail,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt,omitempty"`
 }
 
 type FileOutFull struct {
@@ -56,6 +64,7 @@ type FileOutFull struct {
 	Parts     []Part `json:"parts,omitempty"`
 	ChannelID int64  `json:"channelId"`
 	Encrypted bool   `json:"encrypted"`
+	Thumbnail *Part  `json:"thumbnail,omitempty"`
 }
 
 type FileUpdate struct {
@@ -75,6 +84,8 @@ type FileResponse struct {
 type FileOperation struct {
 	Files       []string `json:"files"  binding:"required"`
 	Destination string   `json:"destination,omitempty"`
+	// DestinationID moves the files to a folder shared with the user instead of Destination.
+	DestinationID string `json:"destinationId,omitempty"`
 }
 
 type DirMove struct {
@@ -89,7 +100,9 @@ type MkDir struct {
 type Copy struct {
 	ID          string `json:"id" binding:"required"`
 	Name        string `json:"name" binding:"required"`
-	Destination string `json:"destination" binding:"required"`
+	Destination string `json:"destination" binding:"required_without=DestinationID"`
+	// DestinationID copies the file to a folder shared with the user instead of Destination.
+	DestinationID string `json:"destinationId,omitempty"`
 }
 
 type FileCategoryStats struct {
@@ -97,3 +110,37 @@ type FileCategoryStats struct {
 	TotalSize  int    `json:"totalSize"`
 	Category   string `json:"category"`
 }
+
+type TrashQuery struct {
+	PerPage       int    `form:"perPage"`
+	NextPageToken string `form:"nextPageToken"`
+}
+
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	MimeType     string    `json:"mimeType"`
+	Size         int64     `json:"size,omitempty"`
+	OriginalPath string    `json:"originalPath"`
+	TrashedAt    time.Time `json:"trashedAt"`
+}
+
+type TrashResponse struct {
+	Items         []TrashItem `json:"results"`
+	NextPageToken string      `json:"nextPageToken,omitempty"`
+}
+
+type FileVersionOut struct {
+	ID        string    `json:"id"`
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mimeType"`
+	Sha256    string    `json:"sha256,omitempty"`
+	Md5       string    `json:"md5,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ArchiveQuery struct {
+	Files []string `form:"files" json:"files" binding:"required,min=1"`
+}
@@ -0,0 +1,32 @@
+package schemas
+
+import (
+	"time"
+)
+
+// GrantIn names the grantee by user ID or by Telegram user name.
+type GrantIn struct {
+	UserID   int64  `json:"userId"`
+	UserName string `json:"userName"`
+	Role     string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+type GrantOut struct {
+	ID        string    `json:"id"`
+	FolderID  string    `json:"folderId"`
+	UserID    int64     `json:"userId"`
+	UserName  string    `json:"userName"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SharedFolderOut struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   int64     `json:"ownerId"`
+	OwnerName string    `json:"ownerName"`
+	Role      string    `json:"role"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	SharedAt  time.Time `json:"sharedAt"`
+}
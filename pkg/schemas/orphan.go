@@ -0,0 +1,28 @@
+package schemas
+
+import "time"
+
+type OrphansIn struct {
+	UserID    int64 `json:"userId"`
+	ChannelID int64 `json:"channelId"`
+	Delete    bool  `json:"delete"`
+}
+
+type OrphanMessage struct {
+	ChannelID int64     `json:"channelId"`
+	MessageID int       `json:"messageId"`
+	Name      string    `json:"name,omitempty"`
+	Size      int64     `json:"size"`
+	Date      time.Time `json:"date"`
+	// Deleted is set when the message was deleted, orphans within the grace period are
+	// only reported.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type OrphanReport struct {
+	Channels  int             `json:"channels"`
+	Documents int             `json:"documents"`
+	Orphans   []OrphanMessage `json:"orphans"`
+	Size      int64           `json:"size"`
+	Deleted   int             `json:"deleted"`
+}
@@ -0,0 +1,23 @@
+package schemas
+
+type Quota struct {
+	// Size and Files are the limits of the user, 0 is unlimited.
+	Size      int64 `json:"size"`
+	Files     int64 `json:"files"`
+	UsedSize  int64 `json:"usedSize"`
+	UsedFiles int64 `json:"usedFiles"`
+	// UploadSize is the size of the parts uploaded for files that are not created yet.
+	UploadSize int64 `json:"uploadSize"`
+}
+
+type QuotaIn struct {
+	// Size and Files replace the limits of the user, null restores the limit of the server.
+	Size  *int64 `json:"size"`
+	Files *int64 `json:"files"`
+}
+
+type UserQuota struct {
+	UserID   int64  `json:"userId"`
+	UserName string `json:"userName"`
+	Quota
+}
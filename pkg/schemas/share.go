@@ -0,0 +1,61 @@
+package schemas
+
+import (
+	"time"
+)
+
+type ShareIn struct {
+	FileID       string     `json:"fileId" binding:"required"`
+	Password     string     `json:"password,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads *int       `json:"maxDownloads,omitempty" binding:"omitempty,min=1"`
+}
+
+type ShareUpdate struct {
+	Password     *string    `json:"password,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads *int       `json:"maxDownloads,omitempty" binding:"omitempty,min=0"`
+}
+
+type ShareOut struct {
+	ID           string     `json:"id"`
+	FileID       string     `json:"fileId"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	Protected    bool       `json:"protected"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads *int       `json:"maxDownloads,omitempty"`
+	Downloads    int        `json:"downloads"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type ShareQuery struct {
+	FileID string `form:"fileId"`
+}
+
+type ShareUnlock struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ShareUnlockOut struct {
+	Key string `json:"key"`
+}
+
+type ShareInfo struct {
+	ID        string     `json:"id"`
+	FileID    string     `json:"fileId"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	MimeType  string     `json:"mimeType"`
+	Size      int64      `json:"size,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+type ShareFileQuery struct {
+	Path          string `form:"path"`
+	Sort          string `form:"sort" binding:"omitempty,oneof=name size updatedAt"`
+	Order         string `form:"order" binding:"omitempty,oneof=asc desc"`
+	PerPage       int    `form:"perPage" binding:"omitempty,min=1,max=1000"`
+	NextPageToken string `form:"nextPageToken"`
+}
@@ -0,0 +1,25 @@
+package schemas
+
+import (
+	"time"
+)
+
+type APITokenIn struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=read write upload admin"`
+	// Path restricts the token to a folder and everything below it.
+	Path      string     `json:"path,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APITokenOut struct {
+	ID string `json:"id"`
+	// Token is only returned when the token is created.
+	Token      string     `json:"token,omitempty"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Path       string     `json:"path,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -6,6 +6,9 @@ type UploadQuery struct {
 	PartNo    int    `form:"partNo" binding:"required"`
 	ChannelID int64  `form:"channelId"`
 	Encrypted bool   `form:"encrypted"`
+	Path      string `form:"path"`
+	// ParentID stores the part for a file created in a folder shared with the user.
+	ParentID string `form:"parentId"`
 }
 
 type UploadPartOut struct {
@@ -16,6 +19,9 @@ type UploadPartOut struct {
 	Size      int64  `json:"size"`
 	Encrypted bool   `json:"encrypted"`
 	Salt      string `json:"salt"`
+	KeyID     int64  `json:"keyId,omitempty"`
+	Sha256    string `json:"sha256"`
+	Md5       string `json:"md5"`
 }
 
 type UploadOut struct {
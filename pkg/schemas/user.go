@@ -1,5 +1,9 @@
 package schemas
 
+import (
+	"time"
+)
+
 type Channel struct {
 	ChannelID   int64  `json:"channelId"`
 	ChannelName string `json:"channelName"`
@@ -8,4 +12,36 @@ type Channel struct {
 type AccountStats struct {
 	ChannelID int64    `json:"channelId,omitempty"`
 	Bots      []string `json:"bots"`
+	Quota     *Quota   `json:"quota"`
+}
+
+type AccessKeyIn struct {
+	Name string `json:"name"`
+}
+
+type AccessKeyOut struct {
+	AccessKeyID string    `json:"accessKeyId"`
+	SecretKey   string    `json:"secretKey,omitempty"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type EncryptionKeyIn struct {
+	FolderID string `json:"folderId"`
+}
+
+type EncryptionKeyOut struct {
+	ID        int64      `json:"id"`
+	FolderID  string     `json:"folderId,omitempty"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+}
+
+type ChannelStats struct {
+	ChannelID   int64  `json:"channelId"`
+	ChannelName string `json:"channelName"`
+	Selected    bool   `json:"selected"`
+	Messages    int64  `json:"messages"`
+	Size        int64  `json:"size"`
 }
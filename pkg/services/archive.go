@@ -0,0 +1,208 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type archiveEntry struct {
+	name string
+	file *models.File
+	// root is the index of the selected item the entry belongs to.
+	root int
+}
+
+// GetArchive streams the selected files and folders as a ZIP archive. Entries are
+// stored without compression and read from Telegram while the archive is written,
+// so the response has no known length. archive/zip switches to ZIP64 records for
+// entries and archives beyond 4GiB.
+func (fs *FileService) GetArchive(c *gin.Context) {
+	userId, session := GetUserAuth(c)
+
+	var query schemas.ArchiveQuery
+	if err := c.ShouldBind(&query); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := fs.archiveEntries(userId, query.Files)
+	if err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(entries) == 0 {
+		http.Error(c.Writer, errors.New("no files selected").Error(), http.StatusNotFound)
+		return
+	}
+
+	name := c.Param("fileName")
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	if c.Request.Method == "HEAD" {
+		return
+	}
+
+	logger := logging.FromContext(c)
+
+	zw := zip.NewWriter(c.Writer)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   zip.Store,
+			Modified: entry.file.UpdatedAt,
+		}
+
+		if entry.file.Type == "folder" {
+			header.Name += "/"
+			if _, err := zw.CreateHeader(header); err != nil {
+				return
+			}
+			continue
+		}
+
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return
+		}
+
+		file := mapper.ToFileOutFull(*entry.file)
+
+		if file.Size == 0 {
+			continue
+		}
+
+		client, channelUser, err := fs.getStreamClient(c, userId, session, file.ChannelID)
+		if err != nil {
+			logger.Error("archive", zap.Error(err))
+			return
+		}
+
+		if err := fs.copyRange(c, client.Tg, channelUser, file, w, 0, file.Size-1); err != nil {
+			logger.Error("archive", zap.String("name", entry.name), zap.Error(err))
+			return
+		}
+	}
+
+	zw.Close()
+}
+
+type archiveRow struct {
+	models.File
+	ParentPath string
+}
+
+// archiveEntries resolves the selected ids to the files to archive. Selected folders
+// are walked recursively and their entries are named relative to the folder's parent.
+func (fs *FileService) archiveEntries(userId int64, ids []string) ([]archiveEntry, error) {
+	var selected []models.File
+
+	if err := fs.db.Where("id IN ?", ids).Where("user_id = ?", userId).Where("status = ?", "active").
+		Order("name").Find(&selected).Error; err != nil {
+		return nil, err
+	}
+
+	entries := []archiveEntry{}
+
+	for i := range selected {
+		item := &selected[i]
+
+		if item.Type == "file" {
+			entries = append(entries, archiveEntry{name: item.Name, file: item, root: i})
+			continue
+		}
+
+		base := item.Name
+		if item.ParentID == "root" {
+			base = ""
+		} else {
+			entries = append(entries, archiveEntry{name: base, file: item, root: i})
+		}
+
+		prefix := strings.TrimSuffix(item.Path, "/") + "/"
+
+		var rows []archiveRow
+
+		if err := fs.db.Table("teldrive.files AS f").Select("f.*, p.path AS parent_path").
+			Joins("JOIN teldrive.files AS p ON p.id = f.parent_id").
+			Where("f.user_id = ?", userId).Where("f.status = ?", "active").
+			Where("p.path = ? OR left(p.path, ?) = ?", item.Path, len(prefix), prefix).
+			Order("p.path").Order("f.type DESC").Order("f.name").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		for j := range rows {
+			rel := strings.TrimPrefix(rows[j].ParentPath, item.Path)
+			entries = append(entries, archiveEntry{name: strings.TrimPrefix(path.Join(base, rel, rows[j].Name), "/"),
+				file: &rows[j].File, root: i})
+		}
+	}
+
+	for i := range entries {
+		entries[i].name = fs.names.DecryptPath(userId, entries[i].name)
+	}
+
+	uniqueEntryNames(entries)
+
+	return entries, nil
+}
+
+// uniqueEntryNames numbers entries whose name is already taken, selected items with the
+// same name from different folders are archived as "name (1).ext". The content of a
+// renamed folder moves with it.
+func uniqueEntryNames(entries []archiveEntry) {
+	used := map[string]bool{}
+	folders := map[int]map[string]string{}
+
+	for i := range entries {
+		entry := &entries[i]
+
+		dir, name := path.Split(entry.name)
+		if to, ok := folders[entry.root][strings.TrimSuffix(dir, "/")]; ok {
+			dir = to + "/"
+		}
+
+		folder := entry.file.Type == "folder"
+		unique := dir + name
+		for n := 1; used[unique]; n++ {
+			unique = dir + numberedName(name, n, folder)
+		}
+		used[unique] = true
+
+		if folder {
+			if folders[entry.root] == nil {
+				folders[entry.root] = map[string]string{}
+			}
+			folders[entry.root][entry.name] = unique
+		}
+		entry.name = unique
+	}
+}
+
+func numberedName(name string, n int, folder bool) string {
+	ext := path.Ext(name)
+	if folder || ext == name {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueEntryNames(t *testing.T) {
+	file := &models.File{Type: "file"}
+	folder := &models.File{Type: "folder"}
+
+	entries := []archiveEntry{
+		{name: "a.txt", file: file, root: 0},
+		{name: "a.txt", file: file, root: 1},
+		{name: "a.txt", file: file, root: 2},
+		{name: "docs", file: folder, root: 3},
+		{name: "docs/b.txt", file: file, root: 3},
+		{name: "docs", file: folder, root: 4},
+		{name: "docs/b.txt", file: file, root: 4},
+		{name: "docs/sub", file: folder, root: 4},
+		{name: "docs/sub/c", file: file, root: 4},
+		{name: ".env", file: file, root: 5},
+		{name: ".env", file: file, root: 6},
+	}
+
+	uniqueEntryNames(entries)
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.name)
+	}
+
+	assert.Equal(t, []string{"a.txt", "a (1).txt", "a (2).txt", "docs", "docs/b.txt", "docs (1)",
+		"docs (1)/b.txt", "docs (1)/sub", "docs (1)/sub/c", ".env", ".env (1)"}, names)
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+var channelNumber = regexp.MustCompile(`^(.*) (\d+)$`)
+
+// UpdateChannelStats recounts the messages and bytes stored in every channel. Parts and
+// thumbnails of files in any state, of versions and of unfinished uploads are counted,
+// the sizes are those of the content before encryption.
+func UpdateChannelStats(db *gorm.DB) error {
+	return db.Exec(`UPDATE teldrive.channels c SET messages = coalesce(s.messages, 0), size = coalesce(s.size, 0)
+		FROM teldrive.channels c2 LEFT JOIN (
+			SELECT channel_id, sum(messages) AS messages, sum(size) AS size FROM (
+				SELECT channel_id, jsonb_array_length(parts) + (thumbnail IS NOT NULL)::int AS messages,
+					coalesce(size, 0) AS size
+				FROM teldrive.files WHERE type = 'file' AND jsonb_typeof(parts) = 'array'
+				UNION ALL SELECT channel_id, jsonb_array_length(parts) + (thumbnail IS NOT NULL)::int, size
+				FROM teldrive.file_versions WHERE jsonb_typeof(parts) = 'array'
+				UNION ALL SELECT channel_id, 1, size FROM teldrive.uploads
+			) AS t GROUP BY channel_id
+		) AS s ON s.channel_id = c2.channel_id
+		WHERE c.channel_id = c2.channel_id`).Error
+}
+
+func (us *UserService) ListChannelStats(c *gin.Context) ([]schemas.ChannelStats, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	stats := []schemas.ChannelStats{}
+
+	if err := us.db.Model(&models.Channel{}).Where("user_id = ?", userId).
+		Order("selected DESC").Order("channel_id DESC").Scan(&stats).Error; err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+	return stats, nil
+}
+
+// RolloverChannels creates a new default channel for every user whose default channel
+// reached the configured number of messages or bytes. It returns the number of channels
+// created.
+func (us *UserService) RolloverChannels(ctx context.Context) (int, error) {
+	limits := &us.cnf.Channels
+	if limits.RolloverMessages <= 0 && limits.RolloverSize <= 0 {
+		return 0, nil
+	}
+
+	query := us.db.Where("selected = ?", true)
+	switch {
+	case limits.RolloverMessages > 0 && limits.RolloverSize > 0:
+		query = query.Where("messages >= ? OR size >= ?", limits.RolloverMessages, limits.RolloverSize)
+	case limits.RolloverMessages > 0:
+		query = query.Where("messages >= ?", limits.RolloverMessages)
+	default:
+		query = query.Where("size >= ?", limits.RolloverSize)
+	}
+
+	var channels []models.Channel
+	if err := query.Find(&channels).Error; err != nil {
+		return 0, err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	count := 0
+	for i := range channels {
+		if err := us.rolloverChannel(ctx, &channels[i]); err != nil {
+			logger.Errorw("failed to roll over channel", "user", channels[i].UserID,
+				"channel", channels[i].ChannelID, "err", err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// rolloverChannel creates a private channel with the session of the owner of full, makes
+// the bots of full admins of it and selects it as the default channel.
+func (us *UserService) rolloverChannel(ctx context.Context, full *models.Channel) error {
+	session, err := getUserSession(us.db, full.UserID)
+	if err != nil {
+		return err
+	}
+
+	client, err := tgc.AuthClient(ctx, &us.cnf.TG, session.Session)
+	if err != nil {
+		return err
+	}
+
+	name := nextChannelName(full.ChannelName)
+
+	var created *tg.Channel
+
+	err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		res, err := client.API().ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+			Broadcast: true,
+			Title:     name,
+		})
+		if err != nil {
+			return err
+		}
+		updates, ok := res.(*tg.Updates)
+		if !ok {
+			return errors.New("unexpected create channel response")
+		}
+		for _, chat := range updates.Chats {
+			if channel, ok := chat.(*tg.Channel); ok {
+				created = channel
+				return nil
+			}
+		}
+		return errors.New("created channel not found in updates")
+	})
+	if err != nil {
+		return err
+	}
+
+	channel := &models.Channel{ChannelID: created.ID, ChannelName: created.Title, UserID: full.UserID}
+	if err := us.db.Create(channel).Error; err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	tokens, err := getBotsToken(ctx, us.db, full.UserID, full.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) > 0 {
+		// The bots are added in a session of their own, the previous one has ended.
+		client, err := tgc.AuthClient(ctx, &us.cnf.TG, session.Session)
+		if err != nil {
+			return err
+		}
+		// Files are still uploaded with the session of the user when the bots can't be added.
+		if _, err := us.addBots(ctx, client, full.UserID, channel.ChannelID, tokens); err != nil {
+			logger.Warnw("failed to add bots to channel", "user", full.UserID, "channel", channel.ChannelID,
+				"err", err.Error)
+		}
+	}
+
+	if err := us.selectChannel(ctx, full.UserID, channel.ChannelID); err != nil {
+		return err
+	}
+
+	logger.Infow("rolled over channel", "user", full.UserID, "from", full.ChannelID, "to", channel.ChannelID,
+		"messages", full.Messages, "size", full.Size)
+
+	return nil
+}
+
+// selectChannel makes channelId the default channel of a user.
+func (us *UserService) selectChannel(ctx context.Context, userId, channelId int64) error {
+	err := us.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Channel{}).Where("user_id = ?", userId).Where("channel_id <> ?", channelId).
+			Update("selected", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Channel{}).Where("channel_id = ?", channelId).Update("selected", true).Error
+	})
+	if err != nil {
+		return err
+	}
+	cache.FromContext(ctx).Set(fmt.Sprintf("users:channel:%d", userId), channelId, 0)
+	return nil
+}
+
+// nextChannelName numbers the channels that follow one another, "Storage" is followed by
+// "Storage 2", which is followed by "Storage 3".
+func nextChannelName(name string) string {
+	if m := channelNumber.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return fmt.Sprintf("%s %d", m[1], n+1)
+	}
+	return name + " 2"
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"gorm.io/gorm"
+)
+
+// channelMoveStale is how long a running move may go without progress before it is
+// considered abandoned, by a server that stopped, and started again.
+const channelMoveStale = time.Hour
+
+var (
+	errChannelMoveNotFound = errors.New("channel move not found")
+	errFileChanged         = errors.New("file changed while its parts were moved")
+)
+
+func toChannelMoveOut(job *models.ChannelMove) *schemas.ChannelMoveOut {
+	out := &schemas.ChannelMoveOut{
+		ID:        job.ID,
+		FileID:    job.FileID,
+		ChannelID: job.ChannelID,
+		Status:    job.Status,
+		Files:     job.Files,
+		Moved:     job.Moved,
+		Failed:    job.Failed,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	if job.Error != nil {
+		out.Error = *job.Error
+	}
+	return out
+}
+
+// CreateChannelMove records a job that moves the parts of a file, or of every file below
+// a folder, to another channel of the user. The job runs with RunChannelMove.
+func (fs *FileService) CreateChannelMove(userId int64, payload *schemas.ChannelMoveIn) (*schemas.ChannelMoveOut, *types.AppError) {
+	var channel models.Channel
+	if err := fs.db.Where("channel_id = ?", payload.ChannelID).Where("user_id = ?", userId).
+		First(&channel).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errors.New("channel not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	var file models.File
+	if err := fs.db.Where("id = ?", payload.ID).Where("user_id = ?", userId).Where("status = ?", "active").
+		First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	job := models.ChannelMove{UserID: userId, FileID: file.ID, ChannelID: channel.ChannelID, Status: "pending"}
+	if err := fs.db.Create(&job).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return toChannelMoveOut(&job), nil
+}
+
+// MoveToChannel creates a channel move and runs it in the background.
+func (fs *FileService) MoveToChannel(userId int64, payload *schemas.ChannelMoveIn) (*schemas.ChannelMoveOut, *types.AppError) {
+	job, err := fs.CreateChannelMove(userId, payload)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := fs.RunChannelMove(context.Background(), job.ID); err != nil {
+			logging.DefaultLogger().Warnw("failed to move files to channel", "job", job.ID, "err", err)
+		}
+	}()
+	return job, nil
+}
+
+func (fs *FileService) GetChannelMove(userId int64, id string) (*schemas.ChannelMoveOut, *types.AppError) {
+	var job models.ChannelMove
+	if err := fs.db.Where("id = ?", id).Where("user_id = ?", userId).First(&job).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errChannelMoveNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return toChannelMoveOut(&job), nil
+}
+
+// ResumeChannelMoves runs the moves that are pending, or that stopped making progress,
+// one after the other. It returns the number of moves run.
+func (fs *FileService) ResumeChannelMoves(ctx context.Context) (int, error) {
+	if err := fs.db.Model(&models.ChannelMove{}).Where("status = ?", "running").
+		Where("updated_at < ?", time.Now().UTC().Add(-channelMoveStale)).
+		Update("status", "pending").Error; err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	if err := fs.db.Model(&models.ChannelMove{}).Where("status = ?", "pending").Order("created_at").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	for _, id := range ids {
+		if err := fs.RunChannelMove(ctx, id); err != nil {
+			logger.Warnw("failed to move files to channel", "job", id, "err", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// RunChannelMove runs a pending channel move. Files are moved one at a time, each one
+// is switched to its new parts in a single update and its old messages are queued for
+// deletion, so an interrupted move can be run again. Versions keep their parts in the
+// channel they were uploaded to.
+func (fs *FileService) RunChannelMove(ctx context.Context, id string) error {
+	// Claiming the job keeps a move from running twice.
+	res := fs.db.Model(&models.ChannelMove{}).Where("id = ?", id).Where("status = ?", "pending").
+		Updates(map[string]any{"status": "running", "updated_at": time.Now().UTC()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+
+	var job models.ChannelMove
+	if err := fs.db.Where("id = ?", id).First(&job).Error; err != nil {
+		return err
+	}
+
+	update := map[string]any{"status": "done", "updated_at": time.Now().UTC()}
+
+	err := fs.runChannelMove(ctx, &job)
+	if err != nil {
+		update["status"], update["error"] = "failed", err.Error()
+	} else if job.Failed > 0 {
+		update["status"], update["error"] = "failed", fmt.Sprintf("%d files could not be moved", job.Failed)
+	}
+
+	if err := fs.db.Model(&job).Updates(update).Error; err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Infow("moved files to channel", "job", job.ID, "channel", job.ChannelID,
+		"files", job.Files, "moved", job.Moved, "failed", job.Failed, "status", update["status"])
+
+	return err
+}
+
+func (fs *FileService) runChannelMove(ctx context.Context, job *models.ChannelMove) error {
+	var root models.File
+	if err := fs.db.Where("id = ?", job.FileID).Where("status = ?", "active").First(&root).Error; err != nil {
+		return err
+	}
+
+	query := fs.db.Model(&models.File{}).Where("user_id = ?", job.UserID).Where("type = ?", "file").
+		Where("status = ?", "active").Where("channel_id <> ?", job.ChannelID)
+	if root.Type == "file" {
+		query = query.Where("id = ?", root.ID)
+	} else {
+		prefix := strings.TrimSuffix(root.Path, "/") + "/"
+		query = query.Where("parent_id IN (?)", fs.db.Model(&models.File{}).Select("id").
+			Where("user_id = ?", job.UserID).Where("type = ?", "folder").Where("status = ?", "active").
+			Where("path = ? OR left(path, ?) = ?", root.Path, len(prefix), prefix))
+	}
+
+	var ids []string
+	if err := query.Order("id").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	job.Files = len(ids)
+	if err := fs.db.Model(job).Update("files", job.Files).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	session, err := getUserSession(fs.db, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+	if err != nil {
+		return err
+	}
+
+	channelUser := strconv.FormatInt(job.UserID, 10)
+
+	logger := logging.FromContext(ctx)
+
+	return tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		channel, err := GetChannelById(ctx, client, job.ChannelID, channelUser)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := fs.moveFileToChannel(ctx, client, channelUser, channel, id); err != nil {
+				logger.Warnw("failed to move file to channel", "file", id, "channel", job.ChannelID, "err", err)
+				job.Failed++
+			} else {
+				job.Moved++
+			}
+
+			if err := fs.db.Model(job).Updates(map[string]any{"moved": job.Moved, "failed": job.Failed,
+				"updated_at": time.Now().UTC()}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// moveFileToChannel re-sends the part messages and the thumbnail of a file to channel
+// and points the file at the new messages. The old messages are kept as a version that
+// is pending deletion, which the cleanup job deletes.
+func (fs *FileService) moveFileToChannel(ctx context.Context, client *telegram.Client, channelUser string,
+	channel *tg.InputChannel, fileId string) error {
+	var file models.File
+	if err := fs.db.Where("id = ?", fileId).Where("status = ?", "active").First(&file).Error; err != nil {
+		return err
+	}
+
+	if file.ChannelID == nil || *file.ChannelID == channel.ChannelID || file.Parts == nil {
+		return nil
+	}
+
+	source, err := GetChannelById(ctx, client, *file.ChannelID, channelUser)
+	if err != nil {
+		return err
+	}
+
+	ids := []int{}
+	for _, part := range *file.Parts {
+		ids = append(ids, int(part.ID))
+	}
+	if file.Thumbnail != nil {
+		ids = append(ids, int(file.Thumbnail.ID))
+	}
+
+	documents, err := messageDocuments(ctx, client, source, ids)
+	if err != nil {
+		return err
+	}
+
+	newIds := []int{}
+
+	deleteMessages := func() {
+		if len(newIds) > 0 {
+			client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: newIds})
+		}
+	}
+
+	resend := func(id int64) (int64, error) {
+		document, ok := documents[int(id)]
+		if !ok {
+			return 0, fmt.Errorf("message %d not found", id)
+		}
+		newId, err := resendDocument(ctx, client, channel, document)
+		if err != nil {
+			return 0, err
+		}
+		newIds = append(newIds, newId)
+		return int64(newId), nil
+	}
+
+	parts := append(models.Parts{}, *file.Parts...)
+	for i := range parts {
+		if parts[i].ID, err = resend(parts[i].ID); err != nil {
+			deleteMessages()
+			return err
+		}
+	}
+
+	// A lost thumbnail is dropped and generated again in the new channel.
+	var thumbnail *models.Part
+	if file.Thumbnail != nil {
+		if _, ok := documents[int(file.Thumbnail.ID)]; ok {
+			moved := *file.Thumbnail
+			if moved.ID, err = resend(moved.ID); err != nil {
+				deleteMessages()
+				return err
+			}
+			thumbnail = &moved
+		}
+	}
+
+	channelId := channel.ChannelID
+
+	err = fs.db.Transaction(func(tx *gorm.DB) error {
+		// The content of the file may have been replaced while the parts were sent.
+		res := tx.Model(&models.File{}).Where("id = ?", file.ID).Where("updated_at = ?", file.UpdatedAt).
+			Select("parts", "thumbnail", "channel_id").
+			UpdateColumns(&models.File{Parts: &parts, Thumbnail: thumbnail, ChannelID: &channelId})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errFileChanged
+		}
+
+		old := fs.newVersion(&file)
+		old.Status = "pending_deletion"
+		return tx.Create(old).Error
+	})
+	if err != nil {
+		deleteMessages()
+		return err
+	}
+
+	fs.invalidateParts(ctx, &file)
+
+	if thumbnail == nil {
+		file.Thumbnail, file.ChannelID, file.Parts = nil, &channelId, &parts
+		fs.queueThumbnail(&file)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+)
+
+func (s *FileServiceSuite) Test_ChannelMove() {
+	channelId := int64(100)
+
+	s.db.Where("channel_id is not NULL").Delete(&models.Channel{})
+	s.db.Where("id is not NULL").Delete(&models.ChannelMove{})
+	s.NoError(s.db.Create(&models.Channel{ChannelID: channelId, ChannelName: "Storage 2", UserID: 123456}).Error)
+
+	file := models.File{
+		Name:      "a.jpg",
+		Type:      "file",
+		MimeType:  "image/jpeg",
+		Size:      utils.Int64Pointer(10),
+		Parts:     &models.Parts{{ID: 1}},
+		ChannelID: &channelId,
+		UserID:    123456,
+		Status:    "active",
+		ParentID:  "root",
+	}
+	s.NoError(s.db.Create(&file).Error)
+
+	_, appErr := s.srv.CreateChannelMove(123456, &schemas.ChannelMoveIn{ID: file.ID, ChannelID: 200})
+	s.Equal(http.StatusNotFound, appErr.Code)
+
+	_, appErr = s.srv.CreateChannelMove(654321, &schemas.ChannelMoveIn{ID: file.ID, ChannelID: channelId})
+	s.Equal(http.StatusNotFound, appErr.Code)
+
+	job, appErr := s.srv.CreateChannelMove(123456, &schemas.ChannelMoveIn{ID: file.ID, ChannelID: channelId})
+	s.Nil(appErr)
+	s.Equal("pending", job.Status)
+
+	// A move that stopped making progress is resumed, files already in the channel are skipped.
+	s.NoError(s.db.Model(&models.ChannelMove{}).Where("id = ?", job.ID).Updates(map[string]any{
+		"status": "running", "updated_at": time.Now().UTC().Add(-2 * channelMoveStale)}).Error)
+
+	count, err := s.srv.ResumeChannelMoves(context.Background())
+	s.NoError(err)
+	s.Equal(1, count)
+
+	job, appErr = s.srv.GetChannelMove(123456, job.ID)
+	s.Nil(appErr)
+	s.Equal("done", job.Status)
+	s.Equal(0, job.Files)
+
+	_, appErr = s.srv.GetChannelMove(654321, job.ID)
+	s.Equal(http.StatusNotFound, appErr.Code)
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextChannelName(t *testing.T) {
+	assert.Equal(t, "Storage 2", nextChannelName("Storage"))
+	assert.Equal(t, "Storage 3", nextChannelName("Storage 2"))
+	assert.Equal(t, "Storage 11", nextChannelName("Storage 10"))
+}
+
+func (s *FileServiceSuite) Test_CreateFileAfterRollover() {
+	s.db.Where("channel_id is not NULL").Delete(&models.Channel{})
+	s.db.Where("upload_id is not NULL").Delete(&models.Upload{})
+
+	// The parts were uploaded to the previous default channel.
+	s.NoError(s.db.Create(&models.Channel{ChannelID: 100, ChannelName: "Storage", UserID: 123456}).Error)
+	s.NoError(s.db.Create(&models.Channel{ChannelID: 200, ChannelName: "Storage 2", UserID: 123456,
+		Selected: true}).Error)
+	s.NoError(s.db.Create(&models.Upload{UploadId: "upload", PartId: 1, PartNo: 1, ChannelID: 100,
+		UserId: 123456}).Error)
+	s.NoError(s.db.Create(&models.Upload{UploadId: "upload", PartId: 2, PartNo: 2, ChannelID: 100,
+		UserId: 123456}).Error)
+
+	file := s.entry("a.jpg")
+	file.ChannelID = 0
+	file.Parts = []schemas.Part{{ID: 1}, {ID: 2}}
+
+	out, appErr := s.srv.CreateFile(context.Background(), 123456, file)
+	s.Nil(appErr)
+
+	var created models.File
+	s.NoError(s.db.Where("id = ?", out.ID).First(&created).Error)
+	s.Equal(int64(100), *created.ChannelID)
+
+	// Parts not uploaded through the uploads API go to the default channel.
+	file = s.entry("b.jpg")
+	file.ChannelID = 0
+	file.Parts = []schemas.Part{{ID: 3}}
+
+	out, appErr = s.srv.CreateFile(context.Background(), 123456, file)
+	s.Nil(appErr)
+
+	s.NoError(s.db.Where("id = ?", out.ID).First(&created).Error)
+	s.Equal(int64(200), *created.ChannelID)
+}
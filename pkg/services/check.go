@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// checkBatch is the number of files checked at once, their part messages are fetched
+// with ChannelsGetMessages in requests of at most checkBatch IDs.
+const checkBatch = 100
+
+type messageKey struct {
+	channelId int64
+	messageId int64
+}
+
+// fileCheck carries the state of a check across channels, parts are duplicates when
+// their message was seen before in the same check.
+type fileCheck struct {
+	report *schemas.CheckReport
+	seen   map[messageKey]string
+	broken []models.File
+}
+
+// CheckFiles verifies that the part messages of every active file of a user or channel,
+// or of all files when neither is set, still exist in Telegram and that their sizes add
+// up to the size of the file. Broken files are moved to quarantine when asked to, they
+// are hidden until they are released again.
+func (fs *FileService) CheckFiles(ctx context.Context, opts *schemas.CheckIn) (*schemas.CheckReport, error) {
+	query := fs.db.Model(&models.File{}).Where("type = ?", "file").Where("status = ?", "active").
+		Where("channel_id IS NOT NULL")
+	if opts.UserID != 0 {
+		query = query.Where("user_id = ?", opts.UserID)
+	}
+	if opts.ChannelID != 0 {
+		query = query.Where("channel_id = ?", opts.ChannelID)
+	}
+
+	var groups []struct {
+		UserID    int64
+		ChannelID int64
+	}
+	if err := query.Distinct("user_id", "channel_id").Order("user_id").Order("channel_id").
+		Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	channels := map[int64][]int64{}
+	users := []int64{}
+	for _, group := range groups {
+		if _, ok := channels[group.UserID]; !ok {
+			users = append(users, group.UserID)
+		}
+		channels[group.UserID] = append(channels[group.UserID], group.ChannelID)
+	}
+
+	check := &fileCheck{
+		report: &schemas.CheckReport{Issues: []schemas.CheckIssue{}},
+		seen:   map[messageKey]string{},
+	}
+
+	logger := logging.FromContext(ctx)
+
+	for _, userId := range users {
+		if err := ctx.Err(); err != nil {
+			return check.report, err
+		}
+
+		session, err := getUserSession(fs.db, userId)
+		if err != nil {
+			logger.Warnw("skipping user without session", "user", userId, "err", err)
+			continue
+		}
+
+		client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+		if err != nil {
+			return check.report, err
+		}
+
+		err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+			for _, channelId := range channels[userId] {
+				if err := fs.checkChannel(ctx, client, check, userId, channelId); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return check.report, err
+		}
+	}
+
+	check.report.Broken = len(check.broken)
+
+	if opts.Quarantine && len(check.broken) > 0 {
+		ids := make([]string, 0, len(check.broken))
+		for _, file := range check.broken {
+			ids = append(ids, file.ID)
+		}
+		res := fs.db.Model(&models.File{}).Where("id IN ?", ids).Where("status = ?", "active").
+			Update("status", "quarantined")
+		if res.Error != nil {
+			return check.report, res.Error
+		}
+		check.report.Quarantined = int(res.RowsAffected)
+		for i := range check.broken {
+			fs.invalidateParts(ctx, &check.broken[i])
+		}
+	}
+
+	logger.Infow("checked files", "files", check.report.Files, "parts", check.report.Parts,
+		"issues", len(check.report.Issues), "broken", check.report.Broken, "quarantined", check.report.Quarantined)
+
+	return check.report, nil
+}
+
+func (fs *FileService) checkChannel(ctx context.Context, client *telegram.Client, check *fileCheck,
+	userId, channelId int64) error {
+	channel, err := GetChannelById(ctx, client, channelId, strconv.FormatInt(userId, 10))
+	if err != nil {
+		return err
+	}
+
+	lastId := ""
+
+	for {
+		var files []models.File
+		if err := fs.db.Select("id", "name", "user_id", "channel_id", "parts", "size", "encrypted").
+			Where("user_id = ?", userId).Where("channel_id = ?", channelId).
+			Where("type = ?", "file").Where("status = ?", "active").Where("id > ?", lastId).
+			Order("id").Limit(checkBatch).Find(&files).Error; err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		lastId = files[len(files)-1].ID
+
+		ids := []int{}
+		for _, file := range files {
+			if file.Parts != nil {
+				for _, part := range *file.Parts {
+					ids = append(ids, int(part.ID))
+				}
+			}
+		}
+
+		sizes, err := messageSizes(ctx, client, channel, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			fs.checkFile(check, &file, sizes)
+		}
+	}
+}
+
+// checkFile records the issues of a file given the document sizes of its channel.
+func (fs *FileService) checkFile(check *fileCheck, file *models.File, sizes map[int]int64) {
+	check.report.Files++
+
+	issue := func(kind string, partNo int, part *models.Part) *schemas.CheckIssue {
+		check.report.Issues = append(check.report.Issues, schemas.CheckIssue{
+			FileID:    file.ID,
+			Name:      fs.names.Decrypt(file.UserID, file.Name),
+			UserID:    file.UserID,
+			ChannelID: *file.ChannelID,
+			Issue:     kind,
+			PartNo:    partNo,
+		})
+		out := &check.report.Issues[len(check.report.Issues)-1]
+		if part != nil {
+			out.MessageID = part.ID
+		}
+		return out
+	}
+
+	broken := false
+	complete := true
+	total := int64(0)
+
+	parts := models.Parts{}
+	if file.Parts != nil {
+		parts = *file.Parts
+	}
+
+	for i := range parts {
+		part := &parts[i]
+		check.report.Parts++
+
+		key := messageKey{channelId: *file.ChannelID, messageId: part.ID}
+		if other, ok := check.seen[key]; ok {
+			issue("duplicate", i+1, part).DuplicateOf = other
+		} else {
+			check.seen[key] = file.ID
+		}
+
+		size, ok := sizes[int(part.ID)]
+		if !ok {
+			issue("missing", i+1, part)
+			broken, complete = true, false
+			continue
+		}
+
+		if file.Encrypted {
+			decrypted, err := crypt.DecryptedSize(size)
+			if err != nil {
+				out := issue("size_mismatch", i+1, part)
+				out.ActualSize = size
+				broken, complete = true, false
+				continue
+			}
+			size = decrypted
+		}
+		total += size
+	}
+
+	fileSize := int64(0)
+	if file.Size != nil {
+		fileSize = *file.Size
+	}
+
+	if complete && total != fileSize {
+		out := issue("size_mismatch", 0, nil)
+		out.ExpectedSize, out.ActualSize = fileSize, total
+		broken = true
+	}
+
+	if broken {
+		check.broken = append(check.broken, *file)
+	}
+}
+
+// messageSizes returns the document sizes of the messages of a channel, messages that
+// are deleted or hold no document are left out.
+func messageSizes(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, ids []int) (map[int]int64, error) {
+	documents, err := messageDocuments(ctx, client, channel, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[int]int64, len(documents))
+	for id, document := range documents {
+		sizes[id] = document.Size
+	}
+	return sizes, nil
+}
+
+// messageDocuments returns the documents of the messages of a channel by message ID.
+func messageDocuments(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, ids []int) (map[int]*tg.Document, error) {
+	documents := make(map[int]*tg.Document, len(ids))
+
+	for start := 0; start < len(ids); start += checkBatch {
+		batch := ids[start:min(start+checkBatch, len(ids))]
+
+		inputs := make([]tg.InputMessageClass, 0, len(batch))
+		for _, id := range batch {
+			inputs = append(inputs, &tg.InputMessageID{ID: id})
+		}
+
+		res, err := client.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{Channel: channel, ID: inputs})
+		if err != nil {
+			return nil, err
+		}
+
+		messages, ok := res.AsModified()
+		if !ok {
+			return nil, errors.New("unexpected messages response")
+		}
+
+		for _, message := range messages.GetMessages() {
+			item, ok := message.(*tg.Message)
+			if !ok {
+				continue
+			}
+			media, ok := item.Media.(*tg.MessageMediaDocument)
+			if !ok {
+				continue
+			}
+			document, ok := media.Document.(*tg.Document)
+			if !ok {
+				continue
+			}
+			documents[item.ID] = document
+		}
+	}
+
+	return documents, nil
+}
+
+// ReleaseQuarantine makes quarantined files active again. It fails when a file of the same name was created meanwhile.
+func (fs *FileService) ReleaseQuarantine(ids []string) (*schemas.Message, *types.AppError) {
+	res := fs.db.Model(&models.File{}).Where("id IN ?", ids).Where("status = ?", "quarantined").
+		Update("status", "active")
+	if database.IsKeyConflictErr(res.Error) {
+		return nil, &types.AppError{Error: errors.New("a file of the same name exists"), Code: http.StatusConflict}
+	}
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	return &schemas.Message{Message: fmt.Sprintf("%d files released", res.RowsAffected)}, nil
+}
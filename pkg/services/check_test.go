@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func checkedFile(id string, size int64, ids ...int64) *models.File {
+	channelId := int64(100)
+	parts := models.Parts{}
+	for _, id := range ids {
+		parts = append(parts, models.Part{ID: id})
+	}
+	return &models.File{ID: id, Name: id, UserID: 1, ChannelID: &channelId, Size: &size, Parts: &parts}
+}
+
+func TestCheckFile(t *testing.T) {
+	fs := &FileService{names: newNames(&config.TGConfig{})}
+	check := &fileCheck{report: &schemas.CheckReport{}, seen: map[messageKey]string{}}
+
+	sizes := map[int]int64{1: 10, 2: 5, 3: 10}
+
+	fs.checkFile(check, checkedFile("ok", 15, 1, 2), sizes)
+	fs.checkFile(check, checkedFile("missing", 20, 3, 4), sizes)
+	fs.checkFile(check, checkedFile("short", 30, 3), sizes)
+	fs.checkFile(check, checkedFile("copy", 10, 1), sizes)
+
+	assert.Equal(t, 4, check.report.Files)
+	assert.Equal(t, 6, check.report.Parts)
+
+	issues := []string{}
+	for _, issue := range check.report.Issues {
+		issues = append(issues, issue.FileID+":"+issue.Issue)
+	}
+	assert.Equal(t, []string{"missing:missing", "short:duplicate", "short:size_mismatch", "copy:duplicate"}, issues)
+
+	assert.Equal(t, "missing", check.report.Issues[1].DuplicateOf)
+	assert.Equal(t, int64(30), check.report.Issues[2].ExpectedSize)
+	assert.Equal(t, int64(10), check.report.Issues[2].ActualSize)
+
+	// Only files with missing or mismatched parts are quarantined, duplicates are reported.
+	quarantined := []string{}
+	for _, file := range check.broken {
+		quarantined = append(quarantined, file.ID)
+	}
+	assert.Equal(t, []string{"missing", "short"}, quarantined)
+}
@@ -168,6 +168,7 @@ func getParts(ctx context.Context, client *telegram.Client, file *schemas.FileOu
 			Location: location,
 			Size:     document.Size,
 			Salt:     file.Parts[i].Salt,
+			KeyID:    file.Parts[i].KeyID,
 		}
 		if file.Encrypted {
 			part.DecryptedSize, _ = crypt.DecryptedSize(document.Size)
@@ -178,6 +179,33 @@ func getParts(ctx context.Context, client *telegram.Client, file *schemas.FileOu
 	return parts, nil
 }
 
+// resendDocument posts a document that is already stored in Telegram to channel without
+// uploading it again and returns the ID of the new message.
+func resendDocument(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, document *tg.Document) (int, error) {
+	randomId, _ := randInt64()
+	res, err := client.API().MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+		Silent:   true,
+		Peer:     &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+		Media:    &tg.InputMediaDocument{ID: document.AsInput()},
+		RandomID: randomId,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	updates, ok := res.(*tg.Updates)
+	if !ok {
+		return 0, errors.New("unexpected send media response")
+	}
+
+	for _, update := range updates.Updates {
+		if channelMsg, ok := update.(*tg.UpdateNewChannelMessage); ok {
+			return channelMsg.Message.GetID(), nil
+		}
+	}
+	return 0, errors.New("sent message not found in updates")
+}
+
 func GetChannelById(ctx context.Context, client *telegram.Client, channelId int64, userID string) (*tg.InputChannel, error) {
 
 	channel := &tg.InputChannel{}
@@ -267,3 +295,29 @@ func getSessionByHash(db *gorm.DB, cache *cache.Cache, hash string) (*models.Ses
 	return &session, nil
 
 }
+
+// getUserSession returns the most recent login session of a user, used to act on behalf
+// of the user when a request is not authenticated with a session.
+func getUserSession(db *gorm.DB, userId int64) (*models.Session, error) {
+	var session models.Session
+	if err := db.Where("user_id = ?", userId).Order("created_at desc").First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+const (
+	accessKeyIdChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	secretKeyChars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+func randomString(chars string, length int) (string, error) {
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i := range buf {
+		buf[i] = chars[int(buf[i])%len(chars)]
+	}
+	return string(buf), nil
+}
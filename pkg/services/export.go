@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/checksum"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+type ExportOptions struct {
+	UserID int64
+	// Path is the file or folder to export.
+	Path string
+	// Dir is the local directory the files are written to.
+	Dir string
+	// Rclone writes the files and names of an rclone crypt remote, decrypted files are
+	// written when it is nil.
+	Rclone *crypt.Rclone
+}
+
+type ImportOptions struct {
+	UserID int64
+	// Dir is the local directory holding the files of an rclone crypt remote.
+	Dir string
+	// Path is the folder the files are stored below.
+	Path   string
+	Rclone *crypt.Rclone
+}
+
+// Export writes the file or folder at opts.Path, with everything below it, to opts.Dir
+// and returns the number of files written.
+func (fs *FileService) Export(ctx context.Context, opts *ExportOptions) (int, error) {
+	root, appErr := fs.GetFileByPath(opts.UserID, opts.Path)
+	if appErr != nil {
+		return 0, appErr.Error
+	}
+
+	entries, err := fs.archiveEntries(opts.UserID, []string{root.ID})
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := getUserSession(fs.db, opts.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	channelUser := strconv.FormatInt(opts.UserID, 10)
+
+	logger := logging.FromContext(ctx)
+
+	count := 0
+
+	err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			dir := entry.file.Type == "folder"
+
+			name := entry.name
+			if opts.Rclone != nil {
+				if name, err = opts.Rclone.EncodePath(entry.name, dir); err != nil {
+					return fmt.Errorf("%s: %w", entry.name, err)
+				}
+			}
+
+			target := filepath.Join(opts.Dir, filepath.FromSlash(name))
+
+			if dir {
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := fs.exportFile(ctx, client, channelUser, entry.file, target, opts.Rclone); err != nil {
+				return fmt.Errorf("%s: %w", entry.name, err)
+			}
+
+			count++
+			logger.Infow("exported file", "path", entry.name, "done", count)
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// exportFile writes a file to target through a temporary file, so that an interrupted
+// export never leaves a partial file behind.
+func (fs *FileService) exportFile(ctx context.Context, client *telegram.Client, channelUser string,
+	file *models.File, target string, rclone *crypt.Rclone) error {
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	var r io.Reader = strings.NewReader("")
+
+	if file.Size != nil && *file.Size > 0 {
+		lr, err := fs.newFileReader(ctx, client, channelUser, mapper.ToFileOutFull(*file), 0, *file.Size-1)
+		if err != nil {
+			return err
+		}
+		defer lr.Close()
+		r = lr
+	}
+
+	if rclone != nil {
+		encrypted, err := rclone.EncryptData(r)
+		if err != nil {
+			return err
+		}
+		r = encrypted
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, file.UpdatedAt, file.UpdatedAt)
+}
+
+// Import stores the files of an rclone crypt remote in opts.Dir below opts.Path. Their
+// content is decrypted and encrypted again as teldrive parts while it is uploaded, it is
+// never written to disk in plain text. Files whose names do not decrypt are skipped. It
+// returns the number of files imported.
+func (fs *FileService) Import(ctx context.Context, opts *ImportOptions) (int, error) {
+	if fs.cnf.Uploads.EncryptionKey == "" {
+		return 0, errNoEncryptionKey
+	}
+
+	if _, appErr := fs.MakeDirectory(opts.UserID, &schemas.MkDir{Path: opts.Path}); appErr != nil {
+		return 0, appErr.Error
+	}
+
+	session, err := getUserSession(fs.db, opts.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+	if err != nil {
+		return 0, err
+	}
+
+	channelId, err := GetDefaultChannel(ctx, fs.db, opts.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	channelUser := strconv.FormatInt(opts.UserID, 10)
+
+	logger := logging.FromContext(ctx)
+
+	count := 0
+
+	err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		channel, err := GetChannelById(ctx, client, channelId, channelUser)
+		if err != nil {
+			return err
+		}
+
+		return filepath.WalkDir(opts.Dir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(opts.Dir, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			name, err := opts.Rclone.DecodePath(rel, d.IsDir())
+			if err != nil {
+				logger.Warnw("skipping file", "path", rel, "err", err)
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			target := path.Join(opts.Path, name)
+
+			if d.IsDir() {
+				if _, appErr := fs.MakeDirectory(opts.UserID, &schemas.MkDir{Path: target}); appErr != nil {
+					return appErr.Error
+				}
+				return nil
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			if err := fs.importFile(ctx, client, channel, channelId, opts.UserID, p, target, opts.Rclone); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+
+			count++
+			logger.Infow("imported file", "path", target, "done", count)
+			return nil
+		})
+	})
+
+	return count, err
+}
+
+// importFile uploads the rclone crypt file at src as the file at target.
+func (fs *FileService) importFile(ctx context.Context, client *telegram.Client, channel *tg.InputChannel,
+	channelId, userId int64, src, target string, rclone *crypt.Rclone) error {
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size, err := rclone.DecryptedSize(info.Size())
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := rclone.DecryptData(f)
+	if err != nil {
+		return err
+	}
+
+	hasher := checksum.New()
+
+	r := io.TeeReader(decrypted, hasher)
+
+	dir, name := path.Split(target)
+	dir = path.Clean(dir)
+
+	folderPath, err := fs.names.EncryptPath(userId, dir)
+	if err != nil {
+		return err
+	}
+
+	keyId, password, err := newKeyring(fs.db, fs.cnf).ForFile(userId, folderPath)
+	if err != nil {
+		return err
+	}
+
+	partSize := fs.cnf.Uploads.PartSize
+
+	totalParts := int((size + partSize - 1) / partSize)
+
+	parts := []schemas.Part{}
+	ids := []int{}
+
+	deleteMessages := func() {
+		if len(ids) > 0 {
+			client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids})
+		}
+	}
+
+	for i := 0; i < totalParts; i++ {
+		length := min(partSize, size-int64(i)*partSize)
+
+		salt, _ := generateRandomSalt()
+
+		cipher, err := crypt.NewCipher(password, salt)
+		if err != nil {
+			deleteMessages()
+			return err
+		}
+
+		body, err := cipher.EncryptData(io.LimitReader(r, length))
+		if err != nil {
+			deleteMessages()
+			return err
+		}
+
+		messageId, err := sendDocument(ctx, client, channel, fs.cnf.Uploads.Threads,
+			partName(name, i+1, totalParts), body, crypt.EncryptedSize(length))
+		if err != nil {
+			deleteMessages()
+			return err
+		}
+
+		ids = append(ids, messageId)
+		parts = append(parts, schemas.Part{ID: int64(messageId), Salt: salt, KeyID: keyId})
+	}
+
+	out, appErr := fs.CreateFile(ctx, userId, &schemas.FileIn{
+		Name:      name,
+		Type:      "file",
+		Parts:     parts,
+		MimeType:  mimeTypeByName(name),
+		ChannelID: channelId,
+		Path:      dir,
+		Size:      size,
+		Encrypted: true,
+	})
+	if appErr != nil {
+		deleteMessages()
+		return appErr.Error
+	}
+
+	shaSum, md5Sum := hasher.Sums()
+
+	return fs.db.Model(&models.File{}).Where("id = ?", out.ID).
+		UpdateColumns(map[string]any{"sha256": shaSum, "md5": md5Sum}).Error
+}
@@ -3,28 +3,34 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 
 	"github.com/divyam234/teldrive/internal/cache"
 	category "github.com/divyam234/teldrive/internal/category"
+	"github.com/divyam234/teldrive/internal/checksum"
+	"github.com/divyam234/teldrive/internal/chunkcache"
 	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/database"
 	"github.com/divyam234/teldrive/internal/http_range"
-	"github.com/divyam234/teldrive/internal/md5"
 	"github.com/divyam234/teldrive/internal/reader"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/httputil"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/mapper"
 	"github.com/divyam234/teldrive/pkg/models"
 	"github.com/divyam234/teldrive/pkg/schemas"
 	"github.com/divyam234/teldrive/pkg/types"
 	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 
@@ -34,22 +40,50 @@ import (
 )
 
 type FileService struct {
-	db     *gorm.DB
-	cnf    *config.TGConfig
-	worker *tgc.StreamWorker
+	db         *gorm.DB
+	cnf        *config.TGConfig
+	trash      *config.TrashConfig
+	versions   *config.VersionsConfig
+	thumbnails *config.ThumbnailsConfig
+	orphans    *config.OrphansConfig
+	quota      *config.QuotaConfig
+	names      *names
+	worker     *tgc.StreamWorker
 }
 
 func NewFileService(db *gorm.DB, cnf *config.Config, worker *tgc.StreamWorker) *FileService {
-	return &FileService{db: db, cnf: &cnf.TG, worker: worker}
+	return &FileService{db: db, cnf: &cnf.TG, trash: &cnf.Trash, versions: &cnf.Versions,
+		thumbnails: &cnf.Thumbnails, orphans: &cnf.Orphans, quota: &cnf.Quota,
+		names: newNames(&cnf.TG), worker: worker}
 }
 
-func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.FileIn) (*schemas.FileOut, *types.AppError) {
+func (fs *FileService) CreateFile(c context.Context, userId int64, fileIn *schemas.FileIn) (*schemas.FileOut, *types.AppError) {
 
-	var fileDB models.File
+	var (
+		fileDB models.File
+		parent *models.File
+	)
 
 	fileIn.Path = strings.TrimSpace(fileIn.Path)
 
-	if fileIn.Path != "" {
+	// Files created in a folder shared with the user belong to the owner of the folder.
+	ownerId := userId
+	if fileIn.ParentID != "" {
+		var appErr *types.AppError
+		if parent, appErr = authorizeFolder(fs.db, userId, fileIn.ParentID, roleEditor); appErr != nil {
+			return nil, appErr
+		}
+		ownerId = parent.UserID
+	}
+
+	name, err := fs.names.Encrypt(ownerId, fileIn.Name)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if parent != nil {
+		fileDB.ParentID = parent.ID
+	} else if fileIn.Path != "" {
 		pathId, err := fs.getPathId(fileIn.Path, userId)
 		if err != nil || pathId == "" {
 			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
@@ -59,20 +93,39 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 
 	if fileIn.Type == "folder" {
 		fileDB.MimeType = "drive/folder"
+		var dir string
+		if parent != nil {
+			dir = parent.Path
+			depth := 0
+			if parent.Depth != nil {
+				depth = *parent.Depth
+			}
+			fileDB.Depth = utils.IntPointer(depth + 1)
+		} else {
+			dir, err = fs.names.EncryptPath(userId, fileIn.Path)
+			if err != nil {
+				return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+			}
+			fileDB.Depth = utils.IntPointer(len(strings.Split(fileIn.Path, "/")) - 1)
+		}
 		var fullPath string
-		if fileIn.Path == "/" {
-			fullPath = "/" + fileIn.Name
+		if dir == "/" {
+			fullPath = "/" + name
 		} else {
-			fullPath = fileIn.Path + "/" + fileIn.Name
+			fullPath = dir + "/" + name
 		}
 		fileDB.Path = fullPath
-		fileDB.Depth = utils.IntPointer(len(strings.Split(fileIn.Path, "/")) - 1)
 	} else if fileIn.Type == "file" {
 		fileDB.Path = ""
 		channelId := fileIn.ChannelID
-		if fileIn.ChannelID == 0 {
-			var err error
-			channelId, err = GetDefaultChannel(c, fs.db, userId)
+		if channelId == 0 {
+			channelId, err = fs.uploadsChannel(userId, ownerId, fileIn.Parts)
+			if err != nil {
+				return nil, &types.AppError{Error: err}
+			}
+		}
+		if channelId == 0 {
+			channelId, err = GetDefaultChannel(c, fs.db, ownerId)
 			if err != nil {
 				return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
 			}
@@ -83,42 +136,118 @@ func (fs *FileService) CreateFile(c *gin.Context, userId int64, fileIn *schemas.
 		parts := models.Parts{}
 		for _, part := range fileIn.Parts {
 			parts = append(parts, models.Part{
-				ID:   part.ID,
-				Salt: part.Salt,
+				ID:    part.ID,
+				Salt:  part.Salt,
+				KeyID: part.KeyID,
 			})
 
 		}
 		fileDB.Parts = &parts
 		fileDB.Starred = false
 		fileDB.Size = &fileIn.Size
+		fileDB.UserID = ownerId
+		fs.setChecksums(&fileDB)
 	}
-	fileDB.Name = fileIn.Name
+	fileDB.Name = name
 	fileDB.Type = fileIn.Type
-	fileDB.UserID = userId
+	fileDB.UserID = ownerId
 	fileDB.Status = "active"
 	fileDB.Encrypted = fileIn.Encrypted
 
-	if err := fs.db.Create(&fileDB).Error; err != nil {
+	if fileDB.Type == "file" {
+		if appErr := fs.insertFile(&fileDB); appErr != nil {
+			if database.IsKeyConflictErr(appErr.Error) {
+				return fs.overwriteFile(c, &fileDB)
+			}
+			return nil, appErr
+		}
+	} else if err := fs.db.Create(&fileDB).Error; err != nil {
 		if database.IsKeyConflictErr(err) {
 			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
 		}
 		return nil, &types.AppError{Error: err}
 	}
 
-	res := mapper.ToFileOut(fileDB)
+	fs.queueThumbnail(&fileDB)
+
+	res := fs.toFileOut(fileDB)
 
 	return res, nil
 }
 
+// uploadsChannel returns the channel the parts were uploaded to, or 0 when they were not
+// uploaded through the uploads API. The default channel may have changed since.
+func (fs *FileService) uploadsChannel(userId, ownerId int64, parts []schemas.Part) (int64, error) {
+	ids := map[int64]bool{}
+	for _, part := range parts {
+		ids[part.ID] = true
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	partIds := []int64{}
+	for id := range ids {
+		partIds = append(partIds, id)
+	}
+
+	var channels []int64
+	if err := fs.db.Model(&models.Upload{}).Select("channel_id").
+		Where("user_id IN ?", []int64{userId, ownerId}).Where("part_id IN ?", partIds).
+		Group("channel_id").Having("count(DISTINCT part_id) = ?", len(partIds)).
+		Order("max(created_at) DESC").Limit(1).Pluck("channel_id", &channels).Error; err != nil {
+		return 0, err
+	}
+	if len(channels) == 0 {
+		return 0, nil
+	}
+	return channels[0], nil
+}
+
+// UpdateFile updates a file of the user or of a folder shared with the user as an editor.
 func (fs *FileService) UpdateFile(id string, userId int64, update *schemas.FileUpdate) (*schemas.FileOut, *types.AppError) {
 	var (
 		files []models.File
 		chain *gorm.DB
 	)
+
+	file, appErr := authorizeFile(fs.db, userId, id, roleEditor)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Names are stored as the owner sees them.
+	ownerId := file.UserID
+
+	if update.ParentID != "" {
+		parent, appErr := authorizeFolder(fs.db, userId, update.ParentID, roleEditor)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if parent.UserID != ownerId {
+			return nil, &types.AppError{Error: errOtherDrive, Code: http.StatusBadRequest}
+		}
+	}
+
+	if update.Name != "" {
+		name, err := fs.names.Encrypt(ownerId, update.Name)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		update.Name = name
+	}
+	if update.Path != "" {
+		updatePath, err := fs.names.EncryptPath(ownerId, update.Path)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		update.Path = updatePath
+	}
 	if update.Type == "folder" && update.Name != "" {
-		chain = fs.db.Raw("select * from teldrive.update_folder(?, ?, ?)", id, update.Name, userId).Scan(&files)
+		chain = fs.db.Raw("select * from teldrive.update_folder(?, ?, ?)", id, update.Name, ownerId).Scan(&files)
 	} else {
-		chain = fs.db.Model(&files).Clauses(clause.Returning{}).Where("id = ?", id).Updates(update)
+		chain = fs.db.Model(&files).Clauses(clause.Returning{}).Where("id = ?", id).Where("user_id = ?", ownerId).
+			Updates(update)
 	}
 
 	if chain.Error != nil {
@@ -128,11 +257,22 @@ func (fs *FileService) UpdateFile(id string, userId int64, update *schemas.FileU
 		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
 	}
 
-	return mapper.ToFileOut(files[0]), nil
+	return fs.toFileOut(files[0]), nil
 
 }
 
-func (fs *FileService) GetFileByID(id string) (*schemas.FileOutFull, *types.AppError) {
+// GetFileByID returns a file of the user or of a folder shared with the user.
+func (fs *FileService) GetFileByID(userId int64, id string) (*schemas.FileOutFull, *types.AppError) {
+	file, appErr := authorizeFile(fs.db, userId, id, roleViewer)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return fs.toFileOutFull(*file), nil
+}
+
+// getFile returns a file whatever its owner, callers check access first.
+func (fs *FileService) getFile(id string) (*schemas.FileOutFull, *types.AppError) {
 	var file models.File
 	if err := fs.db.Where("id = ?", id).First(&file).Error; err != nil {
 		if database.IsRecordNotFoundErr(err) {
@@ -141,7 +281,39 @@ func (fs *FileService) GetFileByID(id string) (*schemas.FileOutFull, *types.AppE
 		return nil, &types.AppError{Error: err}
 	}
 
-	return mapper.ToFileOutFull(file), nil
+	return fs.toFileOutFull(file), nil
+}
+
+func (fs *FileService) GetFileByPath(userId int64, filePath string) (*schemas.FileOutFull, *types.AppError) {
+	var file models.File
+
+	filePath = path.Clean("/" + filePath)
+
+	query := fs.db.Where("user_id = ?", userId).Where("status = ?", "active")
+
+	if filePath == "/" {
+		query = query.Where("parent_id = ?", "root")
+	} else {
+		dir, name := path.Split(filePath)
+		parentId, err := fs.getPathId(path.Clean(dir), userId)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
+		}
+		name, err = fs.names.Encrypt(userId, name)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		query = query.Where("parent_id = ?", parentId).Where("name = ?", name)
+	}
+
+	if err := query.First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	return fs.toFileOutFull(file), nil
 }
 
 func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*schemas.FileResponse, *types.AppError) {
@@ -158,9 +330,19 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 		}
 	}
 
+	// Folders shared with the user are listed by ID, their files belong to the owner.
+	ownerId := userId
+	if fquery.Path == "" && fquery.ParentID != "" && fquery.Op != "search" {
+		folder, appErr := authorizeFolder(fs.db, userId, fquery.ParentID, roleViewer)
+		if appErr != nil {
+			return nil, appErr
+		}
+		ownerId, pathId = folder.UserID, folder.ID
+	}
+
 	query := fs.db.Limit(fquery.PerPage)
 
-	filter := &models.File{UserID: userId, Status: "active"}
+	filter := &models.File{UserID: ownerId, Status: "active"}
 
 	setOrderFilter(query, fquery)
 
@@ -171,11 +353,17 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 
 	} else if fquery.Op == "find" {
 
-		filter.Name = fquery.Name
+		filter.Name, err = fs.names.Encrypt(ownerId, fquery.Name)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		filter.Path, err = fs.names.EncryptPath(ownerId, fquery.Path)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
 		filter.Type = fquery.Type
 		filter.ParentID = fquery.ParentID
 		filter.Category = fquery.Category
-		filter.Path = fquery.Path
 		filter.Type = fquery.Type
 		if fquery.Starred != nil {
 			filter.Starred = *fquery.Starred
@@ -191,16 +379,37 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 
 	} else if fquery.Op == "search" {
 
-		query.Where("teldrive.get_tsquery(?) @@ teldrive.get_tsvector(name)", fquery.Search)
+		// Encrypted names can only be matched as a whole.
+		if fs.names.enabled {
+			name, err := fs.names.Encrypt(userId, strings.TrimSpace(fquery.Search))
+			if err != nil {
+				return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+			}
+			query.Where("name = ?", name)
+		} else {
+			query.Where("teldrive.get_tsquery(?) @@ teldrive.get_tsvector(name)", fquery.Search)
+		}
 
 		query.Order(getOrder(fquery)).
 			Model(&filter).Where(&filter)
 	}
 
+	if fquery.Hash != "" {
+		column := "sha256"
+		if len(fquery.Hash) == 32 {
+			column = "md5"
+		}
+		query.Where(column+" = ?", strings.ToLower(fquery.Hash))
+	}
+
+	fields := "*,thumbnail IS NOT NULL as has_thumbnail"
+
 	if fquery.Path == "" {
-		query.Select("*,(select path from teldrive.files as f where f.id = files.parent_id) as parent_path")
+		fields += ",(select path from teldrive.files as f where f.id = files.parent_id) as parent_path"
 	}
 
+	query.Select(fields)
+
 	files := []schemas.FileOut{}
 
 	query.Scan(&files)
@@ -213,6 +422,10 @@ func (fs *FileService) ListFiles(userId int64, fquery *schemas.FileQuery) (*sche
 		token = base64.StdEncoding.EncodeToString([]byte(token))
 	}
 
+	for i := range files {
+		fs.names.FileOut(ownerId, &files[i])
+	}
+
 	res := &schemas.FileResponse{Files: files, NextPageToken: token}
 
 	return res, nil
@@ -222,6 +435,11 @@ func (fs *FileService) getPathId(path string, userId int64) (string, error) {
 
 	var file models.File
 
+	path, err := fs.names.EncryptPath(userId, path)
+	if err != nil {
+		return "", err
+	}
+
 	if err := fs.db.Model(&models.File{}).Select("id").Where("path = ?", path).Where("user_id = ?", userId).
 		First(&file).Error; database.IsRecordNotFoundErr(err) {
 		return "", database.ErrNotFound
@@ -233,12 +451,17 @@ func (fs *FileService) getPathId(path string, userId int64) (string, error) {
 func (fs *FileService) MakeDirectory(userId int64, payload *schemas.MkDir) (*schemas.FileOut, *types.AppError) {
 	var files []models.File
 
-	if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Path).
+	dir, err := fs.names.EncryptPath(userId, payload.Path)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, dir).
 		Scan(&files).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
-	file := mapper.ToFileOut(files[0])
+	file := fs.toFileOut(files[0])
 
 	return file, nil
 }
@@ -251,7 +474,33 @@ func (fs *FileService) MoveFiles(userId int64, payload *schemas.FileOperation) (
 		Dims:     []pgtype.ArrayDimension{{Length: int32(len(payload.Files)), LowerBound: 1}},
 	}
 
-	if err := fs.db.Exec("select * from teldrive.move_items(? , ? , ?)", items, payload.Destination, userId).Error; err != nil {
+	ownerId, appErr := fs.itemsOwner(userId, payload.Files)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// A folder shared with the user is given by ID as its path is in the drive of its owner.
+	destOwner := userId
+	var dest string
+	if payload.DestinationID != "" {
+		folder, appErr := authorizeFolder(fs.db, userId, payload.DestinationID, roleEditor)
+		if appErr != nil {
+			return nil, appErr
+		}
+		destOwner, dest = folder.UserID, folder.Path
+	} else {
+		var err error
+		dest, err = fs.names.EncryptPath(userId, payload.Destination)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+	}
+
+	if destOwner != ownerId {
+		return nil, &types.AppError{Error: errOtherDrive, Code: http.StatusBadRequest}
+	}
+
+	if err := fs.db.Exec("select * from teldrive.move_items(? , ? , ?)", items, dest, ownerId).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
@@ -260,17 +509,37 @@ func (fs *FileService) MoveFiles(userId int64, payload *schemas.FileOperation) (
 
 func (fs *FileService) DeleteFiles(userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
 
-	if err := fs.db.Exec("call teldrive.delete_files($1)", payload.Files).Error; err != nil {
+	// Items deleted from a shared folder go to the trash of its owner.
+	ownerId, appErr := fs.itemsOwner(userId, payload.Files)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if err := fs.db.Exec("select teldrive.trash_files($1, $2)", payload.Files, ownerId).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
-	return &schemas.Message{Message: "files deleted"}, nil
+	if fs.trash.Retention == 0 {
+		return fs.purgeTrash(fs.db.Where("id IN ?", payload.Files), ownerId)
+	}
+
+	return &schemas.Message{Message: "files moved to trash"}, nil
 }
 
 func (fs *FileService) MoveDirectory(userId int64, payload *schemas.DirMove) (*schemas.Message, *types.AppError) {
 
-	if err := fs.db.Exec("select * from teldrive.move_directory(? , ? , ?)", payload.Source,
-		payload.Destination, userId).Error; err != nil {
+	src, err := fs.names.EncryptPath(userId, payload.Source)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	dest, err := fs.names.EncryptPath(userId, payload.Destination)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	if err := fs.db.Exec("select * from teldrive.move_directory(? , ? , ?)", src,
+		dest, userId).Error; err != nil {
 		return nil, &types.AppError{Error: err}
 	}
 
@@ -300,18 +569,59 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 
 	userId, session := GetUserAuth(c)
 
-	client, _ := tgc.AuthClient(c, fs.cnf, session)
+	ids, paths := []string{payload.ID}, []string{payload.Destination}
+	if payload.DestinationID != "" {
+		ids, paths = append(ids, payload.DestinationID), nil
+	}
+
+	if appErr := fs.CheckTokenPath(c, ids, paths...); appErr != nil {
+		return nil, appErr
+	}
+
+	source, appErr := authorizeFile(fs.db, userId, payload.ID, roleViewer)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Parts can only be sent again within the channels of their owner, so files of a shared
+	// folder are copied within the drive of its owner.
+	var dest *models.File
+	if payload.DestinationID != "" {
+		if dest, appErr = authorizeFolder(fs.db, userId, payload.DestinationID, roleEditor); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	ownerId := source.UserID
+	if (dest == nil && ownerId != userId) || (dest != nil && dest.UserID != ownerId) {
+		return nil, &types.AppError{Error: errOtherDrive, Code: http.StatusBadRequest}
+	}
+
+	if ownerId != userId {
+		owner, err := getUserSession(fs.db, ownerId)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+		session = owner.Session
+	}
+
+	name, err := fs.names.Encrypt(ownerId, payload.Name)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
 
-	var res []models.File
+	client, _ := tgc.AuthClient(c, fs.cnf, session)
 
-	fs.db.Model(&models.File{}).Where("id = ?", payload.ID).Find(&res)
+	file := mapper.ToFileOutFull(*source)
 
-	file := mapper.ToFileOutFull(res[0])
+	if err := fs.checkFileQuota(fs.db, ownerId, "", "", file.Size); err != nil {
+		return nil, err
+	}
 
 	newIds := models.Parts{}
 
-	err := tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
-		user := strconv.FormatInt(userId, 10)
+	err = tgc.RunWithAuth(c, client, "", func(ctx context.Context) error {
+		user := strconv.FormatInt(ownerId, 10)
 		messages, err := getTGMessages(c, client, file.Parts, file.ChannelID, user)
 		if err != nil {
 			return err
@@ -321,37 +631,19 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 		if err != nil {
 			return err
 		}
-		for _, message := range messages.Messages {
+		for i, message := range messages.Messages {
 			item := message.(*tg.Message)
 			media := item.Media.(*tg.MessageMediaDocument)
 			document := media.Document.(*tg.Document)
 
-			id, _ := randInt64()
-			request := tg.MessagesSendMediaRequest{
-				Silent:   true,
-				Peer:     &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
-				Media:    &tg.InputMediaDocument{ID: document.AsInput()},
-				RandomID: id,
-			}
-			res, err := client.API().MessagesSendMedia(c, &request)
-
+			id, err := resendDocument(c, client, channel, document)
 			if err != nil {
 				return err
 			}
 
-			updates := res.(*tg.Updates)
-
-			var msg *tg.Message
-
-			for _, update := range updates.Updates {
-				channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
-				if ok {
-					msg = channelMsg.Message.(*tg.Message)
-					break
-				}
-
-			}
-			newIds = append(newIds, models.Part{ID: int64(msg.ID)})
+			part := file.Parts[i]
+			newIds = append(newIds, models.Part{ID: int64(id), Salt: part.Salt, KeyID: part.KeyID,
+				Sha256: part.Sha256, Md5: part.Md5})
 
 		}
 		return nil
@@ -361,33 +653,45 @@ func (fs *FileService) CopyFile(c *gin.Context) (*schemas.FileOut, *types.AppErr
 		return nil, &types.AppError{Error: err}
 	}
 
-	var destRes []models.File
+	if dest == nil {
+		destination, err := fs.names.EncryptPath(userId, payload.Destination)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
 
-	if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, payload.Destination).Scan(&destRes).Error; err != nil {
-		return nil, &types.AppError{Error: err}
-	}
+		var destRes []models.File
 
-	dest := destRes[0]
+		if err := fs.db.Raw("select * from teldrive.create_directories(?, ?)", userId, destination).Scan(&destRes).Error; err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+
+		dest = &destRes[0]
+	}
 
 	dbFile := models.File{}
 
-	dbFile.Name = payload.Name
+	dbFile.Name = name
 	dbFile.Size = &file.Size
 	dbFile.Type = file.Type
 	dbFile.MimeType = file.MimeType
 	dbFile.Parts = &newIds
-	dbFile.UserID = userId
+	dbFile.UserID = ownerId
 	dbFile.Starred = false
 	dbFile.Status = "active"
 	dbFile.ParentID = dest.ID
 	dbFile.ChannelID = &file.ChannelID
 	dbFile.Encrypted = file.Encrypted
+	dbFile.Sha256 = source.Sha256
+	dbFile.Md5 = source.Md5
 
-	if err := fs.db.Create(&dbFile).Error; err != nil {
-		return nil, &types.AppError{Error: err}
+	// The quota is checked again with the quota lock held while the copy is stored.
+	if appErr := fs.insertFile(&dbFile); appErr != nil {
+		return nil, appErr
 	}
 
-	return mapper.ToFileOut(dbFile), nil
+	fs.queueThumbnail(&dbFile)
+
+	return fs.toFileOut(dbFile), nil
 }
 
 func (fs *FileService) GetFileStream(c *gin.Context) {
@@ -398,50 +702,83 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 
 	fileID := c.Param("fileID")
 
-	authHash := c.Query("hash")
+	var err error
 
-	if authHash == "" {
-		http.Error(w, "missing hash param", http.StatusBadRequest)
+	session, share, appErr := fs.streamSession(c, fileID)
+	if appErr != nil {
+		http.Error(w, appErr.Error.Error(), appErr.Code)
 		return
 	}
-	cache := cache.FromContext(c)
 
-	session, err := getSessionByHash(fs.db, cache, authHash)
-
-	if err != nil {
-		http.Error(w, "invalid hash", http.StatusBadRequest)
+	file, appErr := fs.cachedFile(c, fileID)
+	if appErr != nil {
+		http.Error(w, appErr.Error.Error(), appErr.Code)
 		return
 	}
 
-	file := &schemas.FileOutFull{}
-
-	key := fmt.Sprintf("files:%s", fileID)
-
-	err = cache.Get(key, file)
-
-	var appErr *types.AppError
-
-	if err != nil {
-		file, appErr = fs.GetFileByID(fileID)
-		if appErr != nil {
-			http.Error(w, appErr.Error.Error(), http.StatusBadRequest)
+	if versionId := c.Query("version"); versionId != "" {
+		version, err := getVersion(fs.db, file.ID, versionId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		cache.Set(key, file, 0)
+		file.Parts = []schemas.Part{}
+		if version.Parts != nil {
+			for _, part := range *version.Parts {
+				file.Parts = append(file.Parts, schemas.Part{ID: part.ID, Salt: part.Salt, KeyID: part.KeyID})
+			}
+		}
+		// The version is part of the ID so that the cached messages of the file are not reused.
+		file.ID = fmt.Sprintf("%s-version-%s", fileID, version.ID)
+		file.Size = version.Size
+		file.ChannelID = version.ChannelID
+		file.MimeType = version.MimeType
+		file.Encrypted = version.Encrypted
+		file.UpdatedAt = version.ModifiedAt
+	}
+
+	// A share download is counted when a request starts at the first byte, requests for
+	// later bytes are refused once the share reached its download limit.
+	countDownload := func(start int64) bool {
+		if share == nil || r.Method == "HEAD" {
+			return true
+		}
+		if start != 0 {
+			if shareExhausted(share) {
+				http.Error(w, errShareLimitReached.Error(), http.StatusGone)
+				return false
+			}
+			return true
+		}
+		ok, err := countShareDownload(fs.db, share)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		if !ok {
+			http.Error(w, errShareLimitReached.Error(), http.StatusGone)
+			return false
+		}
+		return true
 	}
 
 	c.Header("Accept-Ranges", "bytes")
 
-	var start, end int64
+	etag := httputil.ETag(fileID, strconv.FormatInt(file.Size, 10),
+		strconv.FormatInt(file.UpdatedAt.UnixNano(), 10), c.Query("version"))
 
-	rangeHeader := r.Header.Get("Range")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
 
-	if rangeHeader == "" {
-		start = 0
-		end = file.Size - 1
-		w.WriteHeader(http.StatusOK)
-	} else {
-		ranges, err := http_range.Parse(rangeHeader, file.Size)
+	if httputil.NotModified(r, etag, file.UpdatedAt) {
+		httputil.WriteNotModified(w)
+		return
+	}
+
+	var ranges []*http_range.Range
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && httputil.RangeApplies(r, etag, file.UpdatedAt) {
+		ranges, err = http_range.Parse(rangeHeader, file.Size)
 		if err == http_range.ErrNoOverlap {
 			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
 			http.Error(w, http_range.ErrNoOverlap.Error(), http.StatusRequestedRangeNotSatisfiable)
@@ -451,18 +788,21 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if len(ranges) > 1 {
-			http.Error(w, "multiple ranges are not supported", http.StatusRequestedRangeNotSatisfiable)
-			return
+		// Ranges adding up to more than the file are served as the whole file.
+		if http_range.SumSize(ranges) > file.Size {
+			ranges = nil
 		}
-		start = ranges[0].Start
-		end = ranges[0].End
-		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, file.Size))
+	}
+
+	start, end := int64(0), file.Size-1
 
-		w.WriteHeader(http.StatusPartialContent)
+	if len(ranges) > 0 {
+		start, end = ranges[0].Start, ranges[0].End
 	}
 
-	contentLength := end - start + 1
+	if !countDownload(start) {
+		return
+	}
 
 	mimeType := file.MimeType
 
@@ -470,11 +810,27 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 		mimeType = "application/octet-stream"
 	}
 
-	c.Header("Content-Type", mimeType)
+	contentLength := end - start + 1
+
+	status := http.StatusOK
+
+	var boundary string
+
+	switch {
+	case len(ranges) == 1:
+		c.Header("Content-Range", ranges[0].ContentRange(file.Size))
+		c.Header("Content-Type", mimeType)
+		status = http.StatusPartialContent
+	case len(ranges) > 1:
+		boundary = multipart.NewWriter(io.Discard).Boundary()
+		contentLength = http_range.MultipartSize(ranges, mimeType, file.Size, boundary)
+		c.Header("Content-Type", "multipart/byteranges; boundary="+boundary)
+		status = http.StatusPartialContent
+	default:
+		c.Header("Content-Type", mimeType)
+	}
 
 	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
-	c.Header("E-Tag", fmt.Sprintf("\"%s\"", md5.FromString(file.ID+strconv.FormatInt(file.Size, 10))))
-	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
 
 	disposition := "inline"
 
@@ -484,81 +840,392 @@ func (fs *FileService) GetFileStream(c *gin.Context) {
 
 	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
 
-	tokens, err := getBotsToken(c, fs.db, session.UserId, file.ChannelID)
+	w.WriteHeader(status)
 
 	logger := logging.FromContext(c)
+
+	logger.Debugw("requesting file", "name", file.Name, "start", start, "end", end, "ranges", len(ranges),
+		"fileSize", file.Size)
+
+	// Empty files have no parts to read.
+	if r.Method == "HEAD" || file.Size == 0 {
+		return
+	}
+
+	client, channelUser, err := fs.getStreamClient(c, session.UserId, session.Session, file.ChannelID)
 	if err != nil {
-		logger.Error("failed to get bots", zap.Error(err))
+		logger.Error("file stream", zap.Error(err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if len(ranges) > 1 {
+		mw := multipart.NewWriter(w)
+		mw.SetBoundary(boundary)
+		for _, ra := range ranges {
+			part, err := mw.CreatePart(ra.MIMEHeader(mimeType, file.Size))
+			if err != nil {
+				return
+			}
+			if err := fs.copyRange(c, client.Tg, channelUser, file, part, ra.Start, ra.End); err != nil {
+				logger.Error("file stream", zap.Error(err))
+				return
+			}
+		}
+		mw.Close()
+		return
+	}
+
+	if err := fs.copyRange(c, client.Tg, channelUser, file, w, start, end); err != nil {
+		logger.Error("file stream", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// streamSession authenticates a stream request for fileID by the session hash or the
+// share given in the query, or by an API token with the read scope.
+func (fs *FileService) streamSession(c *gin.Context, fileID string) (*models.Session, *models.Share, *types.AppError) {
+	authHash := c.Query("hash")
+
+	shareId := c.Query("share")
+
+	token := apiToken(c)
+
+	if authHash == "" && shareId == "" && token == "" {
+		return nil, nil, &types.AppError{Error: errors.New("missing hash param"), Code: http.StatusBadRequest}
+	}
+
 	var (
-		channelUser string
-		lr          io.ReadCloser
+		session *models.Session
+		share   *models.Share
+		err     error
+		appErr  *types.AppError
 	)
 
-	var client *tgc.Client
+	if shareId != "" {
+		if c.Query("version") != "" {
+			return nil, nil, &types.AppError{Error: errors.New("versions can't be streamed from a share"), Code: http.StatusBadRequest}
+		}
+		share, appErr = getShare(fs.db, shareId, c.Query("key"))
+		if appErr != nil {
+			return nil, nil, appErr
+		}
+		session, err = getUserSession(fs.db, share.UserID)
+	} else if authHash != "" {
+		session, err = getSessionByHash(fs.db, cache.FromContext(c), authHash)
+	} else {
+		claims, err := verifyAPIToken(fs.db, token)
+		if err != nil {
+			return nil, nil, &types.AppError{Error: err, Code: http.StatusUnauthorized}
+		}
+		if !claims.HasScope(types.ScopeRead) {
+			return nil, nil, &types.AppError{Error: errors.New("token lacks the read scope"), Code: http.StatusForbidden}
+		}
+		userId, _ := strconv.ParseInt(claims.Subject, 10, 64)
+		if claims.Path != "" {
+			ok, err := fs.filesWithin(userId, claims.Path, []string{fileID})
+			if err != nil {
+				return nil, nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+			}
+			if !ok {
+				return nil, nil, &types.AppError{Error: errTokenPath, Code: http.StatusForbidden}
+			}
+		}
+		session = &models.Session{UserId: userId, Hash: claims.Hash, Session: claims.TgSession}
+	}
+
+	if err != nil {
+		return nil, nil, &types.AppError{Error: errors.New("invalid hash"), Code: http.StatusBadRequest}
+	}
 
-	if fs.cnf.DisableStreamBots || len(tokens) == 0 {
-		tgClient, _ := tgc.AuthClient(c, fs.cnf, session.Session)
-		client, err = fs.worker.UserWorker(tgClient, session.UserId)
+	if share != nil {
+		ok, err := shareContains(fs.db, share, fileID)
 		if err != nil {
-			logger.Error("file stream", zap.Error(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		}
+		if !ok {
+			return nil, nil, &types.AppError{Error: errShareNotFound, Code: http.StatusNotFound}
 		}
-		channelUser = strconv.FormatInt(session.UserId, 10)
+		return session, share, nil
+	}
 
-		logger.Debugw("requesting file", "name", file.Name, "bot", channelUser, "user", channelUser, "start", start,
-			"end", end, "fileSize", file.Size)
+	file, appErr := authorizeFile(fs.db, session.UserId, fileID, roleViewer)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
 
-	} else {
-		var index int
+	// Files of a folder shared with the user are read with the session of their owner.
+	if file.UserID != session.UserId {
+		if session, err = getUserSession(fs.db, file.UserID); err != nil {
+			return nil, nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+		}
+	}
+
+	return session, nil, nil
+}
+
+func (fs *FileService) cachedFile(c context.Context, fileID string) (*schemas.FileOutFull, *types.AppError) {
+	cache := cache.FromContext(c)
+
+	file := &schemas.FileOutFull{}
+
+	key := fmt.Sprintf("files:%s", fileID)
+
+	if err := cache.Get(key, file); err == nil {
+		return file, nil
+	}
+
+	file, appErr := fs.getFile(fileID)
+	if appErr != nil {
+		return nil, &types.AppError{Error: appErr.Error, Code: http.StatusBadRequest}
+	}
+	cache.Set(key, file, 0)
+	return file, nil
+}
 
-		limit := min(len(tokens), fs.cnf.BgBotsLimit)
+// copyRange writes the bytes from start to end of file to w.
+func (fs *FileService) copyRange(ctx context.Context, client *telegram.Client, channelUser string,
+	file *schemas.FileOutFull, w io.Writer, start, end int64) error {
+	if end < start {
+		return nil
+	}
+
+	lr, err := fs.newFileReader(ctx, client, channelUser, file, start, end)
+	if err != nil {
+		return err
+	}
+	if lr == nil {
+		return errors.New("failed to initialise reader")
+	}
+	defer lr.Close()
+
+	_, err = io.CopyN(w, lr, end-start+1)
+	return err
+}
+
+func (fs *FileService) getStreamClient(c context.Context, userId int64, tgSession string, channelId int64) (*tgc.Client, string, error) {
+
+	logger := logging.FromContext(c)
 
-		fs.worker.Set(tokens[:limit], file.ChannelID)
+	tokens, err := getBotsToken(c, fs.db, userId, channelId)
 
-		client, index, err = fs.worker.Next(file.ChannelID)
+	if err != nil {
+		logger.Error("failed to get bots", zap.Error(err))
+		return nil, "", err
+	}
 
+	if fs.cnf.DisableStreamBots || len(tokens) == 0 {
+		tgClient, _ := tgc.AuthClient(c, fs.cnf, tgSession)
+		client, err := fs.worker.UserWorker(tgClient, userId)
 		if err != nil {
-			logger.Error("file stream", zap.Error(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, "", err
 		}
-		channelUser = strings.Split(tokens[index], ":")[0]
-		logger.Debugw("requesting file", "name", file.Name, "bot", channelUser, "botNo", index, "start", start,
-			"end", end, "fileSize", file.Size)
+		channelUser := strconv.FormatInt(userId, 10)
+
+		logger.Debugw("using user client", "user", channelUser)
+
+		return client, channelUser, nil
+	}
+
+	limit := min(len(tokens), fs.cnf.BgBotsLimit)
+
+	fs.worker.Set(tokens[:limit], channelId)
+
+	client, index, err := fs.worker.Next(channelId)
+
+	if err != nil {
+		return nil, "", err
+	}
+	channelUser := strings.Split(tokens[index], ":")[0]
+
+	logger.Debugw("using bot client", "bot", channelUser, "botNo", index)
+
+	return client, channelUser, nil
+}
+
+func (fs *FileService) newFileReader(ctx context.Context, client *telegram.Client, channelUser string,
+	file *schemas.FileOutFull, start, end int64) (io.ReadCloser, error) {
+
+	parts, err := getParts(ctx, client, file, channelUser)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := append([]reader.Source{{Client: client, Parts: parts}}, fs.botSources(ctx, client, file)...)
+
+	cnf := &reader.Config{Concurrency: fs.cnf.Stream.Concurrency, BufferSize: fs.cnf.Stream.BufferSize}
+
+	// A cache that failed to open is logged at startup.
+	cnf.Cache, _ = chunkcache.Default()
+
+	if file.Encrypted {
+		return reader.NewDecryptedReader(ctx, sources, start, end, newKeyring(fs.db, fs.cnf).Password, cnf)
+	}
+	return reader.NewLinearReader(ctx, sources, start, end, cnf)
+}
+
+// botSources returns the other stream bots of the file's channel when streams are
+// spread over several bots. Bots that can't see the file are left out.
+func (fs *FileService) botSources(ctx context.Context, primary *telegram.Client, file *schemas.FileOutFull) []reader.Source {
+	if !fs.cnf.Stream.MultiBots || fs.cnf.DisableStreamBots || fs.worker == nil {
+		return nil
+	}
+
+	clients, tokens, err := fs.worker.Clients(file.ChannelID)
+	if err != nil {
+		logging.FromContext(ctx).Debugw("stream bots unavailable", "err", err)
+		return nil
 	}
 
-	if r.Method != "HEAD" {
-		parts, err := getParts(c, client.Tg, file, channelUser)
+	sources := []reader.Source{}
+	for i, client := range clients {
+		if client.Tg == primary || i >= len(tokens) {
+			continue
+		}
+		parts, err := getParts(ctx, client.Tg, file, strings.Split(tokens[i], ":")[0])
 		if err != nil {
-			logger.Error("file stream", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			continue
 		}
+		sources = append(sources, reader.Source{Client: client.Tg, Parts: parts})
+	}
+	return sources
+}
 
-		if file.Encrypted {
-			lr, err = reader.NewDecryptedReader(c, client.Tg, parts, start, end, fs.cnf.Uploads.EncryptionKey)
-		} else {
-			lr, err = reader.NewLinearReader(c, client.Tg, parts, start, end)
-		}
+// fileReadSeeker opens a reader lazily at the current offset, so seeking consumers
+// such as http.ServeContent only download the bytes they actually read.
+type fileReadSeeker struct {
+	ctx     context.Context
+	fs      *FileService
+	userId  int64
+	session string
+	file    *schemas.FileOutFull
+	pos     int64
+	reader  io.ReadCloser
+}
+
+func (fs *FileService) newFileReadSeeker(ctx context.Context, userId int64, session string,
+	file *schemas.FileOutFull) *fileReadSeeker {
+	return &fileReadSeeker{ctx: ctx, fs: fs, userId: userId, session: session, file: file}
+}
 
+func (f *fileReadSeeker) Read(p []byte) (int, error) {
+	if f.pos >= f.file.Size {
+		return 0, io.EOF
+	}
+	if f.reader == nil {
+		client, channelUser, err := f.fs.getStreamClient(f.ctx, f.userId, f.session, f.file.ChannelID)
 		if err != nil {
-			logger.Error("file stream", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return 0, err
 		}
-		if lr == nil {
-			http.Error(w, "failed to initialise reader", http.StatusInternalServerError)
-			return
+		f.reader, err = f.fs.newFileReader(f.ctx, client.Tg, channelUser, f.file, f.pos, f.file.Size-1)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.reader.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *fileReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		pos = f.file.Size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	if pos != f.pos && f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+func (f *fileReadSeeker) Close() error {
+	if f.reader != nil {
+		err := f.reader.Close()
+		f.reader = nil
+		return err
+	}
+	return nil
+}
+
+// setChecksums fills in the hashes computed while the parts of file were uploaded and the
+// keys they were encrypted with. The hashes of the whole file are only known when its
+// parts were uploaded in order.
+func (fs *FileService) setChecksums(file *models.File) {
+	if file.Parts == nil || len(*file.Parts) == 0 {
+		return
+	}
+
+	parts := *file.Parts
+
+	ids := []int{}
+	for _, part := range parts {
+		ids = append(ids, int(part.ID))
+	}
+
+	var uploads []models.Upload
+
+	if err := fs.db.Where("user_id = ?", file.UserID).Where("channel_id = ?", *file.ChannelID).
+		Where("part_id IN ?", ids).Find(&uploads).Error; err != nil {
+		return
+	}
+
+	byPart := make(map[int64]*models.Upload, len(uploads))
+	for i := range uploads {
+		byPart[int64(uploads[i].PartId)] = &uploads[i]
+	}
+
+	inOrder := true
+
+	last := byPart[parts[len(parts)-1].ID]
+
+	for i := range parts {
+		upload, ok := byPart[parts[i].ID]
+		if !ok {
+			inOrder = false
+			continue
 		}
+		parts[i].Sha256, parts[i].Md5 = upload.Sha256, upload.Md5
+		parts[i].KeyID = upload.KeyID
+		if last == nil || upload.UploadId != last.UploadId || upload.PartNo != i+1 {
+			inOrder = false
+		}
+	}
 
-		io.CopyN(w, lr, contentLength)
+	if !inOrder || last.HashState == nil {
+		return
+	}
+
+	hasher, err := checksum.Resume(last.HashState)
+	if err != nil {
+		return
 	}
+
+	shaSum, md5Sum := hasher.Sums()
+	file.Sha256, file.Md5 = &shaSum, &md5Sum
 }
+
+// replaceFile creates a file. An existing file with the same name in the destination
+// folder keeps its previous content as a version.
+func (fs *FileService) replaceFile(ctx context.Context, userId int64, fileIn *schemas.FileIn) (*schemas.FileOut, error) {
+	out, err := fs.CreateFile(ctx, userId, fileIn)
+	if err != nil {
+		return nil, err.Error
+	}
+	return out, nil
+}
+
 func setOrderFilter(query *gorm.DB, fquery *schemas.FileQuery) *gorm.DB {
 	if fquery.NextPageToken != "" {
 		sortColumn := utils.CamelToSnake(fquery.Sort)
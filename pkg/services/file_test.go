@@ -3,6 +3,7 @@ package services
 import (
 	"testing"
 
+	"github.com/divyam234/teldrive/internal/config"
 	"github.com/divyam234/teldrive/internal/database"
 	"github.com/gin-gonic/gin"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/divyam234/teldrive/pkg/schemas"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileServiceSuite struct {
@@ -21,7 +23,7 @@ type FileServiceSuite struct {
 
 func (s *FileServiceSuite) SetupSuite() {
 	s.db = database.NewTestDatabase(s.T(), false)
-	s.srv = NewFileService(s.db, nil, nil)
+	s.srv = NewFileService(s.db, &config.Config{}, nil)
 }
 
 func (s *FileServiceSuite) SetupTest() {
@@ -58,7 +60,7 @@ func TestSuite(t *testing.T) {
 func (s *FileServiceSuite) TestSave() {
 	res, err := s.srv.CreateFile(&gin.Context{}, 123456, s.entry("file.jpeg"))
 	s.NoError(err.Error)
-	find, err := s.srv.GetFileByID(res.ID)
+	find, err := s.srv.GetFileByID(123456, res.ID)
 	s.NoError(err.Error)
 	s.Equal(find.ID, res.ID)
 	s.Equal(find.MimeType, res.MimeType)
@@ -66,12 +68,26 @@ func (s *FileServiceSuite) TestSave() {
 
 func (s *FileServiceSuite) TestSave_Duplicate() {
 	c := &gin.Context{}
-	_, err := s.srv.CreateFile(c, 123456, s.entry("file1.jpeg"))
+	first, err := s.srv.CreateFile(c, 123456, s.entry("file1.jpeg"))
 	s.NoError(err.Error)
 
-	_, err = s.srv.CreateFile(c, 123456, s.entry("file1.jpeg"))
+	second, err := s.srv.CreateFile(c, 123456, s.entry("file1.jpeg"))
+	s.NoError(err.Error)
+	s.Equal(first.ID, second.ID)
+
+	versions, err := s.srv.ListVersions(123456, first.ID)
+	s.NoError(err.Error)
+	s.Len(versions, 1)
+}
+
+func (s *FileServiceSuite) TestSave_DuplicateFolder() {
+	c := &gin.Context{}
+	_, err := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "dir", Type: "folder", Path: "/"})
+	s.NoError(err.Error)
+
+	_, err = s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "dir", Type: "folder", Path: "/"})
 	s.Error(err.Error)
-	s.Equal(database.ErrKeyConflict, err)
+	s.Equal(database.ErrKeyConflict, err.Error)
 }
 
 func (s *FileServiceSuite) Test_Update() {
@@ -90,7 +106,83 @@ func (s *FileServiceSuite) Test_Update() {
 }
 
 func (s *FileServiceSuite) Test_NoFound() {
-	_, err := s.srv.GetFileByID("kj2ei28bdkj")
+	_, err := s.srv.GetFileByID(123456, "kj2ei28bdkj")
 	s.Error(err.Error)
 	s.Equal(err, database.ErrNotFound)
 }
+
+func (s *FileServiceSuite) Test_SharedFolder() {
+	c := &gin.Context{}
+	s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&[]models.User{{UserId: 123456}, {UserId: 654321}})
+
+	dir, err := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "shared", Type: "folder", Path: "/"})
+	s.Nil(err)
+	sub, err := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "sub", Type: "folder", Path: "/shared"})
+	s.Nil(err)
+	file := s.entry("file.jpeg")
+	file.Path = "/shared/sub"
+	res, err := s.srv.CreateFile(c, 123456, file)
+	s.Nil(err)
+
+	_, err = s.srv.GetFileByID(654321, res.ID)
+	s.Equal(database.ErrNotFound, err.Error)
+
+	_, err = s.srv.CreateGrant(123456, dir.ID, &schemas.GrantIn{UserID: 654321, Role: "viewer"})
+	s.Nil(err)
+
+	find, err := s.srv.GetFileByID(654321, res.ID)
+	s.Nil(err)
+	s.Equal(res.ID, find.ID)
+
+	list, err := s.srv.ListFiles(654321, &schemas.FileQuery{Op: "list", ParentID: sub.ID, PerPage: 10,
+		Sort: "name", Order: "asc"})
+	s.Nil(err)
+	s.Len(list.Files, 1)
+
+	_, err = s.srv.DeleteFiles(654321, &schemas.FileOperation{Files: []string{res.ID}})
+	s.Equal(errAccessDenied, err.Error)
+
+	shared, err := s.srv.ListSharedWithMe(654321)
+	s.Nil(err)
+	s.Len(shared, 1)
+	s.Equal("viewer", shared[0].Role)
+}
+
+func (s *FileServiceSuite) Test_UpdateSharedFile() {
+	c := &gin.Context{}
+	s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&[]models.User{{UserId: 123456}, {UserId: 654321},
+		{UserId: 765432}})
+
+	dir, err := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "shared", Type: "folder", Path: "/"})
+	s.Nil(err)
+	file := s.entry("file.jpeg")
+	file.Path = "/shared"
+	res, err := s.srv.CreateFile(c, 123456, file)
+	s.Nil(err)
+	s.db.Create(&models.File{Name: "root", Type: "folder", MimeType: "drive/folder", Path: "/",
+		Depth: utils.IntPointer(0), UserID: 765432, Status: "active", ParentID: "root"})
+	other, err := s.srv.CreateFile(c, 765432, &schemas.FileIn{Name: "other", Type: "folder", Path: "/"})
+	s.Nil(err)
+
+	_, err = s.srv.UpdateFile(res.ID, 654321, &schemas.FileUpdate{Name: "renamed.jpeg"})
+	s.Equal(database.ErrNotFound, err.Error)
+
+	_, err = s.srv.CreateGrant(123456, dir.ID, &schemas.GrantIn{UserID: 654321, Role: "viewer"})
+	s.Nil(err)
+	_, err = s.srv.CreateGrant(123456, dir.ID, &schemas.GrantIn{UserID: 765432, Role: "editor"})
+	s.Nil(err)
+
+	_, err = s.srv.UpdateFile(res.ID, 654321, &schemas.FileUpdate{Name: "renamed.jpeg"})
+	s.Equal(errAccessDenied, err.Error)
+
+	// Files can't be moved out of the drive of their owner.
+	_, err = s.srv.UpdateFile(res.ID, 765432, &schemas.FileUpdate{ParentID: other.ID})
+	s.Equal(errOtherDrive, err.Error)
+
+	_, err = s.srv.UpdateFile(res.ID, 765432, &schemas.FileUpdate{Name: "renamed.jpeg"})
+	s.Nil(err)
+
+	find, err := s.srv.GetFileByID(123456, res.ID)
+	s.Nil(err)
+	s.Equal("renamed.jpeg", find.Name)
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	roleViewer = "viewer"
+	roleEditor = "editor"
+	roleOwner  = "owner"
+)
+
+// roleRanks orders the roles of a grant, each role includes the rights of the ones below it.
+// Viewers list and download, editors also upload, move and delete, owners also manage grants.
+var roleRanks = map[string]int{roleViewer: 1, roleEditor: 2, roleOwner: 3}
+
+var (
+	errAccessDenied  = errors.New("access denied")
+	errGrantNotFound = errors.New("grant not found")
+	errNotFolder     = errors.New("not a folder")
+	errOtherDrive    = errors.New("items of different drives can't be moved or copied together")
+)
+
+type grantRow struct {
+	models.FolderGrant
+	UserName string
+	Name     string
+}
+
+// folderRole returns the role of userId in the folder at folderPath of ownerId. Grants are
+// inherited, the highest role granted on the folder or on a folder above it applies.
+func folderRole(db *gorm.DB, userId, ownerId int64, folderPath string) (string, error) {
+	if userId == ownerId {
+		return roleOwner, nil
+	}
+	if folderPath == "" {
+		return "", nil
+	}
+
+	var roles []string
+	if err := db.Raw(`SELECT g.role FROM teldrive.folder_grants AS g
+		JOIN teldrive.files AS f ON f.id = g.folder_id
+		WHERE g.user_id = ? AND f.user_id = ? AND f.type = 'folder' AND f.status = 'active'
+		AND (f.path = ? OR left(?, length(f.path) + 1) = f.path || '/')`,
+		userId, ownerId, folderPath, folderPath).Scan(&roles).Error; err != nil {
+		return "", err
+	}
+
+	role := ""
+	for _, r := range roles {
+		if roleRanks[r] > roleRanks[role] {
+			role = r
+		}
+	}
+	return role, nil
+}
+
+// fileRole returns the role of userId on file, files get the role of the folder they are in.
+func fileRole(db *gorm.DB, userId int64, file *models.File) (string, error) {
+	if file.UserID == userId {
+		return roleOwner, nil
+	}
+	if file.Status != "active" {
+		return "", nil
+	}
+
+	folderPath := file.Path
+	if file.Type != "folder" {
+		var paths []string
+		if err := db.Model(&models.File{}).Where("id = ?", file.ParentID).Where("status = ?", "active").
+			Pluck("path", &paths).Error; err != nil {
+			return "", err
+		}
+		if len(paths) == 0 {
+			return "", nil
+		}
+		folderPath = paths[0]
+	}
+
+	return folderRole(db, userId, file.UserID, folderPath)
+}
+
+// authorizeFile returns the file with id when userId owns it or holds at least role on it.
+// Files the user can't see at all are reported as not found.
+func authorizeFile(db *gorm.DB, userId int64, id, role string) (*models.File, *types.AppError) {
+	var file models.File
+	if err := db.Where("id = ?", id).First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	got, err := fileRole(db, userId, &file)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	if got == "" {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	if roleRanks[got] < roleRanks[role] {
+		return nil, &types.AppError{Error: errAccessDenied, Code: http.StatusForbidden}
+	}
+
+	return &file, nil
+}
+
+// authorizeFolder is authorizeFile for an active folder.
+func authorizeFolder(db *gorm.DB, userId int64, id, role string) (*models.File, *types.AppError) {
+	folder, err := authorizeFile(db, userId, id, role)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Type != "folder" || folder.Status != "active" {
+		return nil, &types.AppError{Error: errNotFolder, Code: http.StatusBadRequest}
+	}
+	return folder, nil
+}
+
+// itemsOwner returns the owner of items that are moved or deleted. The items must belong to
+// one drive and userId must be able to edit the folders they are in, so the folder that is
+// shared can't be moved or deleted by the users it is shared with.
+func (fs *FileService) itemsOwner(userId int64, ids []string) (int64, *types.AppError) {
+	var files []models.File
+	if err := fs.db.Select("id", "user_id", "parent_id", "status").Where("id IN ?", ids).
+		Find(&files).Error; err != nil {
+		return 0, &types.AppError{Error: err}
+	}
+
+	if len(files) == 0 {
+		return userId, nil
+	}
+
+	ownerId := files[0].UserID
+	parents := map[string]bool{}
+
+	for _, file := range files {
+		if file.UserID != ownerId {
+			return 0, &types.AppError{Error: errOtherDrive, Code: http.StatusBadRequest}
+		}
+		if file.UserID == userId {
+			continue
+		}
+		if file.Status != "active" {
+			return 0, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		parents[file.ParentID] = true
+	}
+
+	for parentId := range parents {
+		if _, err := authorizeFolder(fs.db, userId, parentId, roleEditor); err != nil {
+			return 0, err
+		}
+	}
+
+	return ownerId, nil
+}
+
+func (fs *FileService) toGrantOut(row *grantRow) *schemas.GrantOut {
+	return &schemas.GrantOut{
+		ID:        row.ID,
+		FolderID:  row.FolderID,
+		UserID:    row.UserID,
+		UserName:  row.UserName,
+		Name:      row.Name,
+		Role:      row.Role,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// ListGrants lists the grants on a folder. Only the owner of the folder and the users it
+// is shared with as owners see them.
+func (fs *FileService) ListGrants(userId int64, folderId string) ([]schemas.GrantOut, *types.AppError) {
+	folder, appErr := authorizeFolder(fs.db, userId, folderId, roleOwner)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rows := []grantRow{}
+	if err := fs.db.Table("teldrive.folder_grants AS g").Select("g.*, u.user_name, u.name").
+		Joins("JOIN teldrive.users AS u ON u.user_id = g.user_id").Where("g.folder_id = ?", folder.ID).
+		Order("g.created_at").Scan(&rows).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	grants := []schemas.GrantOut{}
+	for i := range rows {
+		grants = append(grants, *fs.toGrantOut(&rows[i]))
+	}
+	return grants, nil
+}
+
+// CreateGrant shares a folder with another user of the server, granting again changes the role.
+func (fs *FileService) CreateGrant(userId int64, folderId string, payload *schemas.GrantIn) (*schemas.GrantOut, *types.AppError) {
+	folder, appErr := authorizeFolder(fs.db, userId, folderId, roleOwner)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if folder.ParentID == "root" {
+		return nil, &types.AppError{Error: errors.New("root folder can't be shared"), Code: http.StatusBadRequest}
+	}
+
+	query := fs.db
+	switch {
+	case payload.UserID != 0:
+		query = query.Where("user_id = ?", payload.UserID)
+	case payload.UserName != "":
+		query = query.Where("user_name = ?", payload.UserName)
+	default:
+		return nil, &types.AppError{Error: errors.New("missing user"), Code: http.StatusBadRequest}
+	}
+
+	var user models.User
+	if err := query.First(&user).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errors.New("user not found"), Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	if user.UserId == folder.UserID {
+		return nil, &types.AppError{Error: errors.New("folder belongs to the user"), Code: http.StatusBadRequest}
+	}
+
+	row := grantRow{
+		FolderGrant: models.FolderGrant{FolderID: folder.ID, UserID: user.UserId, Role: payload.Role, CreatedBy: userId},
+		UserName:    user.UserName,
+		Name:        user.Name,
+	}
+
+	if err := fs.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "folder_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}, clause.Returning{}).Create(&row.FolderGrant).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return fs.toGrantOut(&row), nil
+}
+
+// DeleteGrant stops sharing a folder with a user. Users can also leave a folder shared with them.
+func (fs *FileService) DeleteGrant(userId int64, folderId string, granteeId int64) (*schemas.Message, *types.AppError) {
+	if granteeId != userId {
+		if _, appErr := authorizeFolder(fs.db, userId, folderId, roleOwner); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	res := fs.db.Where("folder_id = ?", folderId).Where("user_id = ?", granteeId).Delete(&models.FolderGrant{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errGrantNotFound, Code: http.StatusNotFound}
+	}
+
+	return &schemas.Message{Message: "grant deleted"}, nil
+}
+
+// ListSharedWithMe lists the folders other users shared with userId, most recent first.
+// Their content is listed with the parentId of the folder.
+func (fs *FileService) ListSharedWithMe(userId int64) ([]schemas.SharedFolderOut, *types.AppError) {
+	rows := []schemas.SharedFolderOut{}
+	if err := fs.db.Table("teldrive.folder_grants AS g").
+		Select("f.id, f.name, f.user_id AS owner_id, u.user_name AS owner_name, g.role, f.updated_at, g.created_at AS shared_at").
+		Joins("JOIN teldrive.files AS f ON f.id = g.folder_id").
+		Joins("JOIN teldrive.users AS u ON u.user_id = f.user_id").
+		Where("g.user_id = ?", userId).Where("f.status = ?", "active").
+		Order("g.created_at DESC").Scan(&rows).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	for i := range rows {
+		rows[i].Name = fs.names.Decrypt(rows[i].OwnerID, rows[i].Name)
+	}
+	return rows, nil
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errNoEncryptionKey = errors.New("encryption key not configured")
+
+// unwrappedKeys caches opened keys by ID. Keys never change once created, retiring a key
+// only stops it from being used for new parts.
+var unwrappedKeys sync.Map
+
+// keyring resolves the passwords parts are encrypted with. Key 0 is the master key
+// itself, which encrypted every part before per-user keys existed. All other keys are
+// random and stored wrapped by the master key.
+type keyring struct {
+	db     *gorm.DB
+	master string
+}
+
+func newKeyring(db *gorm.DB, cnf *config.TGConfig) *keyring {
+	return &keyring{db: db, master: cnf.Uploads.EncryptionKey}
+}
+
+// Password returns the password of key keyId.
+func (k *keyring) Password(keyId int64) (string, error) {
+	if k.master == "" {
+		return "", errNoEncryptionKey
+	}
+
+	if keyId == 0 {
+		return k.master, nil
+	}
+
+	if password, ok := unwrappedKeys.Load(keyId); ok {
+		return password.(string), nil
+	}
+
+	var key models.EncryptionKey
+	if err := k.db.Where("id = ?", keyId).First(&key).Error; err != nil {
+		return "", fmt.Errorf("encryption key %d: %w", keyId, err)
+	}
+
+	password, err := crypt.UnwrapKey(k.master, key.WrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	unwrappedKeys.Store(keyId, password)
+	return password, nil
+}
+
+// ForFile returns the key new parts of a file in the folder at path, as stored in
+// teldrive.files, are encrypted with: the active key of the closest folder that has one,
+// else the active key of the user, else the master key.
+func (k *keyring) ForFile(userId int64, path string) (int64, string, error) {
+	if k.master == "" {
+		return 0, "", errNoEncryptionKey
+	}
+
+	var keys []models.EncryptionKey
+
+	if err := k.db.Raw(`SELECT k.* FROM teldrive.encryption_keys k
+		LEFT JOIN teldrive.files f ON f.id = k.folder_id
+		WHERE k.user_id = ? AND k.status = 'active'
+		AND (k.folder_id IS NULL OR f.path = ? OR left(?, length(f.path) + 1) = f.path || '/')
+		ORDER BY k.folder_id IS NULL, length(f.path) DESC LIMIT 1`, userId, path, path).
+		Scan(&keys).Error; err != nil {
+		return 0, "", err
+	}
+
+	if len(keys) == 0 {
+		return 0, k.master, nil
+	}
+
+	password, err := k.Password(keys[0].ID)
+	if err != nil {
+		return 0, "", err
+	}
+	return keys[0].ID, password, nil
+}
+
+func toEncryptionKeyOut(key *models.EncryptionKey) schemas.EncryptionKeyOut {
+	out := schemas.EncryptionKeyOut{
+		ID:        key.ID,
+		Status:    key.Status,
+		CreatedAt: key.CreatedAt,
+		RetiredAt: key.RetiredAt,
+	}
+	if key.FolderID != nil {
+		out.FolderID = *key.FolderID
+	}
+	return out
+}
+
+func (us *UserService) ListEncryptionKeys(c *gin.Context) ([]schemas.EncryptionKeyOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var keys []models.EncryptionKey
+
+	if err := us.db.Where("user_id = ?", userId).Order("id desc").Find(&keys).Error; err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	res := []schemas.EncryptionKeyOut{}
+	for i := range keys {
+		res = append(res, toEncryptionKeyOut(&keys[i]))
+	}
+	return res, nil
+}
+
+// CreateEncryptionKey creates a new key for the user, or for one of their folders, and
+// retires the key it replaces. Parts under retired keys are re-encrypted in the background.
+func (us *UserService) CreateEncryptionKey(c *gin.Context) (*schemas.EncryptionKeyOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.EncryptionKeyIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil && c.Request.ContentLength > 0 {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	master := us.cnf.TG.Uploads.EncryptionKey
+	if master == "" {
+		return nil, &types.AppError{Error: errNoEncryptionKey, Code: http.StatusBadRequest}
+	}
+
+	password, err := crypt.NewDataKey()
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	wrapped, err := crypt.WrapKey(master, password)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	key := &models.EncryptionKey{UserID: userId, WrappedKey: wrapped, Status: "active"}
+
+	err = us.db.Transaction(func(tx *gorm.DB) error {
+		scope := tx.Model(&models.EncryptionKey{}).Where("user_id = ?", userId).Where("status = ?", "active")
+
+		if payload.FolderID != "" {
+			if err := tx.Where("id = ?", payload.FolderID).Where("user_id = ?", userId).
+				Where("type = ?", "folder").Where("status = ?", "active").First(&models.File{}).Error; err != nil {
+				return err
+			}
+			key.FolderID = &payload.FolderID
+			scope = scope.Where("folder_id = ?", payload.FolderID)
+		} else {
+			scope = scope.Where("folder_id IS NULL")
+		}
+
+		if err := scope.Updates(map[string]any{"status": "retired", "retired_at": time.Now().UTC()}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(key).Error
+	})
+
+	if err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	out := toEncryptionKeyOut(key)
+	return &out, nil
+}
+
+// RetireEncryptionKey stops a key from being used for new parts. Its parts are
+// re-encrypted with the key that applies next, they stay readable until then.
+func (us *UserService) RetireEncryptionKey(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	res := us.db.Model(&models.EncryptionKey{}).Where("id = ?", c.Param("id")).Where("user_id = ?", userId).
+		Where("status = ?", "active").Updates(map[string]any{"status": "retired", "retired_at": time.Now().UTC()})
+
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error, Code: http.StatusInternalServerError}
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	return &schemas.Message{Message: "encryption key retired"}, nil
+}
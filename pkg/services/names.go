@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"gorm.io/gorm"
+)
+
+// nameCiphers caches the name cipher of each user, deriving one runs scrypt.
+var nameCiphers sync.Map
+
+// names translates file and folder names between the API and teldrive.files. With
+// encrypted names every name, and every segment of a path, is stored encrypted with a
+// cipher derived from the master key and the ID of the user. Names are encrypted
+// deterministically so that path lookups, create_directories and the unique_file
+// index work on the stored form unchanged. Without encrypted names it does nothing.
+type names struct {
+	enabled bool
+	master  string
+}
+
+func newNames(cnf *config.TGConfig) *names {
+	return &names{enabled: cnf.Uploads.EncryptNames && cnf.Uploads.EncryptionKey != "",
+		master: cnf.Uploads.EncryptionKey}
+}
+
+func (n *names) cipher(userId int64) (*crypt.Cipher, error) {
+	if c, ok := nameCiphers.Load(userId); ok {
+		return c.(*crypt.Cipher), nil
+	}
+	c, err := crypt.NewCipher(n.master, fmt.Sprintf("names:%d", userId))
+	if err != nil {
+		return nil, err
+	}
+	nameCiphers.Store(userId, c)
+	return c, nil
+}
+
+// Encrypt returns the stored form of a name.
+func (n *names) Encrypt(userId int64, name string) (string, error) {
+	if !n.enabled {
+		return name, nil
+	}
+	c, err := n.cipher(userId)
+	if err != nil {
+		return "", err
+	}
+	return c.EncryptName(name)
+}
+
+// EncryptPath returns the stored form of a path.
+func (n *names) EncryptPath(userId int64, path string) (string, error) {
+	if !n.enabled || path == "" || path == "/" {
+		return path, nil
+	}
+	c, err := n.cipher(userId)
+	if err != nil {
+		return "", err
+	}
+	return c.EncryptPath(path)
+}
+
+// Decrypt returns the plain form of a stored name. Names that do not decrypt, such as
+// the root folder, are returned as they are.
+func (n *names) Decrypt(userId int64, name string) string {
+	if !n.enabled {
+		return name
+	}
+	c, err := n.cipher(userId)
+	if err != nil {
+		return name
+	}
+	plain, err := c.DecryptName(name)
+	if err != nil {
+		return name
+	}
+	return plain
+}
+
+// DecryptPath returns the plain form of a stored path.
+func (n *names) DecryptPath(userId int64, path string) string {
+	if !n.enabled || path == "" || path == "/" {
+		return path
+	}
+	c, err := n.cipher(userId)
+	if err != nil {
+		return path
+	}
+	plain, err := c.DecryptPath(path)
+	if err != nil {
+		return path
+	}
+	return plain
+}
+
+// File decrypts the names of a file read from teldrive.files in place.
+func (n *names) File(file *models.File) {
+	if !n.enabled {
+		return
+	}
+	file.Name = n.Decrypt(file.UserID, file.Name)
+	file.Path = n.DecryptPath(file.UserID, file.Path)
+	if file.TrashPath != nil {
+		trashPath := n.DecryptPath(file.UserID, *file.TrashPath)
+		file.TrashPath = &trashPath
+	}
+}
+
+// FileOut decrypts the names of a listed file in place.
+func (n *names) FileOut(userId int64, file *schemas.FileOut) {
+	if !n.enabled {
+		return
+	}
+	file.Name = n.Decrypt(userId, file.Name)
+	file.Path = n.DecryptPath(userId, file.Path)
+	file.ParentPath = n.DecryptPath(userId, file.ParentPath)
+}
+
+// toFileOut maps a file read from teldrive.files for the API.
+func (fs *FileService) toFileOut(file models.File) *schemas.FileOut {
+	fs.names.File(&file)
+	return mapper.ToFileOut(file)
+}
+
+// toFileOutFull maps a file read from teldrive.files for the API.
+func (fs *FileService) toFileOutFull(file models.File) *schemas.FileOutFull {
+	fs.names.File(&file)
+	return mapper.ToFileOutFull(file)
+}
+
+// convertSegments encrypts or decrypts the segments of a stored path that are not in the
+// wanted form yet, so that converting twice or converting a mix of both forms is safe.
+func convertSegments(c *crypt.Cipher, path string, encrypt bool) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		plain, err := c.DecryptName(segment)
+		switch {
+		case encrypt && err != nil:
+			if segments[i], err = c.EncryptName(segment); err != nil {
+				return "", err
+			}
+		case !encrypt && err == nil:
+			segments[i] = plain
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// ConvertNames encrypts or decrypts the names and paths of all files and folders, for
+// turning encrypted names on or off. Each user is converted in a transaction. Names that
+// are in the wanted form already are left as they are. It returns the number of rows
+// changed.
+func ConvertNames(ctx context.Context, db *gorm.DB, cnf *config.TGConfig, encrypt bool) (int, error) {
+	if cnf.Uploads.EncryptionKey == "" {
+		return 0, errNoEncryptionKey
+	}
+
+	n := &names{enabled: true, master: cnf.Uploads.EncryptionKey}
+
+	var users []int64
+	if err := db.Model(&models.File{}).Distinct("user_id").Pluck("user_id", &users).Error; err != nil {
+		return 0, err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	count := 0
+
+	for _, userId := range users {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		c, err := n.cipher(userId)
+		if err != nil {
+			return count, err
+		}
+
+		converted := 0
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var files []models.File
+			if err := tx.Select("id", "name", "path", "trash_path").Where("user_id = ?", userId).
+				Where("parent_id IS NULL OR parent_id != ?", "root").Find(&files).Error; err != nil {
+				return err
+			}
+
+			for _, file := range files {
+				update := models.File{TrashPath: file.TrashPath}
+				if update.Name, err = convertSegments(c, file.Name, encrypt); err != nil {
+					return fmt.Errorf("file %s: %w", file.ID, err)
+				}
+				if update.Path, err = convertSegments(c, file.Path, encrypt); err != nil {
+					return fmt.Errorf("file %s: %w", file.ID, err)
+				}
+				if file.TrashPath != nil {
+					trashPath, err := convertSegments(c, *file.TrashPath, encrypt)
+					if err != nil {
+						return fmt.Errorf("file %s: %w", file.ID, err)
+					}
+					update.TrashPath = &trashPath
+				}
+
+				if update.Name == file.Name && update.Path == file.Path &&
+					(file.TrashPath == nil || *update.TrashPath == *file.TrashPath) {
+					continue
+				}
+
+				if err := tx.Model(&models.File{ID: file.ID}).Select("name", "path", "trash_path").
+					UpdateColumns(&update).Error; err != nil {
+					return err
+				}
+				converted++
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+
+		count += converted
+		logger.Infow("converted names", "user", userId, "rows", converted)
+	}
+
+	return count, nil
+}
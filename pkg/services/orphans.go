@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// historyBatch is the number of channel messages read per MessagesGetHistory request,
+// orphans are deleted in requests of the same size.
+const historyBatch = 100
+
+// ReconcileOrphans pages through the history of the storage channels of a user, or of
+// one channel, or of all channels when neither is set, and reports the documents that
+// no file, version, thumbnail or upload references. With opts.Delete orphans older than
+// the grace period are deleted, younger ones may belong to an upload in progress.
+func (fs *FileService) ReconcileOrphans(ctx context.Context, opts *schemas.OrphansIn) (*schemas.OrphanReport, error) {
+	query := fs.db.Model(&models.Channel{})
+	if opts.UserID != 0 {
+		query = query.Where("user_id = ?", opts.UserID)
+	}
+	if opts.ChannelID != 0 {
+		query = query.Where("channel_id = ?", opts.ChannelID)
+	}
+
+	var channels []models.Channel
+	if err := query.Order("user_id").Order("channel_id").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+
+	byUser := map[int64][]int64{}
+	users := []int64{}
+	for _, channel := range channels {
+		if _, ok := byUser[channel.UserID]; !ok {
+			users = append(users, channel.UserID)
+		}
+		byUser[channel.UserID] = append(byUser[channel.UserID], channel.ChannelID)
+	}
+
+	report := &schemas.OrphanReport{Orphans: []schemas.OrphanMessage{}}
+
+	logger := logging.FromContext(ctx)
+
+	for _, userId := range users {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		session, err := getUserSession(fs.db, userId)
+		if err != nil {
+			logger.Warnw("skipping user without session", "user", userId, "err", err)
+			continue
+		}
+
+		client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+		if err != nil {
+			return report, err
+		}
+
+		err = tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+			for _, channelId := range byUser[userId] {
+				if err := fs.reconcileChannel(ctx, client, report, userId, channelId, opts.Delete); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	logger.Infow("reconciled channels", "channels", report.Channels, "documents", report.Documents,
+		"orphans", len(report.Orphans), "size", report.Size, "deleted", report.Deleted)
+
+	return report, nil
+}
+
+func (fs *FileService) reconcileChannel(ctx context.Context, client *telegram.Client, report *schemas.OrphanReport,
+	userId, channelId int64, remove bool) error {
+	channel, err := GetChannelById(ctx, client, channelId, strconv.FormatInt(userId, 10))
+	if err != nil {
+		return err
+	}
+
+	documents, err := channelDocuments(ctx, client, channel)
+	if err != nil {
+		return err
+	}
+
+	// The references are read after the history, a document sent meanwhile is either
+	// referenced by now or younger than the grace period.
+	referenced, err := fs.referencedMessages(channelId)
+	if err != nil {
+		return err
+	}
+
+	report.Channels++
+	report.Documents += len(documents)
+
+	cutoff := time.Now().UTC().Add(-fs.orphans.GracePeriod)
+
+	first := len(report.Orphans)
+
+	orphans, expired := orphanedDocuments(documents, referenced, channelId, cutoff)
+	for _, orphan := range orphans {
+		report.Orphans = append(report.Orphans, orphan)
+		report.Size += orphan.Size
+	}
+
+	if !remove || len(expired) == 0 {
+		return nil
+	}
+
+	deleted := map[int]bool{}
+	for start := 0; start < len(expired); start += historyBatch {
+		batch := expired[start:min(start+historyBatch, len(expired))]
+		if _, err := client.API().ChannelsDeleteMessages(ctx,
+			&tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: batch}); err != nil {
+			return err
+		}
+		for _, id := range batch {
+			deleted[id] = true
+		}
+	}
+
+	for i := first; i < len(report.Orphans); i++ {
+		if deleted[report.Orphans[i].MessageID] {
+			report.Orphans[i].Deleted = true
+			report.Deleted++
+		}
+	}
+
+	return nil
+}
+
+// orphanedDocuments returns the documents of a channel that are not referenced and the
+// message IDs of the ones sent before cutoff.
+func orphanedDocuments(documents []schemas.OrphanMessage, referenced map[int64]bool, channelId int64,
+	cutoff time.Time) ([]schemas.OrphanMessage, []int) {
+	orphans := []schemas.OrphanMessage{}
+	expired := []int{}
+
+	for _, document := range documents {
+		if referenced[int64(document.MessageID)] {
+			continue
+		}
+		document.ChannelID = channelId
+		orphans = append(orphans, document)
+		if document.Date.Before(cutoff) {
+			expired = append(expired, document.MessageID)
+		}
+	}
+	return orphans, expired
+}
+
+// channelDocuments returns the documents in the history of a channel, newest first.
+func channelDocuments(ctx context.Context, client *telegram.Client, channel *tg.InputChannel) ([]schemas.OrphanMessage, error) {
+	peer := &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}
+
+	documents := []schemas.OrphanMessage{}
+
+	offsetId := 0
+
+	for {
+		res, err := client.API().MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+			Peer:     peer,
+			OffsetID: offsetId,
+			Limit:    historyBatch,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		history, ok := res.AsModified()
+		if !ok {
+			return nil, errors.New("unexpected history response")
+		}
+
+		messages := history.GetMessages()
+		if len(messages) == 0 {
+			return documents, nil
+		}
+
+		for _, message := range messages {
+			offsetId = message.GetID()
+
+			item, ok := message.(*tg.Message)
+			if !ok {
+				continue
+			}
+			media, ok := item.Media.(*tg.MessageMediaDocument)
+			if !ok {
+				continue
+			}
+			document, ok := media.Document.(*tg.Document)
+			if !ok {
+				continue
+			}
+
+			orphan := schemas.OrphanMessage{
+				MessageID: item.ID,
+				Size:      document.Size,
+				Date:      time.Unix(int64(item.Date), 0).UTC(),
+			}
+			for _, attribute := range document.Attributes {
+				if name, ok := attribute.(*tg.DocumentAttributeFilename); ok {
+					orphan.Name = name.FileName
+				}
+			}
+			documents = append(documents, orphan)
+		}
+	}
+}
+
+// referencedMessages returns the IDs of the messages of a channel that teldrive uses.
+func (fs *FileService) referencedMessages(channelId int64) (map[int64]bool, error) {
+	var ids []int64
+	if err := fs.db.Raw(`
+		SELECT (p->>'id')::bigint FROM teldrive.files f, jsonb_array_elements(f.parts) p
+		WHERE f.channel_id = @channel AND jsonb_typeof(f.parts) = 'array'
+		UNION SELECT (f.thumbnail->>'id')::bigint FROM teldrive.files f
+		WHERE f.channel_id = @channel AND f.thumbnail IS NOT NULL
+		UNION SELECT (p->>'id')::bigint FROM teldrive.file_versions v, jsonb_array_elements(v.parts) p
+		WHERE v.channel_id = @channel AND jsonb_typeof(v.parts) = 'array'
+		UNION SELECT (v.thumbnail->>'id')::bigint FROM teldrive.file_versions v
+		WHERE v.channel_id = @channel AND v.thumbnail IS NOT NULL
+		UNION SELECT u.part_id::bigint FROM teldrive.uploads u WHERE u.channel_id = @channel`,
+		map[string]any{"channel": channelId}).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		referenced[id] = true
+	}
+	return referenced, nil
+}
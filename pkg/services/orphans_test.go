@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrphanedDocuments(t *testing.T) {
+	now := time.Now().UTC()
+	cutoff := now.Add(-time.Hour)
+
+	documents := []schemas.OrphanMessage{
+		{MessageID: 4, Size: 40, Date: now},
+		{MessageID: 3, Size: 30, Date: now.Add(-2 * time.Hour)},
+		{MessageID: 2, Size: 20, Date: now.Add(-2 * time.Hour)},
+		{MessageID: 1, Size: 10, Date: now.Add(-3 * time.Hour)},
+	}
+
+	orphans, expired := orphanedDocuments(documents, map[int64]bool{2: true}, 100, cutoff)
+
+	ids := []int{}
+	for _, orphan := range orphans {
+		ids = append(ids, orphan.MessageID)
+		assert.Equal(t, int64(100), orphan.ChannelID)
+	}
+	assert.Equal(t, []int{4, 3, 1}, ids)
+
+	// Orphans within the grace period may belong to an upload in progress.
+	assert.Equal(t, []int{3, 1}, expired)
+}
+
+func (s *FileServiceSuite) Test_ReferencedMessages() {
+	channelId := int64(100)
+	other := int64(200)
+
+	s.db.Where("file_id is not NULL").Delete(&models.FileVersion{})
+	s.db.Where("upload_id is not NULL").Delete(&models.Upload{})
+
+	s.NoError(s.db.Create(&models.File{
+		Name:      "a.jpg",
+		Type:      "file",
+		MimeType:  "image/jpeg",
+		Size:      utils.Int64Pointer(10),
+		Parts:     &models.Parts{{ID: 1}, {ID: 2}},
+		Thumbnail: &models.Part{ID: 3},
+		ChannelID: &channelId,
+		UserID:    123456,
+		Status:    "active",
+		ParentID:  "root",
+	}).Error)
+
+	s.NoError(s.db.Create(&models.File{
+		Name:      "b.jpg",
+		Type:      "file",
+		MimeType:  "image/jpeg",
+		Size:      utils.Int64Pointer(10),
+		Parts:     &models.Parts{{ID: 9}},
+		ChannelID: &other,
+		UserID:    123456,
+		Status:    "active",
+		ParentID:  "root",
+	}).Error)
+
+	s.NoError(s.db.Create(&models.FileVersion{
+		FileID:    "file",
+		UserID:    123456,
+		Parts:     &models.Parts{{ID: 4}},
+		Thumbnail: &models.Part{ID: 5},
+		ChannelID: channelId,
+		Status:    "active",
+	}).Error)
+
+	s.NoError(s.db.Create(&models.Upload{UploadId: "upload", PartId: 6, ChannelID: channelId, UserId: 123456}).Error)
+
+	referenced, err := s.srv.referencedMessages(channelId)
+	s.NoError(err)
+	s.Equal(map[int64]bool{1: true, 2: true, 3: true, 4: true, 5: true, 6: true}, referenced)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+var (
+	errQuotaExceeded     = errors.New("storage quota exceeded")
+	errFileQuotaExceeded = errors.New("file quota exceeded")
+)
+
+// quotaQuery selects the limits and the usage of users. Trashed and quarantined files and
+// previous versions count, their messages are still stored.
+const quotaQuery = `SELECT u.user_id, u.user_name, u.quota_size, u.quota_files,
+	f.size + v.size AS used_size, f.count AS used_files, p.size AS upload_size
+	FROM teldrive.users u
+	CROSS JOIN LATERAL (SELECT coalesce(sum(size), 0) AS size, count(*) AS count FROM teldrive.files
+		WHERE user_id = u.user_id AND type = 'file' AND status IN ('active', 'trashed', 'quarantined')) f
+	CROSS JOIN LATERAL (SELECT coalesce(sum(size), 0) AS size FROM teldrive.file_versions
+		WHERE user_id = u.user_id AND status = 'active') v
+	CROSS JOIN LATERAL (SELECT coalesce(sum(size), 0) AS size FROM teldrive.uploads
+		WHERE user_id = u.user_id) p`
+
+type quotaRow struct {
+	UserID     int64
+	UserName   string
+	QuotaSize  *int64
+	QuotaFiles *int64
+	UsedSize   int64
+	UsedFiles  int64
+	UploadSize int64
+}
+
+func (row *quotaRow) toQuota(cnf *config.QuotaConfig) schemas.Quota {
+	quota := schemas.Quota{Size: cnf.Size, Files: cnf.Files, UsedSize: row.UsedSize, UsedFiles: row.UsedFiles,
+		UploadSize: row.UploadSize}
+	if row.QuotaSize != nil {
+		quota.Size = *row.QuotaSize
+	}
+	if row.QuotaFiles != nil {
+		quota.Files = *row.QuotaFiles
+	}
+	return quota
+}
+
+func getQuota(db *gorm.DB, cnf *config.QuotaConfig, userId int64) (*schemas.Quota, error) {
+	var row quotaRow
+	if err := db.Raw(quotaQuery+" WHERE u.user_id = ?", userId).Scan(&row).Error; err != nil {
+		return nil, err
+	}
+	quota := row.toQuota(cnf)
+	return &quota, nil
+}
+
+// checkQuota fails when storing size more bytes and files more files would exceed the
+// quota of a user. Parts of unfinished uploads count against the bytes when uploads is
+// set, once the file is created they are counted as the file.
+func checkQuota(db *gorm.DB, cnf *config.QuotaConfig, userId, size, files int64, uploads bool) *types.AppError {
+	// The usage is only summed up for users that have a quota.
+	var limits quotaRow
+	if err := db.Model(&models.User{}).Select("quota_size", "quota_files").Where("user_id = ?", userId).
+		Scan(&limits).Error; err != nil {
+		return &types.AppError{Error: err}
+	}
+	if quota := limits.toQuota(cnf); quota.Size <= 0 && quota.Files <= 0 {
+		return nil
+	}
+
+	quota, err := getQuota(db, cnf, userId)
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+
+	used := quota.UsedSize
+	if uploads {
+		used += quota.UploadSize
+	}
+
+	if quota.Size > 0 && used+size > quota.Size {
+		return &types.AppError{Error: fmt.Errorf("%w: %d of %d bytes used, %d more requested",
+			errQuotaExceeded, used, quota.Size, size), Code: http.StatusForbidden}
+	}
+
+	if quota.Files > 0 && quota.UsedFiles+files > quota.Files {
+		return &types.AppError{Error: fmt.Errorf("%w: %d of %d files used", errFileQuotaExceeded,
+			quota.UsedFiles, quota.Files), Code: http.StatusForbidden}
+	}
+
+	return nil
+}
+
+// checkFileQuota checks the quota of a user before a file of size bytes is stored. A file
+// that replaces the active file of the same name in parentId adds no file to the count.
+func (fs *FileService) checkFileQuota(db *gorm.DB, userId int64, parentId, name string, size int64) *types.AppError {
+	files := int64(1)
+	if parentId != "" {
+		var count int64
+		if err := db.Model(&models.File{}).Where("user_id = ?", userId).Where("parent_id = ?", parentId).
+			Where("name = ?", name).Where("type = ?", "file").Where("status = ?", "active").
+			Count(&count).Error; err != nil {
+			return &types.AppError{Error: err}
+		}
+		if count > 0 {
+			files = 0
+		}
+	}
+	return checkQuota(db, fs.quota, userId, size, files, false)
+}
+
+// lockQuota serializes the quota checks of a user until the transaction of tx ends, so that
+// concurrent requests can't both pass the check before either stores its file.
+func lockQuota(tx *gorm.DB, userId int64) error {
+	return tx.Exec("SELECT 1 FROM teldrive.users WHERE user_id = ? FOR UPDATE", userId).Error
+}
+
+// insertFile stores a new file after checking the quota of its owner, the check and the
+// insert hold the quota lock of the owner.
+func (fs *FileService) insertFile(file *models.File) *types.AppError {
+	var appErr *types.AppError
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockQuota(tx, file.UserID); err != nil {
+			return err
+		}
+		if appErr = fs.checkFileQuota(tx, file.UserID, file.ParentID, file.Name, *file.Size); appErr != nil {
+			return appErr.Error
+		}
+		return tx.Create(file).Error
+	})
+	if appErr != nil {
+		return appErr
+	}
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+	return nil
+}
+
+// uploadedFiles returns the number of files an upload of a file named name to the folder
+// at dir adds, it adds none when it replaces the active file of the same name.
+func uploadedFiles(db *gorm.DB, names *names, userId int64, dir, name string) (int64, error) {
+	encryptedDir, err := names.EncryptPath(userId, path.Clean("/"+dir))
+	if err != nil {
+		return 0, err
+	}
+	encryptedName, err := names.Encrypt(userId, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := db.Table("teldrive.files AS f").Joins("JOIN teldrive.files AS p ON p.id = f.parent_id").
+		Where("f.user_id = ?", userId).Where("p.path = ?", encryptedDir).Where("f.name = ?", encryptedName).
+		Where("f.type = ?", "file").Where("f.status = ?", "active").Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (us *UserService) ListQuotas() ([]schemas.UserQuota, *types.AppError) {
+	var rows []quotaRow
+	if err := us.db.Raw(quotaQuery + " ORDER BY u.user_id").Scan(&rows).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := []schemas.UserQuota{}
+	for i := range rows {
+		res = append(res, schemas.UserQuota{UserID: rows[i].UserID, UserName: rows[i].UserName,
+			Quota: rows[i].toQuota(&us.cnf.Quota)})
+	}
+	return res, nil
+}
+
+// UpdateQuota sets the limits of a user, limits that are null fall back to the ones of
+// the server.
+func (us *UserService) UpdateQuota(userId int64, payload *schemas.QuotaIn) (*schemas.UserQuota, *types.AppError) {
+	if (payload.Size != nil && *payload.Size < 0) || (payload.Files != nil && *payload.Files < 0) {
+		return nil, &types.AppError{Error: errors.New("quota can't be negative"), Code: http.StatusBadRequest}
+	}
+
+	res := us.db.Model(&models.User{}).Where("user_id = ?", userId).
+		Updates(map[string]any{"quota_size": payload.Size, "quota_files": payload.Files})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	var row quotaRow
+	if err := us.db.Raw(quotaQuery+" WHERE u.user_id = ?", userId).Scan(&row).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	return &schemas.UserQuota{UserID: row.UserID, UserName: row.UserName, Quota: row.toQuota(&us.cnf.Quota)}, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/models"
+	"gorm.io/gorm/clause"
+)
+
+func (s *FileServiceSuite) Test_FileQuota() {
+	s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&models.User{UserId: 123456,
+		QuotaFiles: utils.Int64Pointer(1)})
+	defer s.db.Model(&models.User{}).Where("user_id = ?", 123456).Update("quota_files", nil)
+
+	_, appErr := s.srv.CreateFile(context.Background(), 123456, s.entry("a.jpg"))
+	s.Nil(appErr)
+
+	// Replacing a file adds no file to the count.
+	files, err := uploadedFiles(s.db, s.srv.names, 123456, "/", "a.jpg")
+	s.NoError(err)
+	s.Equal(int64(0), files)
+
+	_, appErr = s.srv.CreateFile(context.Background(), 123456, s.entry("a.jpg"))
+	s.Nil(appErr)
+
+	files, err = uploadedFiles(s.db, s.srv.names, 123456, "/", "b.jpg")
+	s.NoError(err)
+	s.Equal(int64(1), files)
+
+	_, appErr = s.srv.CreateFile(context.Background(), 123456, s.entry("b.jpg"))
+	s.NotNil(appErr)
+	s.ErrorIs(appErr.Error, errFileQuotaExceeded)
+	s.Equal(http.StatusForbidden, appErr.Code)
+}
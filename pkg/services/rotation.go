@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// RotateKeys re-encrypts up to limit files that have parts under a retired key, or under
+// the master key while their owner has a key of their own. It returns the number of
+// files rotated. Versions keep their parts, retired keys stay readable for them.
+func (fs *FileService) RotateKeys(ctx context.Context, limit int) (int, error) {
+	var ids []string
+
+	if err := fs.db.Raw(`SELECT f.id FROM teldrive.files f
+		WHERE f.type = 'file' AND f.status = 'active' AND f.encrypted AND EXISTS (
+			SELECT 1 FROM jsonb_array_elements(f.parts) p
+			LEFT JOIN teldrive.encryption_keys k ON k.id = coalesce((p->>'keyId')::bigint, 0)
+			WHERE k.status = 'retired' OR (k.id IS NULL AND EXISTS (
+				SELECT 1 FROM teldrive.encryption_keys a
+				WHERE a.user_id = f.user_id AND a.folder_id IS NULL AND a.status = 'active')))
+		ORDER BY f.updated_at LIMIT ?`, limit).Scan(&ids).Error; err != nil {
+		return 0, err
+	}
+
+	logger := logging.FromContext(ctx)
+
+	count := 0
+	for _, id := range ids {
+		if err := fs.rotateFileKeys(ctx, id); err != nil {
+			logger.Errorw("failed to rotate file keys", "file", id, "err", err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// rotateFileKeys re-encrypts the parts of a file that are not under the key the file
+// would get today. Every such part is uploaded again and the old messages are deleted
+// once the file points at the new ones.
+func (fs *FileService) rotateFileKeys(ctx context.Context, fileId string) error {
+	var file models.File
+	if err := fs.db.Where("id = ?", fileId).Where("status = ?", "active").First(&file).Error; err != nil {
+		return err
+	}
+
+	if !file.Encrypted || file.Parts == nil || len(*file.Parts) == 0 {
+		return nil
+	}
+
+	var folderPath string
+	if err := fs.db.Model(&models.File{}).Select("path").Where("id = ?", file.ParentID).
+		Scan(&folderPath).Error; err != nil {
+		return err
+	}
+
+	keys := newKeyring(fs.db, fs.cnf)
+
+	keyId, password, err := keys.ForFile(file.UserID, folderPath)
+	if err != nil {
+		return err
+	}
+
+	stale, err := fs.staleKeys(&file, keyId)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	session, err := getUserSession(fs.db, file.UserID)
+	if err != nil {
+		return err
+	}
+
+	client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+	if err != nil {
+		return err
+	}
+
+	channelUser := strconv.FormatInt(file.UserID, 10)
+
+	in := mapper.ToFileOutFull(file)
+
+	return tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		parts, err := getParts(ctx, client, in, channelUser)
+		if err != nil {
+			return err
+		}
+
+		channel, err := GetChannelById(ctx, client, in.ChannelID, channelUser)
+		if err != nil {
+			return err
+		}
+
+		deleteMessages := func(ids []int) {
+			if len(ids) > 0 {
+				client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids})
+			}
+		}
+
+		newParts := append(models.Parts{}, *file.Parts...)
+		newIds, oldIds := []int{}, []int{}
+
+		partSize := parts[0].DecryptedSize
+
+		for i := range newParts {
+			if !stale[newParts[i].KeyID] {
+				continue
+			}
+
+			start := int64(i) * partSize
+			end := start + parts[i].DecryptedSize - 1
+
+			messageId, salt, err := fs.reencryptPart(ctx, client, channel, channelUser, &file, i, len(parts),
+				start, end, password)
+			if err != nil {
+				deleteMessages(newIds)
+				return err
+			}
+
+			newIds = append(newIds, messageId)
+			oldIds = append(oldIds, int(newParts[i].ID))
+			newParts[i].ID, newParts[i].Salt, newParts[i].KeyID = int64(messageId), salt, keyId
+		}
+
+		update := &models.File{Parts: &newParts}
+		columns := []string{"parts"}
+
+		// The thumbnail is regenerated with the new key.
+		if file.Thumbnail != nil && stale[file.Thumbnail.KeyID] {
+			oldIds = append(oldIds, int(file.Thumbnail.ID))
+			columns = append(columns, "thumbnail")
+		}
+
+		// The content of the file may have been replaced while the parts were uploaded.
+		res := fs.db.Model(&models.File{}).Where("id = ?", file.ID).Where("updated_at = ?", file.UpdatedAt).
+			Select(columns).UpdateColumns(update)
+
+		if res.Error != nil || res.RowsAffected == 0 {
+			deleteMessages(newIds)
+			return res.Error
+		}
+
+		fs.invalidateParts(ctx, &file)
+
+		deleteMessages(oldIds)
+
+		if len(columns) > 1 {
+			file.Thumbnail = nil
+			fs.queueThumbnail(&file)
+		}
+
+		logging.FromContext(ctx).Infow("rotated file keys", "file", file.ID, "parts", len(newIds), "key", keyId)
+		return nil
+	})
+}
+
+// staleKeys returns the key IDs used by file that have to be replaced by keyId.
+func (fs *FileService) staleKeys(file *models.File, keyId int64) (map[int64]bool, error) {
+	used := []int64{}
+	for _, part := range *file.Parts {
+		if part.KeyID != keyId {
+			used = append(used, part.KeyID)
+		}
+	}
+
+	stale := map[int64]bool{}
+	if len(used) == 0 {
+		return stale, nil
+	}
+
+	var retired []int64
+	if err := fs.db.Model(&models.EncryptionKey{}).Where("id IN ?", used).Where("status = ?", "retired").
+		Pluck("id", &retired).Error; err != nil {
+		return nil, err
+	}
+
+	for _, id := range retired {
+		stale[id] = true
+	}
+
+	// Parts under the master key move to the key of the user.
+	if keyId != 0 {
+		stale[0] = true
+	}
+
+	return stale, nil
+}
+
+// reencryptPart uploads the decrypted bytes from start to end of file, the part at index,
+// encrypted with password under a new salt.
+func (fs *FileService) reencryptPart(ctx context.Context, client *telegram.Client, channel *tg.InputChannel,
+	channelUser string, file *models.File, index, totalParts int, start, end int64,
+	password string) (int, string, error) {
+
+	lr, err := fs.newFileReader(ctx, client, channelUser, mapper.ToFileOutFull(*file), start, end)
+	if err != nil {
+		return 0, "", err
+	}
+	defer lr.Close()
+
+	salt, _ := generateRandomSalt()
+
+	cipher, err := crypt.NewCipher(password, salt)
+	if err != nil {
+		return 0, "", err
+	}
+
+	body, err := cipher.EncryptData(lr)
+	if err != nil {
+		return 0, "", err
+	}
+
+	messageId, err := sendDocument(ctx, client, channel, fs.cnf.Uploads.Threads,
+		partName(file.Name, index+1, totalParts), body, crypt.EncryptedSize(end-start+1))
+	if err != nil {
+		return 0, "", err
+	}
+
+	return messageId, salt, nil
+}
+
+// invalidateParts drops the cached file and the messages of its parts cached for the
+// owner and the bots of its channel.
+func (fs *FileService) invalidateParts(ctx context.Context, file *models.File) {
+	cache := cache.FromContext(ctx)
+
+	cache.Delete(fmt.Sprintf("files:%s", file.ID))
+	cache.Delete(fmt.Sprintf("messages:%s:%d", file.ID, file.UserID))
+
+	if file.ChannelID == nil {
+		return
+	}
+
+	tokens, err := getBotsToken(ctx, fs.db, file.UserID, *file.ChannelID)
+	if err != nil {
+		return
+	}
+	for _, token := range tokens {
+		cache.Delete(fmt.Sprintf("messages:%s:%s", file.ID, strings.Split(token, ":")[0]))
+	}
+}
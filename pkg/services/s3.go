@@ -0,0 +1,1052 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/internal/sigv4"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	s3TimeFormat   = "2006-01-02T15:04:05.000Z"
+	s3MaxKeys      = 1000
+	s3MaxPartCount = 10000
+)
+
+type s3Error struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+func (e *s3Error) Error() string {
+	return e.Message
+}
+
+var (
+	errS3AccessDenied      = &s3Error{"AccessDenied", http.StatusForbidden, "Access Denied"}
+	errS3InvalidAccessKey  = &s3Error{"InvalidAccessKeyId", http.StatusForbidden, "The access key Id you provided does not exist in our records"}
+	errS3SignatureMismatch = &s3Error{"SignatureDoesNotMatch", http.StatusForbidden, "The request signature we calculated does not match the signature you provided"}
+	errS3RequestExpired    = &s3Error{"RequestTimeTooSkewed", http.StatusForbidden, "The difference between the request time and the server's time is too large"}
+	errS3BadDigest         = &s3Error{"XAmzContentSHA256Mismatch", http.StatusBadRequest, "The provided 'x-amz-content-sha256' header does not match what was computed"}
+	errS3InvalidArgument   = &s3Error{"InvalidArgument", http.StatusBadRequest, "Invalid Argument"}
+	errS3InvalidRequest    = &s3Error{"InvalidRequest", http.StatusBadRequest, "Invalid Request"}
+	errS3MalformedXML      = &s3Error{"MalformedXML", http.StatusBadRequest, "The XML you provided was not well-formed"}
+	errS3MissingLength     = &s3Error{"MissingContentLength", http.StatusLengthRequired, "You must provide the Content-Length HTTP header"}
+	errS3NoSuchBucket      = &s3Error{"NoSuchBucket", http.StatusNotFound, "The specified bucket does not exist"}
+	errS3NoSuchKey         = &s3Error{"NoSuchKey", http.StatusNotFound, "The specified key does not exist"}
+	errS3NoSuchUpload      = &s3Error{"NoSuchUpload", http.StatusNotFound, "The specified multipart upload does not exist"}
+	errS3InvalidPart       = &s3Error{"InvalidPart", http.StatusBadRequest, "One or more of the specified parts could not be found"}
+	errS3InvalidPartOrder  = &s3Error{"InvalidPartOrder", http.StatusBadRequest, "The list of parts was not in ascending order"}
+	errS3EntityTooSmall    = &s3Error{"EntityTooSmall", http.StatusBadRequest, "All parts except the last must have the same size"}
+	errS3BucketExists      = &s3Error{"BucketAlreadyOwnedByYou", http.StatusConflict, "Your previous request to create the named bucket succeeded and you already own it"}
+	errS3BucketNotEmpty    = &s3Error{"BucketNotEmpty", http.StatusConflict, "The bucket you tried to delete is not empty"}
+	errS3InvalidBucketName = &s3Error{"InvalidBucketName", http.StatusBadRequest, "The specified bucket is not valid"}
+	errS3NotImplemented    = &s3Error{"NotImplemented", http.StatusNotImplemented, "A header or query you provided implies functionality that is not implemented"}
+	errS3Internal          = &s3Error{"InternalError", http.StatusInternalServerError, "We encountered an internal error, please try again"}
+)
+
+// Bucket and object subresources that the gateway does not support.
+var s3UnsupportedSubresources = []string{"acl", "policy", "cors", "lifecycle", "tagging", "website", "logging",
+	"notification", "replication", "encryption", "object-lock", "versions", "retention", "legal-hold",
+	"torrent", "restore", "select", "accelerate", "requestPayment", "analytics", "inventory", "metrics"}
+
+// S3Service exposes the drive of a user through a subset of the Amazon S3 API.
+// Top level folders are buckets and object keys are paths below them.
+type S3Service struct {
+	db      *gorm.DB
+	files   *FileService
+	uploads *UploadService
+}
+
+func NewS3Service(db *gorm.DB, files *FileService, uploads *UploadService) *S3Service {
+	return &S3Service{db: db, files: files, uploads: uploads}
+}
+
+type s3Request struct {
+	*gin.Context
+	userId  int64
+	session string
+	auth    *sigv4.Result
+	bucket  string
+	key     string
+}
+
+func (r *s3Request) filePath() string {
+	return "/" + r.bucket + "/" + r.key
+}
+
+func (s *S3Service) Handle(c *gin.Context) {
+	req := &s3Request{Context: c}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(c.Request.URL.Path, "/"), "/")
+	req.bucket, req.key = bucket, key
+
+	var err error
+	if err = s.authenticate(req); err == nil {
+		err = s.route(req)
+	}
+
+	if err != nil {
+		s.writeError(req, err)
+	}
+}
+
+func (s *S3Service) authenticate(r *s3Request) error {
+	auth, err := sigv4.Verify(r.Request, func(accessKey string) (string, error) {
+		var key models.AccessKey
+		if err := s.db.Where("access_key_id = ?", accessKey).First(&key).Error; err != nil {
+			if database.IsRecordNotFoundErr(err) {
+				return "", errS3InvalidAccessKey
+			}
+			return "", err
+		}
+		r.userId = key.UserID
+		return key.SecretKey, nil
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, sigv4.ErrSignatureMismatch):
+		return errS3SignatureMismatch
+	case errors.Is(err, sigv4.ErrRequestExpired):
+		return errS3RequestExpired
+	case errors.Is(err, sigv4.ErrMissingAuth):
+		return errS3AccessDenied
+	case errors.Is(err, sigv4.ErrMalformedAuth), errors.Is(err, sigv4.ErrUnsupportedAlgorithm):
+		return &s3Error{"AuthorizationHeaderMalformed", http.StatusBadRequest, err.Error()}
+	default:
+		return err
+	}
+
+	session, err := getUserSession(s.db, r.userId)
+	if err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return errS3AccessDenied
+		}
+		return err
+	}
+
+	r.auth = auth
+	r.session = session.Session
+	return nil
+}
+
+func (s *S3Service) route(r *s3Request) error {
+	query := r.Request.URL.Query()
+
+	for _, sub := range s3UnsupportedSubresources {
+		if query.Has(sub) {
+			return errS3NotImplemented
+		}
+	}
+
+	method := r.Request.Method
+
+	if r.bucket == "" {
+		if method == http.MethodGet {
+			return s.listBuckets(r)
+		}
+		return errS3NotImplemented
+	}
+
+	if r.key == "" {
+		switch {
+		case method == http.MethodGet && query.Has("location"):
+			return s.writeXML(r, http.StatusOK, &schemas.S3LocationConstraint{Xmlns: schemas.S3Namespace})
+		case method == http.MethodGet && query.Has("versioning"):
+			return s.writeXML(r, http.StatusOK, &struct {
+				XMLName xml.Name `xml:"VersioningConfiguration"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: schemas.S3Namespace})
+		case method == http.MethodGet && query.Has("uploads"):
+			return errS3NotImplemented
+		case method == http.MethodGet:
+			return s.listObjects(r)
+		case method == http.MethodHead:
+			_, err := s.getBucket(r)
+			if err == nil {
+				r.Status(http.StatusOK)
+			}
+			return err
+		case method == http.MethodPut:
+			return s.createBucket(r)
+		case method == http.MethodDelete:
+			return s.deleteBucket(r)
+		case method == http.MethodPost && query.Has("delete"):
+			return s.deleteObjects(r)
+		}
+		return errS3NotImplemented
+	}
+
+	switch {
+	case method == http.MethodGet && query.Has("uploadId"):
+		return s.listParts(r)
+	case method == http.MethodGet, method == http.MethodHead:
+		return s.getObject(r)
+	case method == http.MethodPut && r.GetHeader("X-Amz-Copy-Source") != "":
+		return errS3NotImplemented
+	case method == http.MethodPut && query.Has("uploadId"):
+		return s.uploadPart(r)
+	case method == http.MethodPut:
+		return s.putObject(r)
+	case method == http.MethodDelete && query.Has("uploadId"):
+		return s.abortMultipartUpload(r)
+	case method == http.MethodDelete:
+		return s.deleteObject(r)
+	case method == http.MethodPost && query.Has("uploads"):
+		return s.createMultipartUpload(r)
+	case method == http.MethodPost && query.Has("uploadId"):
+		return s.completeMultipartUpload(r)
+	}
+	return errS3NotImplemented
+}
+
+func (s *S3Service) writeXML(r *s3Request, status int, v any) error {
+	out, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.Header("Content-Type", "application/xml")
+	r.Status(status)
+	r.Writer.Write([]byte(xml.Header))
+	r.Writer.Write(out)
+	return nil
+}
+
+func (s *S3Service) writeError(r *s3Request, err error) {
+	var s3Err *s3Error
+	if !errors.As(err, &s3Err) {
+		switch {
+		case errors.Is(err, sigv4.ErrContentHashMismatch):
+			s3Err = errS3BadDigest
+		case errors.Is(err, sigv4.ErrSignatureMismatch):
+			s3Err = errS3SignatureMismatch
+		case errors.Is(err, sigv4.ErrMalformedChunk), errors.Is(err, sigv4.ErrUnsupportedPayload):
+			s3Err = &s3Error{"InvalidRequest", http.StatusBadRequest, err.Error()}
+		case errors.Is(err, errQuotaExceeded), errors.Is(err, errFileQuotaExceeded):
+			s3Err = &s3Error{"AccessDenied", http.StatusForbidden, err.Error()}
+		default:
+			logging.FromContext(r).Errorw("s3 request failed", "method", r.Request.Method,
+				"path", r.Request.URL.Path, "err", err)
+			s3Err = errS3Internal
+		}
+	}
+
+	if r.Writer.Written() {
+		return
+	}
+
+	if r.Request.Method == http.MethodHead {
+		r.Status(s3Err.Status)
+		return
+	}
+
+	s.writeXML(r, s3Err.Status, &schemas.S3Error{Code: s3Err.Code, Message: s3Err.Message,
+		Resource: r.Request.URL.Path})
+}
+
+func s3ETag(id string, size int64, parts int) string {
+	return fmt.Sprintf("\"%s-%d\"", md5.FromString(id+strconv.FormatInt(size, 10)), max(parts, 1))
+}
+
+func s3PartETag(uploadId string, partNo int, partId int) string {
+	return fmt.Sprintf("\"%s\"", md5.FromString(fmt.Sprintf("%s:%d:%d", uploadId, partNo, partId)))
+}
+
+func validBucketName(name string) bool {
+	return name != "" && name != "." && name != ".." && utf8.ValidString(name)
+}
+
+// body returns the decoded request payload and its length.
+func (s *S3Service) body(r *s3Request) (io.Reader, int64, error) {
+	size := r.Request.ContentLength
+	if decoded := r.GetHeader("X-Amz-Decoded-Content-Length"); decoded != "" {
+		var err error
+		size, err = strconv.ParseInt(decoded, 10, 64)
+		if err != nil {
+			return nil, 0, errS3InvalidArgument
+		}
+	}
+	if size < 0 {
+		return nil, 0, errS3MissingLength
+	}
+	body, err := r.auth.Body(r.Request.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, size, nil
+}
+
+func (s *S3Service) getBucket(r *s3Request) (*schemas.FileOutFull, error) {
+	if !validBucketName(r.bucket) {
+		return nil, errS3NoSuchBucket
+	}
+	bucket, err := s.files.GetFileByPath(r.userId, "/"+r.bucket)
+	if err != nil {
+		if err.Code == http.StatusNotFound {
+			return nil, errS3NoSuchBucket
+		}
+		return nil, err.Error
+	}
+	if bucket.Type != "folder" {
+		return nil, errS3NoSuchBucket
+	}
+	return bucket, nil
+}
+
+func (s *S3Service) listBuckets(r *s3Request) error {
+	root, err := s.files.GetFileByPath(r.userId, "/")
+	if err != nil {
+		return err.Error
+	}
+
+	var folders []models.File
+	if err := s.db.Where("user_id = ?", r.userId).Where("parent_id = ?", root.ID).
+		Where("type = ?", "folder").Where("status = ?", "active").Order("name").Find(&folders).Error; err != nil {
+		return err
+	}
+
+	res := &schemas.S3ListBucketsResult{
+		Xmlns:   schemas.S3Namespace,
+		Owner:   schemas.S3Owner{ID: strconv.FormatInt(r.userId, 10), DisplayName: strconv.FormatInt(r.userId, 10)},
+		Buckets: []schemas.S3Bucket{},
+	}
+	for _, folder := range folders {
+		res.Buckets = append(res.Buckets, schemas.S3Bucket{Name: s.files.names.Decrypt(r.userId, folder.Name),
+			CreationDate: folder.CreatedAt.UTC().Format(s3TimeFormat)})
+	}
+	if s.files.names.enabled {
+		sort.Slice(res.Buckets, func(i, j int) bool { return res.Buckets[i].Name < res.Buckets[j].Name })
+	}
+	return s.writeXML(r, http.StatusOK, res)
+}
+
+func (s *S3Service) createBucket(r *s3Request) error {
+	if !validBucketName(r.bucket) || strings.Contains(r.bucket, "/") {
+		return errS3InvalidBucketName
+	}
+	if _, err := s.getBucket(r); err == nil {
+		return errS3BucketExists
+	}
+	if _, err := s.files.MakeDirectory(r.userId, &schemas.MkDir{Path: "/" + r.bucket}); err != nil {
+		return err.Error
+	}
+	r.Header("Location", "/"+r.bucket)
+	r.Status(http.StatusOK)
+	return nil
+}
+
+func (s *S3Service) deleteBucket(r *s3Request) error {
+	bucket, err := s.getBucket(r)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.File{}).Where("parent_id = ?", bucket.ID).Where("status = ?", "active").
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errS3BucketNotEmpty
+	}
+
+	if _, err := s.files.DeleteFiles(r.userId, &schemas.FileOperation{Files: []string{bucket.ID}}); err != nil {
+		return err.Error
+	}
+	r.Status(http.StatusNoContent)
+	return nil
+}
+
+type s3ListEntry struct {
+	ID        string
+	Type      string
+	Size      int64
+	PartCount int
+	UpdatedAt time.Time
+	Key       string
+}
+
+// listObjects implements ListObjects and ListObjectsV2. With the "/" delimiter only the
+// direct children of the folder holding the prefix are listed, otherwise all files below
+// the prefix are returned.
+func (s *S3Service) listObjects(r *s3Request) error {
+	bucket, err := s.getBucket(r)
+	if err != nil {
+		return err
+	}
+
+	query := r.Request.URL.Query()
+
+	v2 := query.Get("list-type") == "2"
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	urlEncode := query.Get("encoding-type") == "url"
+
+	if delimiter != "" && delimiter != "/" {
+		return errS3NotImplemented
+	}
+
+	maxKeys := s3MaxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errS3InvalidArgument
+		}
+		maxKeys = min(n, s3MaxKeys)
+	}
+
+	var marker string
+	if v2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.StdEncoding.DecodeString(token)
+			if err != nil {
+				return errS3InvalidArgument
+			}
+			marker = string(decoded)
+		}
+	} else {
+		marker = query.Get("marker")
+	}
+
+	var entries []s3ListEntry
+
+	if maxKeys > 0 {
+		if delimiter == "/" {
+			entries, err = s.listDirectory(r, bucket, prefix, marker, maxKeys+1)
+		} else {
+			entries, err = s.listRecursive(r, prefix, marker, maxKeys+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	truncated := len(entries) > maxKeys
+	if truncated {
+		entries = entries[:maxKeys]
+	}
+
+	encode := func(s string) string {
+		if urlEncode {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	res := &schemas.S3ListBucketResult{
+		Xmlns:       schemas.S3Namespace,
+		Name:        r.bucket,
+		Prefix:      encode(prefix),
+		Delimiter:   encode(delimiter),
+		MaxKeys:     maxKeys,
+		IsTruncated: truncated,
+	}
+	if urlEncode {
+		res.EncodingType = "url"
+	}
+
+	for _, entry := range entries {
+		if entry.Type == "folder" {
+			res.CommonPrefixes = append(res.CommonPrefixes, schemas.S3CommonPrefix{Prefix: encode(entry.Key)})
+			continue
+		}
+		res.Contents = append(res.Contents, schemas.S3Object{
+			Key:          encode(entry.Key),
+			LastModified: entry.UpdatedAt.UTC().Format(s3TimeFormat),
+			ETag:         s3ETag(entry.ID, entry.Size, entry.PartCount),
+			Size:         entry.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	var last string
+	if len(entries) > 0 {
+		last = entries[len(entries)-1].Key
+	}
+
+	if v2 {
+		keyCount := len(entries)
+		res.KeyCount = &keyCount
+		res.StartAfter = encode(query.Get("start-after"))
+		res.ContinuationToken = query.Get("continuation-token")
+		if truncated {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		marker := encode(marker)
+		res.Marker = &marker
+		if truncated {
+			res.NextMarker = encode(last)
+		}
+	}
+
+	return s.writeXML(r, http.StatusOK, res)
+}
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *S3Service) listDirectory(r *s3Request, bucket *schemas.FileOutFull, prefix, marker string,
+	limit int) ([]s3ListEntry, error) {
+
+	dir, namePrefix := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir, namePrefix = prefix[:i+1], prefix[i+1:]
+	}
+
+	parentId := bucket.ID
+	if dir != "" {
+		folder, err := s.files.GetFileByPath(r.userId, "/"+r.bucket+"/"+dir)
+		if err != nil {
+			if err.Code == http.StatusNotFound {
+				return nil, nil
+			}
+			return nil, err.Error
+		}
+		if folder.Type != "folder" {
+			return nil, nil
+		}
+		parentId = folder.ID
+	}
+
+	relMarker := ""
+	if strings.HasPrefix(marker, dir) {
+		relMarker = marker[len(dir):]
+	} else if marker > dir {
+		return nil, nil
+	}
+
+	namePattern, keyAfter, keyLimit := likeEscape(namePrefix)+"%", relMarker, any(limit)
+	if s.files.names.enabled {
+		namePattern, keyAfter, keyLimit = "%", "", nil
+	}
+
+	entries := []s3ListEntry{}
+
+	if err := s.db.Raw(`SELECT * FROM (
+		SELECT id, type, COALESCE(size, 0) AS size, COALESCE(jsonb_array_length(parts), 0) AS part_count,
+		updated_at, CASE WHEN type = 'folder' THEN name || '/' ELSE name END AS key
+		FROM teldrive.files WHERE user_id = ? AND parent_id = ? AND status = 'active'
+		AND name LIKE ? ESCAPE '\') AS f
+		WHERE key > ? ORDER BY key COLLATE "C" LIMIT ?`,
+		r.userId, parentId, namePattern, keyAfter, keyLimit).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	if s.files.names.enabled {
+		entries = s.decryptEntries(r, entries, namePrefix, relMarker, limit)
+	}
+
+	for i := range entries {
+		entries[i].Key = dir + entries[i].Key
+	}
+	return entries, nil
+}
+
+func (s *S3Service) listRecursive(r *s3Request, prefix, marker string, limit int) ([]s3ListEntry, error) {
+	bucketPath, err := s.files.names.EncryptPath(r.userId, "/"+r.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPattern, keyAfter, keyLimit := likeEscape(prefix)+"%", marker, any(limit)
+	if s.files.names.enabled {
+		keyPattern, keyAfter, keyLimit = "%", "", nil
+	}
+
+	entries := []s3ListEntry{}
+
+	if err := s.db.Raw(`SELECT * FROM (
+		SELECT f.id, f.type, COALESCE(f.size, 0) AS size, COALESCE(jsonb_array_length(f.parts), 0) AS part_count,
+		f.updated_at, substr(p.path || '/' || f.name, ?) AS key
+		FROM teldrive.files f JOIN teldrive.files p ON p.id = f.parent_id
+		WHERE f.user_id = ? AND f.status = 'active' AND f.type = 'file'
+		AND (p.path = ? OR p.path LIKE ? ESCAPE '\')) AS f
+		WHERE key LIKE ? ESCAPE '\' AND key > ? ORDER BY key COLLATE "C" LIMIT ?`,
+		utf8.RuneCountInString(bucketPath)+2, r.userId, bucketPath, likeEscape(bucketPath)+"/%",
+		keyPattern, keyAfter, keyLimit).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	if s.files.names.enabled {
+		entries = s.decryptEntries(r, entries, prefix, marker, limit)
+	}
+	return entries, nil
+}
+
+// decryptEntries finishes a listing of encrypted names. Encrypted names keep neither
+// prefixes nor order, so all candidates are fetched and the keys are decrypted, filtered,
+// sorted and limited here instead of in SQL.
+func (s *S3Service) decryptEntries(r *s3Request, entries []s3ListEntry, prefix, marker string,
+	limit int) []s3ListEntry {
+	res := []s3ListEntry{}
+	for _, entry := range entries {
+		entry.Key = s.files.names.DecryptPath(r.userId, entry.Key)
+		if strings.HasPrefix(entry.Key, prefix) && entry.Key > marker {
+			res = append(res, entry)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+func (s *S3Service) getObject(r *s3Request) error {
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+
+	file, err := s.files.GetFileByPath(r.userId, r.filePath())
+	if err != nil {
+		if err.Code == http.StatusNotFound {
+			return errS3NoSuchKey
+		}
+		return err.Error
+	}
+
+	if file.Type == "folder" {
+		if !strings.HasSuffix(r.key, "/") {
+			return errS3NoSuchKey
+		}
+		r.Header("Content-Type", "application/x-directory")
+		r.Header("Content-Length", "0")
+		r.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+		r.Status(http.StatusOK)
+		return nil
+	}
+
+	r.Header("ETag", s3ETag(file.ID, file.Size, len(file.Parts)))
+	r.Header("Content-Type", file.MimeType)
+	r.Header("Accept-Ranges", "bytes")
+
+	reader := s.files.newFileReadSeeker(r, r.userId, r.session, file)
+	defer reader.Close()
+
+	http.ServeContent(r.Writer, r.Request, file.Name, file.UpdatedAt, reader)
+	return nil
+}
+
+func (s *S3Service) putObject(r *s3Request) error {
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(r.key, "/") {
+		if _, err := s.files.MakeDirectory(r.userId, &schemas.MkDir{Path: path.Clean(r.filePath())}); err != nil {
+			return err.Error
+		}
+		r.Header("ETag", fmt.Sprintf("\"%s\"", md5.FromString("")))
+		r.Status(http.StatusOK)
+		return nil
+	}
+
+	body, size, err := s.body(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.makeParents(r); err != nil {
+		return err
+	}
+
+	file, err := s.uploads.putFile(r, s.files, r.userId, r.session, r.filePath(), body, size,
+		r.GetHeader("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	parts := int((size + s.uploads.cnf.Uploads.PartSize - 1) / s.uploads.cnf.Uploads.PartSize)
+
+	r.Header("ETag", s3ETag(file.ID, file.Size, parts))
+	r.Status(http.StatusOK)
+	return nil
+}
+
+func (s *S3Service) makeParents(r *s3Request) error {
+	dir := path.Dir(path.Clean(r.filePath()))
+	if dir == "/"+r.bucket {
+		return nil
+	}
+	if parent, err := s.files.GetFileByPath(r.userId, dir); err == nil {
+		if parent.Type != "folder" {
+			return errS3InvalidRequest
+		}
+		return nil
+	}
+	if _, err := s.files.MakeDirectory(r.userId, &schemas.MkDir{Path: dir}); err != nil {
+		return err.Error
+	}
+	return nil
+}
+
+func (s *S3Service) deleteKey(r *s3Request, key string) error {
+	file, err := s.files.GetFileByPath(r.userId, "/"+r.bucket+"/"+key)
+	if err != nil {
+		if err.Code == http.StatusNotFound {
+			return nil
+		}
+		return err.Error
+	}
+
+	if file.Type == "folder" {
+		// A folder is only removed through its marker key and only when it is empty.
+		if !strings.HasSuffix(key, "/") {
+			return nil
+		}
+		var count int64
+		if err := s.db.Model(&models.File{}).Where("parent_id = ?", file.ID).Where("status = ?", "active").
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+	}
+
+	if _, err := s.files.DeleteFiles(r.userId, &schemas.FileOperation{Files: []string{file.ID}}); err != nil {
+		return err.Error
+	}
+	return nil
+}
+
+func (s *S3Service) deleteObject(r *s3Request) error {
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+	if err := s.deleteKey(r, r.key); err != nil {
+		return err
+	}
+	r.Status(http.StatusNoContent)
+	return nil
+}
+
+func (s *S3Service) deleteObjects(r *s3Request) error {
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+
+	var payload schemas.S3DeleteObjects
+	if err := xml.NewDecoder(r.Request.Body).Decode(&payload); err != nil {
+		return errS3MalformedXML
+	}
+
+	res := &schemas.S3DeleteResult{Xmlns: schemas.S3Namespace}
+
+	for _, object := range payload.Objects {
+		if err := s.deleteKey(r, object.Key); err != nil {
+			res.Errors = append(res.Errors, schemas.S3DeleteError{Key: object.Key, Code: errS3Internal.Code,
+				Message: err.Error()})
+			continue
+		}
+		if !payload.Quiet {
+			res.Deleted = append(res.Deleted, schemas.S3Deleted{Key: object.Key})
+		}
+	}
+
+	return s.writeXML(r, http.StatusOK, res)
+}
+
+// Upload ids carry the object key so that parts can be matched to their upload
+// without keeping any state besides the uploaded parts.
+func s3UploadId(bucket, key string) (string, error) {
+	suffix, err := randomString(accessKeyIdChars, 16)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(bucket+"/"+key)) + "." + suffix, nil
+}
+
+func (s *S3Service) checkUploadId(r *s3Request) (string, error) {
+	uploadId := r.Query("uploadId")
+	encoded, _, ok := strings.Cut(uploadId, ".")
+	if !ok {
+		return "", errS3NoSuchUpload
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || string(decoded) != r.bucket+"/"+r.key {
+		return "", errS3NoSuchUpload
+	}
+	return uploadId, nil
+}
+
+func (s *S3Service) createMultipartUpload(r *s3Request) error {
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+
+	uploadId, err := s3UploadId(r.bucket, r.key)
+	if err != nil {
+		return err
+	}
+
+	return s.writeXML(r, http.StatusOK, &schemas.S3InitiateMultipartUploadResult{
+		Xmlns:    schemas.S3Namespace,
+		Bucket:   r.bucket,
+		Key:      r.key,
+		UploadId: uploadId,
+	})
+}
+
+func (s *S3Service) uploadPart(r *s3Request) error {
+	uploadId, err := s.checkUploadId(r)
+	if err != nil {
+		return err
+	}
+
+	partNo, err := strconv.Atoi(r.Query("partNumber"))
+	if err != nil || partNo < 1 || partNo > s3MaxPartCount {
+		return errS3InvalidArgument
+	}
+
+	body, size, err := s.body(r)
+	if err != nil {
+		return err
+	}
+
+	name := path.Base(r.key)
+
+	uploadQuery := &schemas.UploadQuery{
+		PartName: fmt.Sprintf("%s.part.%03d", name, partNo),
+		FileName: name,
+		PartNo:   partNo,
+	}
+
+	out, err := s.uploads.uploadPart(r, r.userId, r.session, uploadId, uploadQuery, body, size)
+	if err != nil {
+		return err
+	}
+
+	// A part uploaded again replaces the previous one.
+	var replaced []models.Upload
+	if err := s.db.Where("upload_id = ?", uploadId).Where("user_id = ?", r.userId).Where("part_no = ?", partNo).
+		Where("part_id != ?", out.PartId).Find(&replaced).Error; err != nil {
+		return err
+	}
+	if err := s.uploads.deleteUploads(r, r.userId, r.session, replaced); err != nil {
+		logging.FromContext(r).Errorw("failed to delete replaced parts", "uploadId", uploadId, "err", err)
+	}
+
+	r.Header("ETag", s3PartETag(uploadId, partNo, out.PartId))
+	r.Status(http.StatusOK)
+	return nil
+}
+
+// uploadedParts returns the latest upload of each part and the uploads it replaced.
+func (s *S3Service) uploadedParts(userId int64, uploadId string) ([]models.Upload, []models.Upload, error) {
+	uploads := []models.Upload{}
+	if err := s.db.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Order("part_no").Order("created_at").Find(&uploads).Error; err != nil {
+		return nil, nil, err
+	}
+
+	parts, replaced := []models.Upload{}, []models.Upload{}
+	for _, upload := range uploads {
+		if n := len(parts); n > 0 && parts[n-1].PartNo == upload.PartNo {
+			replaced = append(replaced, parts[n-1])
+			parts[n-1] = upload
+			continue
+		}
+		parts = append(parts, upload)
+	}
+	return parts, replaced, nil
+}
+
+// validPartSizes reports whether all parts but the last have the same size and the last
+// is not larger, streams find the part of an offset by the size of the first part.
+func validPartSizes(sizes []int64) bool {
+	for i := 1; i < len(sizes); i++ {
+		if i < len(sizes)-1 && sizes[i] != sizes[0] || sizes[i] > sizes[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *S3Service) listParts(r *s3Request) error {
+	uploadId, err := s.checkUploadId(r)
+	if err != nil {
+		return err
+	}
+
+	parts, _, err := s.uploadedParts(r.userId, uploadId)
+	if err != nil {
+		return err
+	}
+
+	marker, _ := strconv.Atoi(r.Query("part-number-marker"))
+
+	maxParts := s3MaxKeys
+	if v := r.Query("max-parts"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			maxParts = min(n, s3MaxKeys)
+		}
+	}
+
+	res := &schemas.S3ListPartsResult{
+		Xmlns:            schemas.S3Namespace,
+		Bucket:           r.bucket,
+		Key:              r.key,
+		UploadId:         uploadId,
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+	}
+
+	for _, part := range parts {
+		if part.PartNo <= marker {
+			continue
+		}
+		if len(res.Parts) == maxParts {
+			res.IsTruncated = true
+			break
+		}
+		res.Parts = append(res.Parts, schemas.S3Part{
+			PartNumber:   part.PartNo,
+			LastModified: part.CreatedAt.UTC().Format(s3TimeFormat),
+			ETag:         s3PartETag(uploadId, part.PartNo, part.PartId),
+			Size:         part.Size,
+		})
+		res.NextPartNumberMarker = part.PartNo
+	}
+
+	return s.writeXML(r, http.StatusOK, res)
+}
+
+func (s *S3Service) completeMultipartUpload(r *s3Request) error {
+	uploadId, err := s.checkUploadId(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.getBucket(r); err != nil {
+		return err
+	}
+
+	var payload schemas.S3CompleteMultipartUpload
+	if err := xml.NewDecoder(r.Request.Body).Decode(&payload); err != nil || len(payload.Parts) == 0 {
+		return errS3MalformedXML
+	}
+
+	if !sort.SliceIsSorted(payload.Parts, func(i, j int) bool {
+		return payload.Parts[i].PartNumber < payload.Parts[j].PartNumber
+	}) {
+		return errS3InvalidPartOrder
+	}
+
+	uploaded, replaced, err := s.uploadedParts(r.userId, uploadId)
+	if err != nil {
+		return err
+	}
+	if len(uploaded) == 0 {
+		return errS3NoSuchUpload
+	}
+
+	byNumber := make(map[int]models.Upload, len(uploaded))
+	for _, part := range uploaded {
+		byNumber[part.PartNo] = part
+	}
+
+	var (
+		parts []schemas.Part
+		ids   []int
+		sizes []int64
+		size  int64
+	)
+
+	for _, requested := range payload.Parts {
+		part, ok := byNumber[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, "\"") != strings.Trim(s3PartETag(uploadId, part.PartNo, part.PartId), "\"") {
+			return errS3InvalidPart
+		}
+		if part.ChannelID != uploaded[0].ChannelID {
+			return errS3InvalidPart
+		}
+		parts = append(parts, schemas.Part{ID: int64(part.PartId), Salt: part.Salt, KeyID: part.KeyID})
+		ids = append(ids, part.PartId)
+		sizes = append(sizes, part.Size)
+		size += part.Size
+		delete(byNumber, part.PartNo)
+	}
+
+	if !validPartSizes(sizes) {
+		return errS3EntityTooSmall
+	}
+
+	if err := s.makeParents(r); err != nil {
+		return err
+	}
+
+	dir, name := path.Split(path.Clean(r.filePath()))
+
+	file, err := s.files.replaceFile(r, r.userId, &schemas.FileIn{
+		Name:      name,
+		Type:      "file",
+		Parts:     parts,
+		MimeType:  mimeTypeByName(name),
+		ChannelID: uploaded[0].ChannelID,
+		Path:      path.Clean(dir),
+		Size:      size,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Where("upload_id = ?", uploadId).Where("user_id = ?", r.userId).
+		Where("part_id IN ?", ids).Delete(&models.Upload{}).Error; err != nil {
+		return err
+	}
+
+	// Parts left out of the object are deleted.
+	for _, part := range byNumber {
+		replaced = append(replaced, part)
+	}
+	if err := s.uploads.deleteUploads(r, r.userId, r.session, replaced); err != nil {
+		logging.FromContext(r).Errorw("failed to delete unused parts", "uploadId", uploadId, "err", err)
+	}
+
+	return s.writeXML(r, http.StatusOK, &schemas.S3CompleteMultipartUploadResult{
+		Xmlns:    schemas.S3Namespace,
+		Location: r.filePath(),
+		Bucket:   r.bucket,
+		Key:      r.key,
+		ETag:     s3ETag(file.ID, file.Size, len(parts)),
+	})
+}
+
+func (s *S3Service) abortMultipartUpload(r *s3Request) error {
+	uploadId, err := s.checkUploadId(r)
+	if err != nil {
+		return err
+	}
+	uploads := []models.Upload{}
+	if err := s.db.Where("upload_id = ?", uploadId).Where("user_id = ?", r.userId).Find(&uploads).Error; err != nil {
+		return err
+	}
+	if err := s.uploads.deleteUploads(r, r.userId, r.session, uploads); err != nil {
+		logging.FromContext(r).Errorw("failed to delete aborted parts", "uploadId", uploadId, "err", err)
+	}
+	r.Status(http.StatusNoContent)
+	return nil
+}
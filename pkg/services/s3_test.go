@@ -0,0 +1,16 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidPartSizes(t *testing.T) {
+	assert.True(t, validPartSizes([]int64{10}))
+	assert.True(t, validPartSizes([]int64{10, 10, 10}))
+	assert.True(t, validPartSizes([]int64{10, 10, 4}))
+	assert.False(t, validPartSizes([]int64{10, 4, 10}))
+	assert.False(t, validPartSizes([]int64{10, 12}))
+	assert.False(t, validPartSizes([]int64{10, 12, 4}))
+}
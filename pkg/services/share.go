@@ -0,0 +1,345 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const shareTokenChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+var (
+	errShareNotFound      = errors.New("share not found")
+	errShareExpired       = errors.New("share expired")
+	errShareLimitReached  = errors.New("share download limit reached")
+	errSharePassword      = errors.New("share is password protected")
+	errShareWrongPassword = errors.New("invalid password")
+)
+
+type ShareService struct {
+	db    *gorm.DB
+	files *FileService
+}
+
+func NewShareService(db *gorm.DB, files *FileService) *ShareService {
+	return &ShareService{db: db, files: files}
+}
+
+type shareRow struct {
+	models.Share
+	Name string
+	Type string
+}
+
+func toShareOut(share *models.Share, name, fileType string) *schemas.ShareOut {
+	return &schemas.ShareOut{
+		ID:           share.ID,
+		FileID:       share.FileID,
+		Name:         name,
+		Type:         fileType,
+		Protected:    share.Password != "",
+		ExpiresAt:    share.ExpiresAt,
+		MaxDownloads: share.MaxDownloads,
+		Downloads:    share.Downloads,
+		CreatedAt:    share.CreatedAt,
+	}
+}
+
+func (ss *ShareService) CreateShare(userId int64, payload *schemas.ShareIn) (*schemas.ShareOut, *types.AppError) {
+	var file models.File
+	if err := ss.db.Where("id = ?", payload.FileID).Where("user_id = ?", userId).
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	if file.ParentID == "root" {
+		return nil, &types.AppError{Error: errors.New("root folder can't be shared"), Code: http.StatusBadRequest}
+	}
+
+	token, err := randomString(shareTokenChars, 24)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	share := &models.Share{
+		ID:           token,
+		FileID:       file.ID,
+		UserID:       userId,
+		ExpiresAt:    payload.ExpiresAt,
+		MaxDownloads: payload.MaxDownloads,
+	}
+
+	if payload.Password != "" {
+		share.Password, err = hashSharePassword(payload.Password)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
+
+	if err := ss.db.Create(share).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return toShareOut(share, ss.files.names.Decrypt(userId, file.Name), file.Type), nil
+}
+
+func (ss *ShareService) ListShares(userId int64, query *schemas.ShareQuery) ([]schemas.ShareOut, *types.AppError) {
+	rows := []shareRow{}
+
+	tx := ss.db.Table("teldrive.shares AS s").Select("s.*, f.name, f.type").
+		Joins("JOIN teldrive.files AS f ON f.id = s.file_id").Where("s.user_id = ?", userId)
+
+	if query.FileID != "" {
+		tx = tx.Where("s.file_id = ?", query.FileID)
+	}
+
+	if err := tx.Order("s.created_at DESC").Scan(&rows).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	shares := []schemas.ShareOut{}
+	for i := range rows {
+		shares = append(shares, *toShareOut(&rows[i].Share, ss.files.names.Decrypt(userId, rows[i].Name),
+			rows[i].Type))
+	}
+	return shares, nil
+}
+
+func (ss *ShareService) UpdateShare(userId int64, id string, payload *schemas.ShareUpdate) (*schemas.ShareOut, *types.AppError) {
+	var row shareRow
+
+	if err := ss.db.Table("teldrive.shares AS s").Select("s.*, f.name, f.type").
+		Joins("JOIN teldrive.files AS f ON f.id = s.file_id").Where("s.id = ?", id).
+		Where("s.user_id = ?", userId).First(&row).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errShareNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	share := &row.Share
+
+	if payload.Password != nil {
+		share.Password = ""
+		if *payload.Password != "" {
+			hash, err := hashSharePassword(*payload.Password)
+			if err != nil {
+				return nil, &types.AppError{Error: err}
+			}
+			share.Password = hash
+		}
+	}
+
+	if payload.ExpiresAt != nil {
+		share.ExpiresAt = payload.ExpiresAt
+		if payload.ExpiresAt.IsZero() {
+			share.ExpiresAt = nil
+		}
+	}
+
+	if payload.MaxDownloads != nil {
+		share.MaxDownloads = payload.MaxDownloads
+		if *payload.MaxDownloads == 0 {
+			share.MaxDownloads = nil
+		}
+	}
+
+	if err := ss.db.Model(&models.Share{ID: share.ID}).Select("password", "expires_at", "max_downloads").
+		Updates(map[string]any{"password": share.Password, "expires_at": share.ExpiresAt,
+			"max_downloads": share.MaxDownloads}).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return toShareOut(share, ss.files.names.Decrypt(userId, row.Name), row.Type), nil
+}
+
+func (ss *ShareService) DeleteShare(userId int64, id string) (*schemas.Message, *types.AppError) {
+	res := ss.db.Where("id = ?", id).Where("user_id = ?", userId).Delete(&models.Share{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errShareNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "share deleted"}, nil
+}
+
+func (ss *ShareService) UnlockShare(id string, payload *schemas.ShareUnlock) (*schemas.ShareUnlockOut, *types.AppError) {
+	share, err := findShare(ss.db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if share.Password == "" {
+		return &schemas.ShareUnlockOut{}, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(share.Password), []byte(payload.Password)) != nil {
+		return nil, &types.AppError{Error: errShareWrongPassword, Code: http.StatusUnauthorized}
+	}
+
+	return &schemas.ShareUnlockOut{Key: shareKey(share)}, nil
+}
+
+func (ss *ShareService) GetShare(id, key string) (*schemas.ShareInfo, *types.AppError) {
+	share, appErr := getShare(ss.db, id, key)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	file, appErr := ss.sharedRoot(share)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	var size int64
+	if file.Size != nil {
+		size = *file.Size
+	}
+
+	return &schemas.ShareInfo{
+		ID:        share.ID,
+		FileID:    file.ID,
+		Name:      file.Name,
+		Type:      file.Type,
+		MimeType:  file.MimeType,
+		Size:      size,
+		ExpiresAt: share.ExpiresAt,
+		UpdatedAt: file.UpdatedAt,
+	}, nil
+}
+
+// ListShareFiles lists a folder below a shared folder. Paths in the query and in
+// the results are relative to the shared folder.
+func (ss *ShareService) ListShareFiles(id, key string, query *schemas.ShareFileQuery) (*schemas.FileResponse, *types.AppError) {
+	share, appErr := getShare(ss.db, id, key)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	root, appErr := ss.sharedRoot(share)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if root.Type != "folder" {
+		return nil, &types.AppError{Error: errors.New("shared item is not a folder"), Code: http.StatusBadRequest}
+	}
+
+	res, appErr := ss.files.ListFiles(share.UserID, &schemas.FileQuery{
+		Op:            "list",
+		Path:          path.Join(root.Path, path.Clean("/"+query.Path)),
+		Sort:          query.Sort,
+		Order:         query.Order,
+		PerPage:       query.PerPage,
+		NextPageToken: query.NextPageToken,
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	for i := range res.Files {
+		if res.Files[i].Path != "" {
+			res.Files[i].Path = strings.TrimPrefix(res.Files[i].Path, root.Path)
+		}
+		res.Files[i].ParentID = ""
+	}
+
+	return res, nil
+}
+
+// sharedRoot returns the shared item with its names decrypted.
+func (ss *ShareService) sharedRoot(share *models.Share) (*models.File, *types.AppError) {
+	var file models.File
+	if err := ss.db.Where("id = ?", share.FileID).Where("status = ?", "active").First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errShareNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	ss.files.names.File(&file)
+	return &file, nil
+}
+
+func hashSharePassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// shareKey is handed out once the password of a share is verified and is sent along
+// with later requests instead of the password. Changing the password invalidates it.
+func shareKey(share *models.Share) string {
+	sum := sha256.Sum256([]byte(share.ID + ":" + share.Password))
+	return hex.EncodeToString(sum[:])
+}
+
+func findShare(db *gorm.DB, id string) (*models.Share, *types.AppError) {
+	var share models.Share
+	if err := db.Where("id = ?", id).First(&share).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: errShareNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now().UTC()) {
+		return nil, &types.AppError{Error: errShareExpired, Code: http.StatusGone}
+	}
+
+	return &share, nil
+}
+
+func getShare(db *gorm.DB, id, key string) (*models.Share, *types.AppError) {
+	share, err := findShare(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if share.Password != "" && !hmac.Equal([]byte(key), []byte(shareKey(share))) {
+		return nil, &types.AppError{Error: errSharePassword, Code: http.StatusUnauthorized}
+	}
+
+	return share, nil
+}
+
+// shareContains reports whether fileId is the shared item or an active file below the shared folder.
+func shareContains(db *gorm.DB, share *models.Share, fileId string) (bool, error) {
+	var count int64
+	err := db.Raw(`SELECT count(*) FROM teldrive.files AS f
+		JOIN teldrive.files AS s ON s.id = ? AND s.user_id = f.user_id AND s.status = 'active'
+		LEFT JOIN teldrive.files AS p ON p.id = f.parent_id
+		WHERE f.id = ? AND f.user_id = ? AND f.status = 'active'
+		AND (f.id = s.id OR (s.type = 'folder' AND (p.path = s.path OR left(p.path, length(s.path) + 1) = s.path || '/')))`,
+		share.FileID, fileId, share.UserID).Scan(&count).Error
+	return count > 0, err
+}
+
+// countShareDownload records a download unless the share reached its download limit.
+func countShareDownload(db *gorm.DB, share *models.Share) (bool, error) {
+	res := db.Exec(`UPDATE teldrive.shares SET downloads = downloads + 1
+		WHERE id = ? AND (max_downloads IS NULL OR downloads < max_downloads)`, share.ID)
+	return res.RowsAffected > 0, res.Error
+}
+
+// shareExhausted reports whether share used up its download limit.
+func shareExhausted(share *models.Share) bool {
+	return share.MaxDownloads != nil && share.Downloads >= *share.MaxDownloads
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+func (s *FileServiceSuite) shares() *ShareService {
+	s.db.Where("id is not NULL").Delete(&models.Share{})
+	s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Session{UserId: 123456, Hash: "hash",
+		Session: "session"})
+	return NewShareService(s.db, s.srv)
+}
+
+// stream requests fileID through a share and returns the status of the response.
+func (s *FileServiceSuite) stream(method, fileID, query, rangeHeader string) int {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, "/api/files/"+fileID+"/stream?"+query, nil)
+	if rangeHeader != "" {
+		c.Request.Header.Set("Range", rangeHeader)
+	}
+	c.Params = gin.Params{{Key: "fileID", Value: fileID}}
+	s.srv.GetFileStream(c)
+	return c.Writer.Status()
+}
+
+func (s *FileServiceSuite) Test_SharePassword() {
+	ss := s.shares()
+
+	file, appErr := s.srv.CreateFile(context.Background(), 123456, s.entry("a.jpg"))
+	s.Nil(appErr)
+
+	share, appErr := ss.CreateShare(123456, &schemas.ShareIn{FileID: file.ID, Password: "secret"})
+	s.Nil(appErr)
+	s.True(share.Protected)
+
+	_, appErr = ss.UnlockShare(share.ID, &schemas.ShareUnlock{Password: "wrong"})
+	s.Equal(errShareWrongPassword, appErr.Error)
+	s.Equal(http.StatusUnauthorized, appErr.Code)
+
+	_, appErr = ss.GetShare(share.ID, "")
+	s.Equal(errSharePassword, appErr.Error)
+
+	unlocked, appErr := ss.UnlockShare(share.ID, &schemas.ShareUnlock{Password: "secret"})
+	s.Nil(appErr)
+
+	info, appErr := ss.GetShare(share.ID, unlocked.Key)
+	s.Nil(appErr)
+	s.Equal(file.ID, info.FileID)
+	s.Equal("a.jpg", info.Name)
+
+	// Changing the password invalidates the keys handed out before.
+	password := "other"
+	_, appErr = ss.UpdateShare(123456, share.ID, &schemas.ShareUpdate{Password: &password})
+	s.Nil(appErr)
+
+	_, appErr = ss.GetShare(share.ID, unlocked.Key)
+	s.Equal(errSharePassword, appErr.Error)
+}
+
+func (s *FileServiceSuite) Test_ShareExpired() {
+	ss := s.shares()
+
+	file, appErr := s.srv.CreateFile(context.Background(), 123456, s.entry("a.jpg"))
+	s.Nil(appErr)
+
+	expiresAt := time.Now().UTC().Add(-time.Minute)
+	share, appErr := ss.CreateShare(123456, &schemas.ShareIn{FileID: file.ID, ExpiresAt: &expiresAt})
+	s.Nil(appErr)
+
+	_, appErr = ss.GetShare(share.ID, "")
+	s.Equal(errShareExpired, appErr.Error)
+	s.Equal(http.StatusGone, appErr.Code)
+
+	s.Equal(http.StatusGone, s.stream(http.MethodGet, file.ID, "share="+share.ID, ""))
+}
+
+func (s *FileServiceSuite) Test_ShareDownloadLimit() {
+	ss := s.shares()
+
+	empty := s.entry("empty.txt")
+	empty.Size = 0
+	file, appErr := s.srv.CreateFile(context.Background(), 123456, empty)
+	s.Nil(appErr)
+
+	limit := 1
+	share, appErr := ss.CreateShare(123456, &schemas.ShareIn{FileID: file.ID, MaxDownloads: &limit})
+	s.Nil(appErr)
+
+	s.Equal(http.StatusOK, s.stream(http.MethodHead, file.ID, "share="+share.ID, ""))
+	s.Equal(http.StatusOK, s.stream(http.MethodGet, file.ID, "share="+share.ID, ""))
+	s.Equal(http.StatusGone, s.stream(http.MethodGet, file.ID, "share="+share.ID, ""))
+
+	var stored models.Share
+	s.NoError(s.db.Where("id = ?", share.ID).First(&stored).Error)
+	s.Equal(1, stored.Downloads)
+
+	// Ranged requests don't start a download but are refused once the limit is reached.
+	file, appErr = s.srv.CreateFile(context.Background(), 123456, s.entry("a.jpg"))
+	s.Nil(appErr)
+
+	share, appErr = ss.CreateShare(123456, &schemas.ShareIn{FileID: file.ID, MaxDownloads: &limit})
+	s.Nil(appErr)
+	s.NoError(s.db.Model(&models.Share{}).Where("id = ?", share.ID).Update("downloads", 1).Error)
+
+	s.Equal(http.StatusGone, s.stream(http.MethodGet, file.ID, "share="+share.ID, "bytes=1-"))
+}
+
+func (s *FileServiceSuite) Test_ShareContains() {
+	ss := s.shares()
+	c := context.Background()
+
+	folder, appErr := s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "shared", Type: "folder", Path: "/"})
+	s.Nil(appErr)
+	_, appErr = s.srv.CreateFile(c, 123456, &schemas.FileIn{Name: "shared2", Type: "folder", Path: "/"})
+	s.Nil(appErr)
+
+	entry := func(name, dir string) *schemas.FileOut {
+		file := s.entry(name)
+		file.Size = 0
+		file.Path = dir
+		out, appErr := s.srv.CreateFile(c, 123456, file)
+		s.Nil(appErr)
+		return out
+	}
+
+	inside := entry("inside.txt", "/shared")
+	outside := entry("outside.txt", "/")
+	sibling := entry("sibling.txt", "/shared2")
+
+	share, appErr := ss.CreateShare(123456, &schemas.ShareIn{FileID: folder.ID})
+	s.Nil(appErr)
+
+	stored := &models.Share{ID: share.ID, FileID: folder.ID, UserID: 123456}
+	for id, want := range map[string]bool{folder.ID: true, inside.ID: true, outside.ID: false, sibling.ID: false} {
+		ok, err := shareContains(s.db, stored, id)
+		s.NoError(err)
+		s.Equal(want, ok)
+	}
+
+	s.Equal(http.StatusOK, s.stream(http.MethodGet, inside.ID, "share="+share.ID, ""))
+	s.Equal(http.StatusNotFound, s.stream(http.MethodGet, outside.ID, "share="+share.ID, ""))
+	s.Equal(http.StatusNotFound, s.stream(http.MethodGet, sibling.ID, "share="+share.ID, ""))
+
+	// Versions are only streamed to the owner.
+	s.Equal(http.StatusBadRequest, s.stream(http.MethodGet, inside.ID, "share="+share.ID+"&version=1", ""))
+}
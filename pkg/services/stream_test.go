@@ -0,0 +1,20 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyRangeEmptyFile(t *testing.T) {
+	fs := &FileService{}
+	file := &schemas.FileOutFull{FileOut: &schemas.FileOut{Name: "empty.txt", Size: 0}}
+
+	var buf bytes.Buffer
+	err := fs.copyRange(context.Background(), nil, "", file, &buf, 0, file.Size-1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/divyam234/teldrive/internal/cache"
+	"github.com/divyam234/teldrive/internal/crypt"
+	"github.com/divyam234/teldrive/internal/tgc"
+	"github.com/divyam234/teldrive/internal/thumbnail"
+	"github.com/divyam234/teldrive/pkg/httputil"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+var errThumbnailNotFound = errors.New("thumbnail not found")
+
+// thumbnailQueueSize bounds the files waiting for a thumbnail, files queued beyond it are
+// left to the thumbnails command.
+const thumbnailQueueSize = 1000
+
+var (
+	thumbnailQueue     chan string
+	thumbnailQueueOnce sync.Once
+)
+
+// wantsThumbnail reports whether a thumbnail can be generated for file.
+func (fs *FileService) wantsThumbnail(file *models.File) bool {
+	return fs.thumbnails != nil && fs.thumbnails.Size > 0 && file.Type == "file" &&
+		thumbnail.Supported(file.MimeType) && file.Size != nil && *file.Size > 0 &&
+		*file.Size <= fs.thumbnails.MaxFileSize
+}
+
+// queueThumbnail generates the thumbnail of an image file in the background. Thumbnails
+// are generated by a fixed number of workers that are started with the first file.
+func (fs *FileService) queueThumbnail(file *models.File) {
+	if file.Thumbnail != nil || !fs.wantsThumbnail(file) {
+		return
+	}
+
+	thumbnailQueueOnce.Do(func() {
+		thumbnailQueue = make(chan string, thumbnailQueueSize)
+		for i := 0; i < max(fs.thumbnails.Workers, 1); i++ {
+			go fs.thumbnailWorker()
+		}
+	})
+
+	select {
+	case thumbnailQueue <- file.ID:
+	default:
+		logging.DefaultLogger().Warnw("thumbnail queue is full", "file", file.ID)
+	}
+}
+
+func (fs *FileService) thumbnailWorker() {
+	for id := range thumbnailQueue {
+		if err := fs.GenerateThumbnail(context.Background(), id); err != nil {
+			logging.DefaultLogger().Warnw("failed to generate thumbnail", "file", id, "err", err)
+		}
+	}
+}
+
+// GenerateThumbnail renders the thumbnail of an image file and posts it to the channel of
+// the file. Thumbnails of encrypted files are encrypted as well. Files that already have a
+// thumbnail or are not supported images are skipped.
+func (fs *FileService) GenerateThumbnail(ctx context.Context, fileId string) error {
+	var file models.File
+	if err := fs.db.Where("id = ?", fileId).Where("status = ?", "active").First(&file).Error; err != nil {
+		return err
+	}
+
+	if file.Thumbnail != nil || !fs.wantsThumbnail(&file) {
+		return nil
+	}
+
+	session, err := getUserSession(fs.db, file.UserID)
+	if err != nil {
+		return err
+	}
+
+	client, err := tgc.AuthClient(ctx, fs.cnf, session.Session)
+	if err != nil {
+		return err
+	}
+
+	channelUser := strconv.FormatInt(file.UserID, 10)
+
+	in := mapper.ToFileOutFull(file)
+
+	return tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		lr, err := fs.newFileReader(ctx, client, channelUser, in, 0, in.Size-1)
+		if err != nil {
+			return err
+		}
+		defer lr.Close()
+
+		data, err := thumbnail.Generate(lr, fs.thumbnails.Size)
+		if err != nil {
+			return err
+		}
+
+		channel, err := GetChannelById(ctx, client, in.ChannelID, channelUser)
+		if err != nil {
+			return err
+		}
+
+		var (
+			body  io.Reader = bytes.NewReader(data)
+			size            = int64(len(data))
+			salt  string
+			keyId int64
+		)
+
+		// The thumbnail is encrypted with the key of the content it shows.
+		if file.Encrypted {
+			keyId = in.Parts[0].KeyID
+			password, err := newKeyring(fs.db, fs.cnf).Password(keyId)
+			if err != nil {
+				return err
+			}
+			salt, _ = generateRandomSalt()
+			cipher, err := crypt.NewCipher(password, salt)
+			if err != nil {
+				return err
+			}
+			body, _ = cipher.EncryptData(body)
+			size = crypt.EncryptedSize(size)
+		}
+
+		messageId, err := sendDocument(ctx, client, channel, fs.cnf.Uploads.Threads,
+			fmt.Sprintf("%s.thumbnail.jpg", file.ID), body, size)
+		if err != nil {
+			return err
+		}
+
+		// The content of the file may have been replaced while the thumbnail was generated.
+		res := fs.db.Model(&models.File{}).Where("id = ?", file.ID).Where("updated_at = ?", file.UpdatedAt).
+			Where("thumbnail IS NULL").Select("thumbnail").
+			UpdateColumns(&models.File{Thumbnail: &models.Part{ID: int64(messageId), Salt: salt, KeyID: keyId}})
+
+		if res.Error != nil || res.RowsAffected == 0 {
+			client.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel,
+				ID: []int{messageId}})
+			return res.Error
+		}
+
+		cache.FromContext(ctx).Delete(fmt.Sprintf("files:%s", file.ID))
+		return nil
+	})
+}
+
+// BackfillThumbnails generates the missing thumbnails of existing images and returns the
+// number of thumbnails created.
+func (fs *FileService) BackfillThumbnails(ctx context.Context, userId int64) (int, error) {
+	if fs.thumbnails.Size <= 0 {
+		return 0, errors.New("thumbnails are disabled")
+	}
+
+	logger := logging.FromContext(ctx)
+
+	query := fs.db.Model(&models.File{}).Where("type = ?", "file").Where("status = ?", "active").
+		Where("thumbnail IS NULL").Where("mime_type IN ?", thumbnail.MimeTypes).
+		Where("size > 0").Where("size <= ?", fs.thumbnails.MaxFileSize)
+
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	var ids []string
+	if err := query.Order("created_at").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if err := fs.GenerateThumbnail(ctx, id); err != nil {
+			logger.Warnw("failed to generate thumbnail", "file", id, "err", err)
+			continue
+		}
+		count++
+		logger.Infow("generated thumbnail", "file", id, "done", count, "total", len(ids))
+	}
+
+	return count, nil
+}
+
+func (fs *FileService) GetThumbnail(c *gin.Context) {
+	w := c.Writer
+
+	fileID := c.Param("fileID")
+
+	session, _, appErr := fs.streamSession(c, fileID)
+	if appErr != nil {
+		http.Error(w, appErr.Error.Error(), appErr.Code)
+		return
+	}
+
+	file, appErr := fs.cachedFile(c, fileID)
+	if appErr != nil {
+		http.Error(w, appErr.Error.Error(), appErr.Code)
+		return
+	}
+
+	if file.Thumbnail == nil {
+		http.Error(w, errThumbnailNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	etag := httputil.ETag(file.ID, "thumbnail", strconv.FormatInt(file.Thumbnail.ID, 10))
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	if httputil.NotModified(c.Request, etag, file.UpdatedAt) {
+		httputil.WriteNotModified(w)
+		return
+	}
+
+	logger := logging.FromContext(c)
+
+	client, channelUser, err := fs.getStreamClient(c, session.UserId, session.Session, file.ChannelID)
+	if err != nil {
+		logger.Error("thumbnail", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The message ID is part of the ID so that cached messages of a replaced thumbnail
+	// are not reused.
+	thumb := &schemas.FileOutFull{
+		FileOut:   &schemas.FileOut{ID: fmt.Sprintf("%s-thumbnail-%d", file.ID, file.Thumbnail.ID)},
+		Parts:     []schemas.Part{*file.Thumbnail},
+		ChannelID: file.ChannelID,
+		Encrypted: file.Encrypted,
+	}
+
+	parts, err := getParts(c, client.Tg, thumb, channelUser)
+	if err != nil {
+		logger.Error("thumbnail", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	thumb.Size = parts[0].Size
+	if thumb.Encrypted {
+		thumb.Size = parts[0].DecryptedSize
+	}
+
+	c.Header("Content-Type", thumbnail.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(thumb.Size, 10))
+	c.Header("Cache-Control", "private, max-age=86400")
+
+	w.WriteHeader(http.StatusOK)
+
+	if c.Request.Method == "HEAD" {
+		return
+	}
+
+	if err := fs.copyRange(c, client.Tg, channelUser, thumb, w, 0, thumb.Size-1); err != nil {
+		logger.Error("thumbnail", zap.Error(err))
+	}
+}
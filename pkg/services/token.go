@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"gorm.io/gorm"
+)
+
+// tokenUsedInterval is how often the last use of a token is recorded.
+const tokenUsedInterval = time.Minute
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+	errTokenPath    = errors.New("token is restricted to another path")
+)
+
+type TokenService struct {
+	db *gorm.DB
+}
+
+func NewTokenService(db *gorm.DB) *TokenService {
+	return &TokenService{db: db}
+}
+
+func toAPITokenOut(token *models.APIToken) *schemas.APITokenOut {
+	return &schemas.APITokenOut{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		Path:       token.Path,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ts *TokenService) ListTokens(userId int64) ([]schemas.APITokenOut, *types.AppError) {
+	var rows []models.APIToken
+	if err := ts.db.Where("user_id = ?", userId).Order("created_at DESC").Find(&rows).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	tokens := []schemas.APITokenOut{}
+	for i := range rows {
+		tokens = append(tokens, *toAPITokenOut(&rows[i]))
+	}
+	return tokens, nil
+}
+
+// CreateToken creates an API token, the token itself is only returned here.
+func (ts *TokenService) CreateToken(userId int64, payload *schemas.APITokenIn) (*schemas.APITokenOut, *types.AppError) {
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now().UTC()) {
+		return nil, &types.AppError{Error: errors.New("expiry is in the past"), Code: http.StatusBadRequest}
+	}
+
+	// A token restricted to the root folder is not restricted.
+	tokenPath := ""
+	if payload.Path != "" {
+		if tokenPath = path.Clean("/" + payload.Path); tokenPath == "/" {
+			tokenPath = ""
+		}
+	}
+
+	secret, err := randomString(shareTokenChars, 40)
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+	value := types.APITokenPrefix + secret
+
+	token := &models.APIToken{
+		UserID:    userId,
+		Name:      payload.Name,
+		TokenHash: hashAPIToken(value),
+		Scopes:    payload.Scopes,
+		Path:      tokenPath,
+		ExpiresAt: payload.ExpiresAt,
+	}
+
+	if err := ts.db.Create(token).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	out := toAPITokenOut(token)
+	out.Token = value
+	return out, nil
+}
+
+func (ts *TokenService) RevokeToken(userId int64, id string) (*schemas.Message, *types.AppError) {
+	res := ts.db.Where("id = ?", id).Where("user_id = ?", userId).Delete(&models.APIToken{})
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "token revoked"}, nil
+}
+
+// VerifyToken returns the claims of the user of an API token, for middleware.Authmiddleware.
+func (ts *TokenService) VerifyToken(ctx context.Context, token string) (*types.JWTClaims, error) {
+	return verifyAPIToken(ts.db, token)
+}
+
+// verifyAPIToken returns the claims of the user of an API token. Requests made with a token
+// act with the most recent login session of the user, like shares.
+func verifyAPIToken(db *gorm.DB, value string) (*types.JWTClaims, error) {
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", hashAPIToken(value)).First(&token).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, errInvalidToken
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
+		return nil, errTokenExpired
+	}
+
+	session, err := getUserSession(db, token.UserID)
+	if err != nil {
+		return nil, errors.New("no session of the user, log in again")
+	}
+
+	var user models.User
+	if err := db.Where("user_id = ?", token.UserID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.APIToken{}).Where("id = ?", token.ID).
+		Where("last_used_at IS NULL OR last_used_at < ?", now.Add(-tokenUsedInterval)).
+		Update("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &types.JWTClaims{
+		Claims:    jwt.Claims{Subject: strconv.FormatInt(token.UserID, 10)},
+		TgSession: session.Session,
+		Name:      user.Name,
+		UserName:  user.UserName,
+		IsPremium: user.IsPremium,
+		Hash:      session.Hash,
+		TokenID:   token.ID,
+		Scopes:    token.Scopes,
+		Path:      token.Path,
+	}, nil
+}
+
+// apiToken returns the API token a request carries as bearer token.
+func apiToken(c *gin.Context) string {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(token, types.APITokenPrefix) {
+		return ""
+	}
+	return token
+}
+
+// CheckTokenPath fails unless the files with ids and the paths of the drive of the user are
+// in the folder the API token of the request is restricted to.
+func (fs *FileService) CheckTokenPath(c *gin.Context, ids []string, paths ...string) *types.AppError {
+	val, _ := c.Get("jwtUser")
+	claims, ok := val.(*types.JWTClaims)
+	if !ok || claims.Path == "" {
+		return nil
+	}
+
+	for _, p := range paths {
+		if !pathWithin(claims.Path, p) {
+			return &types.AppError{Error: errTokenPath, Code: http.StatusForbidden}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	userId, _ := GetUserAuth(c)
+
+	ok, err := fs.filesWithin(userId, claims.Path, ids)
+	if err != nil {
+		return &types.AppError{Error: err}
+	}
+	if !ok {
+		return &types.AppError{Error: errTokenPath, Code: http.StatusForbidden}
+	}
+	return nil
+}
+
+// pathWithin reports whether p is dir or below it.
+func pathWithin(dir, p string) bool {
+	p = path.Clean("/" + p)
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// filesWithin reports whether all files with ids belong to the user and are in the folder
+// at dir or below it.
+func (fs *FileService) filesWithin(userId int64, dir string, ids []string) (bool, error) {
+	encrypted, err := fs.names.EncryptPath(userId, dir)
+	if err != nil {
+		return false, err
+	}
+
+	unique := map[string]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	var count int64
+	if err := fs.db.Raw(`SELECT count(*) FROM teldrive.files AS f
+		LEFT JOIN teldrive.files AS p ON p.id = f.parent_id
+		WHERE f.id IN @ids AND f.user_id = @user
+		AND ((f.type = 'folder' AND (f.path = @dir OR left(f.path, length(@dir) + 1) = @dir || '/'))
+		OR (f.type <> 'folder' AND (p.path = @dir OR left(p.path, length(@dir) + 1) = @dir || '/')))`,
+		map[string]any{"ids": ids, "user": userId, "dir": encrypted}).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count == int64(len(unique)), nil
+}
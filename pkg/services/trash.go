@@ -0,0 +1,119 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+)
+
+// ListTrash lists the items that were deleted by the user, most recent first. Items inside a
+// deleted folder are not listed on their own since they are restored with the folder.
+func (fs *FileService) ListTrash(userId int64, query *schemas.TrashQuery) (*schemas.TrashResponse, *types.AppError) {
+	tx := fs.db.Model(&models.File{}).Where("user_id = ?", userId).Where("status = ?", "trashed").
+		Where("id = trash_root_id")
+
+	if query.NextPageToken != "" {
+		token, err := base64.StdEncoding.DecodeString(query.NextPageToken)
+		if err != nil {
+			return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+		}
+		nanos, id, ok := strings.Cut(string(token), ":")
+		unixNano, err := strconv.ParseInt(nanos, 10, 64)
+		if !ok || err != nil {
+			return nil, &types.AppError{Error: fmt.Errorf("invalid page token"), Code: http.StatusBadRequest}
+		}
+		trashedAt := time.Unix(0, unixNano).UTC()
+		tx = tx.Where("(trashed_at, id) < (?, ?)", trashedAt, id)
+	}
+
+	var files []models.File
+
+	if err := tx.Order("trashed_at DESC").Order("id DESC").Limit(query.PerPage).Find(&files).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := &schemas.TrashResponse{Items: []schemas.TrashItem{}}
+
+	for _, file := range files {
+		fs.names.File(&file)
+		var size int64
+		if file.Size != nil {
+			size = *file.Size
+		}
+		item := schemas.TrashItem{
+			ID:        file.ID,
+			Name:      file.Name,
+			Type:      file.Type,
+			MimeType:  file.MimeType,
+			Size:      size,
+			TrashedAt: *file.TrashedAt,
+		}
+		if file.TrashPath != nil {
+			item.OriginalPath = *file.TrashPath
+		}
+		res.Items = append(res.Items, item)
+	}
+
+	if len(files) == query.PerPage {
+		last := files[len(files)-1]
+		token := fmt.Sprintf("%d:%s", last.TrashedAt.UnixNano(), last.ID)
+		res.NextPageToken = base64.StdEncoding.EncodeToString([]byte(token))
+	}
+
+	return res, nil
+}
+
+// RestoreTrash moves deleted items back to their original folder, recreating it when needed.
+func (fs *FileService) RestoreTrash(userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
+	if err := fs.db.Exec("select teldrive.restore_files($1, $2)", payload.Files, userId).Error; err != nil {
+		if database.IsKeyConflictErr(err) {
+			return nil, &types.AppError{Error: fmt.Errorf("an item with the same name already exists at the original location"),
+				Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.Message{Message: "files restored"}, nil
+}
+
+// DeleteTrash permanently deletes the given items from the trash, or the whole trash if no items are given.
+func (fs *FileService) DeleteTrash(userId int64, payload *schemas.FileOperation) (*schemas.Message, *types.AppError) {
+	tx := fs.db
+	if len(payload.Files) > 0 {
+		tx = tx.Where("id IN ?", payload.Files)
+	}
+	return fs.purgeTrash(tx, userId)
+}
+
+func (fs *FileService) purgeTrash(tx *gorm.DB, userId int64) (*schemas.Message, *types.AppError) {
+	var ids []string
+
+	if err := tx.Model(&models.File{}).Where("user_id = ?", userId).Where("status = ?", "trashed").
+		Where("id = trash_root_id").Pluck("id", &ids).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	if err := PurgeTrash(fs.db, ids); err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return &schemas.Message{Message: "files deleted"}, nil
+}
+
+// PurgeTrash hands the files below the given trashed items over to the cleanup job,
+// which deletes their parts from the channel.
+func PurgeTrash(db *gorm.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Exec("select teldrive.purge_trash($1)", ids).Error
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+)
+
+// trashService keeps deleted items in the trash, the suite service purges them right away.
+func (s *FileServiceSuite) trashService() *FileService {
+	return NewFileService(s.db, &config.Config{Trash: config.TrashConfig{Retention: time.Hour}}, nil)
+}
+
+func (s *FileServiceSuite) create(fs *FileService, name, dir, fileType string) *schemas.FileOut {
+	in := &schemas.FileIn{Name: name, Type: fileType, Path: dir}
+	if fileType == "file" {
+		in = s.entry(name)
+		in.Path = dir
+	}
+	out, appErr := fs.CreateFile(context.Background(), 123456, in)
+	s.Require().Nil(appErr)
+	return out
+}
+
+func (s *FileServiceSuite) stored(id string) *models.File {
+	var files []models.File
+	s.NoError(s.db.Where("id = ?", id).Find(&files).Error)
+	if len(files) == 0 {
+		return nil
+	}
+	return &files[0]
+}
+
+func (s *FileServiceSuite) Test_TrashRestore() {
+	fs := s.trashService()
+
+	docs := s.create(fs, "docs", "/", "folder")
+	sub := s.create(fs, "sub", "/docs", "folder")
+	a := s.create(fs, "a.jpg", "/docs", "file")
+	b := s.create(fs, "b.jpg", "/docs/sub", "file")
+
+	_, appErr := fs.DeleteFiles(123456, &schemas.FileOperation{Files: []string{docs.ID}})
+	s.Nil(appErr)
+
+	for _, id := range []string{docs.ID, sub.ID, a.ID, b.ID} {
+		file := s.stored(id)
+		s.Equal("trashed", file.Status)
+		s.Equal(docs.ID, *file.TrashRootID)
+	}
+
+	// Trashed folders are not found by their path.
+	_, err := fs.getPathId("/docs/sub", 123456)
+	s.Error(err)
+
+	trash, appErr := fs.ListTrash(123456, &schemas.TrashQuery{PerPage: 10})
+	s.Nil(appErr)
+	s.Len(trash.Items, 1)
+	s.Equal(docs.ID, trash.Items[0].ID)
+	s.Equal("/", trash.Items[0].OriginalPath)
+
+	_, appErr = fs.RestoreTrash(123456, &schemas.FileOperation{Files: []string{docs.ID}})
+	s.Nil(appErr)
+
+	for _, id := range []string{docs.ID, sub.ID, a.ID, b.ID} {
+		s.Equal("active", s.stored(id).Status)
+	}
+	s.Equal("/docs/sub", s.stored(sub.ID).Path)
+
+	trash, appErr = fs.ListTrash(123456, &schemas.TrashQuery{PerPage: 10})
+	s.Nil(appErr)
+	s.Empty(trash.Items)
+}
+
+func (s *FileServiceSuite) Test_RestoreConflict() {
+	fs := s.trashService()
+
+	a := s.create(fs, "a.jpg", "/", "file")
+
+	_, appErr := fs.DeleteFiles(123456, &schemas.FileOperation{Files: []string{a.ID}})
+	s.Nil(appErr)
+
+	s.create(fs, "a.jpg", "/", "file")
+
+	_, appErr = fs.RestoreTrash(123456, &schemas.FileOperation{Files: []string{a.ID}})
+	s.NotNil(appErr)
+	s.Equal(http.StatusConflict, appErr.Code)
+	s.Equal("trashed", s.stored(a.ID).Status)
+}
+
+func (s *FileServiceSuite) Test_RestoreChildOfTrashedFolder() {
+	fs := s.trashService()
+
+	docs := s.create(fs, "docs", "/", "folder")
+	a := s.create(fs, "a.jpg", "/docs", "file")
+
+	// The file is trashed on its own before its folder, so both are items of the trash.
+	_, appErr := fs.DeleteFiles(123456, &schemas.FileOperation{Files: []string{a.ID}})
+	s.Nil(appErr)
+	_, appErr = fs.DeleteFiles(123456, &schemas.FileOperation{Files: []string{docs.ID}})
+	s.Nil(appErr)
+
+	trash, appErr := fs.ListTrash(123456, &schemas.TrashQuery{PerPage: 10})
+	s.Nil(appErr)
+	s.Len(trash.Items, 2)
+
+	// The file is restored into a new folder at the original path.
+	_, appErr = fs.RestoreTrash(123456, &schemas.FileOperation{Files: []string{a.ID}})
+	s.Nil(appErr)
+
+	restored := s.stored(a.ID)
+	s.Equal("active", restored.Status)
+	s.NotEqual(docs.ID, restored.ParentID)
+	s.Equal("/docs", s.stored(restored.ParentID).Path)
+	s.Equal("trashed", s.stored(docs.ID).Status)
+
+	// The new folder takes the name of the trashed one.
+	_, appErr = fs.RestoreTrash(123456, &schemas.FileOperation{Files: []string{docs.ID}})
+	s.NotNil(appErr)
+	s.Equal(http.StatusConflict, appErr.Code)
+}
+
+func (s *FileServiceSuite) Test_EmptyTrash() {
+	fs := s.trashService()
+
+	docs := s.create(fs, "docs", "/", "folder")
+	a := s.create(fs, "a.jpg", "/docs", "file")
+	b := s.create(fs, "b.jpg", "/", "file")
+	c := s.create(fs, "c.jpg", "/", "file")
+
+	_, appErr := fs.DeleteFiles(123456, &schemas.FileOperation{Files: []string{docs.ID, b.ID, c.ID}})
+	s.Nil(appErr)
+
+	_, appErr = fs.DeleteTrash(123456, &schemas.FileOperation{Files: []string{c.ID}})
+	s.Nil(appErr)
+	s.Equal("pending_deletion", s.stored(c.ID).Status)
+	s.Equal("trashed", s.stored(b.ID).Status)
+
+	_, appErr = fs.DeleteTrash(123456, &schemas.FileOperation{})
+	s.Nil(appErr)
+
+	s.Nil(s.stored(docs.ID))
+	s.Equal("pending_deletion", s.stored(a.ID).Status)
+	s.Equal("pending_deletion", s.stored(b.ID).Status)
+
+	trash, appErr := fs.ListTrash(123456, &schemas.TrashQuery{PerPage: 10})
+	s.Nil(appErr)
+	s.Empty(trash.Items)
+}
+
+func (s *FileServiceSuite) Test_DeleteWithoutRetention() {
+	docs := s.create(s.srv, "docs", "/", "folder")
+	a := s.create(s.srv, "a.jpg", "/docs", "file")
+
+	_, appErr := s.srv.DeleteFiles(123456, &schemas.FileOperation{Files: []string{docs.ID}})
+	s.Nil(appErr)
+
+	s.Nil(s.stored(docs.ID))
+	s.Equal("pending_deletion", s.stored(a.ID).Status)
+
+	trash, appErr := s.srv.ListTrash(123456, &schemas.TrashQuery{PerPage: 10})
+	s.Nil(appErr)
+	s.Empty(trash.Items)
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusIdChars    = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	errTusNotFound = errors.New("upload not found")
+	errTusExpired  = errors.New("upload expired")
+)
+
+// TusService implements the tus 1.0 resumable upload protocol. Received bytes are
+// buffered on disk and sent to Telegram as a part whenever a part boundary is
+// reached, so an interrupted request only loses the bytes that were never received.
+// Uploaded parts are tracked in the uploads table under the tus upload id.
+type TusService struct {
+	db      *gorm.DB
+	cnf     *config.TGConfig
+	files   *FileService
+	uploads *UploadService
+	mu      sync.Mutex
+	locks   map[string]*tusLock
+}
+
+// tusLock is the lock of an upload, it is dropped when no request holds or waits for it.
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewTusService(db *gorm.DB, cnf *config.Config, files *FileService, uploads *UploadService) *TusService {
+	return &TusService{db: db, cnf: &cnf.TG, files: files, uploads: uploads, locks: make(map[string]*tusLock)}
+}
+
+func (ts *TusService) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Status(http.StatusNoContent)
+}
+
+func (ts *TusService) Create(c *gin.Context) {
+	if !ts.checkVersion(c) {
+		return
+	}
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		ts.error(c, http.StatusBadRequest, errors.New("deferred length is not supported"))
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		ts.error(c, http.StatusBadRequest, errors.New("invalid Upload-Length"))
+		return
+	}
+
+	userId, session := GetUserAuth(c)
+
+	rawMetadata := c.GetHeader("Upload-Metadata")
+
+	metadata := parseTusMetadata(rawMetadata)
+
+	upload := &models.TusUpload{
+		UserID:    userId,
+		Name:      metadata["filename"],
+		Path:      metadata["path"],
+		MimeType:  metadata["filetype"],
+		Length:    length,
+		PartSize:  ts.cnf.Uploads.PartSize,
+		Metadata:  rawMetadata,
+		Encrypted: metadata["encrypted"] == "true",
+		ExpiresAt: time.Now().UTC().Add(ts.cnf.Uploads.Retention),
+	}
+
+	if upload.Name == "" {
+		ts.error(c, http.StatusBadRequest, errors.New("missing filename metadata"))
+		return
+	}
+
+	if upload.Path == "" {
+		upload.Path = "/"
+	}
+	upload.Path = path.Clean("/" + upload.Path)
+
+	if upload.MimeType == "" {
+		upload.MimeType = mimeTypeByName(upload.Name)
+	}
+
+	if upload.Encrypted && ts.cnf.Uploads.EncryptionKey == "" {
+		ts.error(c, http.StatusBadRequest, errors.New("encryption key not found"))
+		return
+	}
+
+	if _, err := ts.files.getPathId(upload.Path, userId); err != nil {
+		ts.error(c, http.StatusNotFound, err)
+		return
+	}
+
+	files, err := uploadedFiles(ts.db, ts.files.names, userId, upload.Path, upload.Name)
+	if err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := checkQuota(ts.db, ts.files.quota, userId, upload.Length, files, true); err != nil {
+		ts.error(c, err.Code, err.Error)
+		return
+	}
+
+	if channel := metadata["channelId"]; channel != "" {
+		upload.ChannelID, err = strconv.ParseInt(channel, 10, 64)
+		if err != nil {
+			ts.error(c, http.StatusBadRequest, errors.New("invalid channelId metadata"))
+			return
+		}
+	} else {
+		upload.ChannelID, err = GetDefaultChannel(c, ts.db, userId)
+		if err != nil {
+			ts.error(c, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	upload.ID, err = randomString(tusIdChars, 32)
+	if err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := ts.db.Create(upload).Error; err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if length == 0 {
+		if err := ts.finish(c, upload, session); err != nil {
+			ts.error(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+func (ts *TusService) Head(c *gin.Context) {
+	if !ts.checkVersion(c) {
+		return
+	}
+
+	userId, _ := GetUserAuth(c)
+
+	upload, code, err := ts.getUpload(userId, c.Param("id"))
+	if err != nil {
+		ts.error(c, code, err)
+		return
+	}
+
+	offset, err := ts.offset(upload)
+	if err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Status(http.StatusOK)
+}
+
+func (ts *TusService) Patch(c *gin.Context) {
+	if !ts.checkVersion(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		ts.error(c, http.StatusUnsupportedMediaType, errors.New("invalid Content-Type"))
+		return
+	}
+
+	clientOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		ts.error(c, http.StatusBadRequest, errors.New("invalid Upload-Offset"))
+		return
+	}
+
+	userId, session := GetUserAuth(c)
+
+	id := c.Param("id")
+
+	unlock := ts.lock(id)
+	defer unlock()
+
+	upload, code, err := ts.getUpload(userId, id)
+	if err != nil {
+		ts.error(c, code, err)
+		return
+	}
+
+	committed, err := ts.committedParts(upload)
+	if err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	buffered, err := ts.bufferSize(upload, committed+1)
+	if err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	offset := int64(committed)*upload.PartSize + buffered
+
+	if clientOffset != offset {
+		ts.error(c, http.StatusConflict, fmt.Errorf("offset mismatch, expected %d", offset))
+		return
+	}
+
+	defer c.Request.Body.Close()
+
+	logger := logging.FromContext(c)
+
+	var bodyErr error
+
+	for {
+		partLength := min(upload.PartSize, upload.Length-int64(committed)*upload.PartSize)
+
+		if buffered == partLength && partLength > 0 {
+			if err := ts.flush(c, upload, session, committed+1, partLength); err != nil {
+				logger.Errorw("tus upload part", "id", upload.ID, "part", committed+1, "err", err)
+				ts.error(c, http.StatusInternalServerError, err)
+				return
+			}
+			committed++
+			buffered = 0
+			continue
+		}
+
+		if offset == upload.Length || bodyErr != nil {
+			break
+		}
+
+		var n int64
+		n, bodyErr = ts.appendBuffer(upload, committed+1, c.Request.Body, partLength-buffered)
+		buffered += n
+		offset += n
+
+		if bodyErr == nil && n == 0 {
+			break
+		}
+	}
+
+	if offset == upload.Length {
+		if err := ts.finish(c, upload, session); err != nil {
+			ts.error(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if bodyErr != nil && !errors.Is(bodyErr, io.EOF) {
+		logger.Debugw("tus upload interrupted", "id", upload.ID, "offset", offset, "err", bodyErr)
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+func (ts *TusService) Delete(c *gin.Context) {
+	if !ts.checkVersion(c) {
+		return
+	}
+
+	userId, session := GetUserAuth(c)
+
+	id := c.Param("id")
+
+	unlock := ts.lock(id)
+	defer unlock()
+
+	upload, code, err := ts.getUpload(userId, id)
+	if err != nil && !errors.Is(err, errTusExpired) {
+		ts.error(c, code, err)
+		return
+	}
+
+	if err := ts.remove(c, upload, session); err != nil {
+		ts.error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (ts *TusService) checkVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		ts.error(c, http.StatusPreconditionFailed, errors.New("unsupported tus version"))
+		return false
+	}
+	return true
+}
+
+func (ts *TusService) error(c *gin.Context, code int, err error) {
+	c.String(code, err.Error())
+}
+
+// lock serializes requests for the same upload.
+func (ts *TusService) lock(id string) func() {
+	ts.mu.Lock()
+	l, ok := ts.locks[id]
+	if !ok {
+		l = &tusLock{}
+		ts.locks[id] = l
+	}
+	l.refs++
+	ts.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		ts.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(ts.locks, id)
+		}
+		ts.mu.Unlock()
+	}
+}
+
+func (ts *TusService) getUpload(userId int64, id string) (*models.TusUpload, int, error) {
+	var upload models.TusUpload
+	if err := ts.db.Where("id = ?", id).Where("user_id = ?", userId).First(&upload).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, http.StatusNotFound, errTusNotFound
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if upload.ExpiresAt.Before(time.Now().UTC()) {
+		return &upload, http.StatusGone, errTusExpired
+	}
+	return &upload, 0, nil
+}
+
+func (ts *TusService) committedParts(upload *models.TusUpload) (int, error) {
+	var count int64
+	err := ts.db.Model(&models.Upload{}).Where("upload_id = ?", upload.ID).
+		Distinct("part_no").Count(&count).Error
+	return int(count), err
+}
+
+func (ts *TusService) offset(upload *models.TusUpload) (int64, error) {
+	committed, err := ts.committedParts(upload)
+	if err != nil {
+		return 0, err
+	}
+	buffered, err := ts.bufferSize(upload, committed+1)
+	if err != nil {
+		return 0, err
+	}
+	return min(int64(committed)*upload.PartSize, upload.Length) + buffered, nil
+}
+
+func (ts *TusService) bufferPath(upload *models.TusUpload, partNo int) string {
+	return filepath.Join(tusBufferDir(ts.cnf), fmt.Sprintf("%s.%d", upload.ID, partNo))
+}
+
+func (ts *TusService) bufferSize(upload *models.TusUpload, partNo int) (int64, error) {
+	info, err := os.Stat(ts.bufferPath(upload, partNo))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (ts *TusService) appendBuffer(upload *models.TusUpload, partNo int, r io.Reader, n int64) (int64, error) {
+	if err := os.MkdirAll(tusBufferDir(ts.cnf), 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(ts.bufferPath(upload, partNo), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.CopyN(f, r, n)
+}
+
+// flush sends a complete buffered part to Telegram.
+func (ts *TusService) flush(ctx context.Context, upload *models.TusUpload, session string, partNo int, size int64) error {
+	f, err := os.Open(ts.bufferPath(upload, partNo))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	totalParts := int((upload.Length + upload.PartSize - 1) / upload.PartSize)
+
+	_, err = ts.uploads.uploadPart(ctx, upload.UserID, session, upload.ID, &schemas.UploadQuery{
+		PartName:  partName(upload.Name, partNo, totalParts),
+		FileName:  upload.Name,
+		PartNo:    partNo,
+		ChannelID: upload.ChannelID,
+		Encrypted: upload.Encrypted,
+		Path:      upload.Path,
+	}, f, size)
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// finish creates the file from the uploaded parts and forgets the upload.
+func (ts *TusService) finish(ctx context.Context, upload *models.TusUpload, session string) error {
+	var uploads []models.Upload
+	if err := ts.db.Where("upload_id = ?", upload.ID).Where("user_id = ?", upload.UserID).
+		Order("part_no").Find(&uploads).Error; err != nil {
+		return err
+	}
+
+	parts := []schemas.Part{}
+	for _, part := range uploads {
+		parts = append(parts, schemas.Part{ID: int64(part.PartId), Salt: part.Salt, KeyID: part.KeyID})
+	}
+
+	if _, err := ts.files.replaceFile(ctx, upload.UserID, &schemas.FileIn{
+		Name:      upload.Name,
+		Type:      "file",
+		Parts:     parts,
+		MimeType:  upload.MimeType,
+		ChannelID: upload.ChannelID,
+		Path:      upload.Path,
+		Size:      upload.Length,
+		Encrypted: upload.Encrypted,
+	}); err != nil {
+		return err
+	}
+
+	return ts.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", upload.ID).Delete(&models.Upload{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", upload.ID).Delete(&models.TusUpload{}).Error
+	})
+}
+
+// remove forgets an upload and deletes the parts it sent. Parts that can't be deleted
+// are left to the uploads cleanup.
+func (ts *TusService) remove(ctx context.Context, upload *models.TusUpload, session string) error {
+	if err := ts.db.Where("id = ?", upload.ID).Delete(&models.TusUpload{}).Error; err != nil {
+		return err
+	}
+	removeTusBuffers(tusBufferDir(ts.cnf), upload.ID)
+
+	var uploads []models.Upload
+	if err := ts.db.Where("upload_id = ?", upload.ID).Where("user_id = ?", upload.UserID).
+		Find(&uploads).Error; err != nil {
+		return err
+	}
+	if err := ts.uploads.deleteUploads(ctx, upload.UserID, session, uploads); err != nil {
+		logging.FromContext(ctx).Errorw("failed to delete tus upload parts", "id", upload.ID, "err", err)
+	}
+	return nil
+}
+
+func tusBufferDir(cnf *config.TGConfig) string {
+	if cnf.Uploads.BufferDir != "" {
+		return cnf.Uploads.BufferDir
+	}
+	return filepath.Join(os.TempDir(), "teldrive-uploads")
+}
+
+func removeTusBuffers(dir, id string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, id+".*"))
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// ExpireTusUploads removes expired tus uploads and their buffered bytes. Parts that
+// were already sent are left to the uploads cleanup.
+func ExpireTusUploads(db *gorm.DB, cnf *config.TGConfig) (int, error) {
+	var ids []string
+	if err := db.Model(&models.TusUpload{}).Where("expires_at < ?", time.Now().UTC()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := db.Where("id IN ?", ids).Delete(&models.TusUpload{}).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		removeTusBuffers(tusBufferDir(cnf), id)
+	}
+	return len(ids), nil
+}
+
+// parseTusMetadata decodes an Upload-Metadata header of comma separated keys with
+// optional base64 encoded values.
+func parseTusMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/utils"
+	"github.com/divyam234/teldrive/pkg/mapper"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type TusServiceSuite struct {
+	suite.Suite
+	db  *gorm.DB
+	srv *TusService
+}
+
+func (s *TusServiceSuite) SetupSuite() {
+	s.db = database.NewTestDatabase(s.T(), false)
+	cnf := &config.Config{}
+	cnf.TG.Uploads.PartSize = 1 << 20
+	cnf.TG.Uploads.Retention = time.Hour
+	files := NewFileService(s.db, cnf, nil)
+	s.srv = NewTusService(s.db, cnf, files, NewUploadService(s.db, cnf, nil, nil))
+}
+
+func (s *TusServiceSuite) SetupTest() {
+	s.db.Where("id is not NULL").Delete(&models.File{})
+	s.db.Where("id is not NULL").Delete(&models.TusUpload{})
+	s.db.Create(&models.File{
+		Name:     "root",
+		Type:     "folder",
+		MimeType: "drive/folder",
+		Path:     "/",
+		Depth:    utils.IntPointer(0),
+		UserID:   123456,
+		Status:   "active",
+		ParentID: "root",
+	})
+}
+
+func (s *TusServiceSuite) Test_EmptyUpload() {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/tus", nil)
+	c.Request.Header.Set("Tus-Resumable", tusVersion)
+	c.Request.Header.Set("Upload-Length", "0")
+	// filename empty.txt, channelId 123456
+	c.Request.Header.Set("Upload-Metadata", "filename ZW1wdHkudHh0,channelId MTIzNDU2")
+	c.Set("jwtUser", &types.JWTClaims{Claims: jwt.Claims{Subject: "123456"}})
+
+	s.srv.Create(c)
+	s.Require().Equal(http.StatusCreated, c.Writer.Status(), w.Body.String())
+
+	var file models.File
+	s.Require().NoError(s.db.Where("name = ?", "empty.txt").Where("user_id = ?", 123456).First(&file).Error)
+	s.Equal(int64(0), *file.Size)
+
+	var count int64
+	s.db.Model(&models.TusUpload{}).Count(&count)
+	s.Equal(int64(0), count)
+
+	var buf bytes.Buffer
+	out := mapper.ToFileOutFull(file)
+	s.NoError(s.srv.files.copyRange(c, nil, "", out, &buf, 0, out.Size-1))
+	s.Equal(0, buf.Len())
+}
+
+func TestTusSuite(t *testing.T) {
+	suite.Run(t, new(TusServiceSuite))
+}
+
+func TestTusLockPruned(t *testing.T) {
+	ts := &TusService{locks: make(map[string]*tusLock)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := ts.lock("upload")
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, ts.locks)
+}
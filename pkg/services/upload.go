@@ -7,13 +7,19 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/divyam234/teldrive/internal/checksum"
 	"github.com/divyam234/teldrive/internal/crypt"
 	"github.com/divyam234/teldrive/internal/kv"
+	"github.com/divyam234/teldrive/internal/md5"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/pkg/logging"
 	"github.com/divyam234/teldrive/pkg/mapper"
@@ -37,11 +43,12 @@ type UploadService struct {
 	db     *gorm.DB
 	worker *tgc.UploadWorker
 	cnf    *config.TGConfig
+	quota  *config.QuotaConfig
 	kv     kv.KV
 }
 
 func NewUploadService(db *gorm.DB, cnf *config.Config, worker *tgc.UploadWorker, kv kv.KV) *UploadService {
-	return &UploadService{db: db, worker: worker, cnf: &cnf.TG, kv: kv}
+	return &UploadService{db: db, worker: worker, cnf: &cnf.TG, quota: &cnf.Quota, kv: kv}
 }
 
 func (us *UploadService) GetUploadFileById(c *gin.Context) (*schemas.UploadOut, *types.AppError) {
@@ -93,16 +100,7 @@ func (us *UploadService) GetUploadStats(userId int64, days int) ([]schemas.Uploa
 }
 
 func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *types.AppError) {
-	var (
-		uploadQuery schemas.UploadQuery
-		channelId   int64
-		err         error
-		client      *telegram.Client
-		token       string
-		index       int
-		channelUser string
-		out         *schemas.UploadPartOut
-	)
+	var uploadQuery schemas.UploadQuery
 
 	if err := c.ShouldBindQuery(&uploadQuery); err != nil {
 		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
@@ -115,47 +113,105 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 
 	userId, session := GetUserAuth(c)
 
-	uploadId := c.Param("id")
+	defer c.Request.Body.Close()
 
-	fileStream := c.Request.Body
+	// Parts of files uploaded into a folder shared with the user are stored by its owner.
+	if uploadQuery.ParentID != "" {
+		folder, appErr := authorizeFolder(us.db, userId, uploadQuery.ParentID, roleEditor)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if folder.UserID != userId {
+			owner, err := getUserSession(us.db, folder.UserID)
+			if err != nil {
+				return nil, &types.AppError{Error: err}
+			}
+			userId, session = folder.UserID, owner.Session
+			uploadQuery.Path = newNames(us.cnf).DecryptPath(folder.UserID, folder.Path)
+		}
+	}
 
-	fileSize := c.Request.ContentLength
+	// The file of an upload is counted once, with its first part.
+	files := int64(0)
+	if uploadQuery.PartNo <= 1 {
+		var err error
+		files, err = uploadedFiles(us.db, newNames(us.cnf), userId, uploadQuery.Path, uploadQuery.FileName)
+		if err != nil {
+			return nil, &types.AppError{Error: err}
+		}
+	}
 
-	defer c.Request.Body.Close()
+	if err := checkQuota(us.db, us.quota, userId, c.Request.ContentLength, files, true); err != nil {
+		return nil, err
+	}
+
+	out, err := us.uploadPart(c, userId, session, c.Param("id"), &uploadQuery, c.Request.Body, c.Request.ContentLength)
+
+	if err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	return out, nil
+}
+
+// uploadPart sends a single part to the storage channel and records it in the uploads table.
+func (us *UploadService) uploadPart(ctx context.Context, userId int64, session string, uploadId string,
+	uploadQuery *schemas.UploadQuery, fileStream io.Reader, fileSize int64) (*schemas.UploadPartOut, error) {
+	var (
+		channelId   int64
+		err         error
+		client      *telegram.Client
+		token       string
+		index       int
+		channelUser string
+		out         *schemas.UploadPartOut
+	)
 
 	if uploadQuery.ChannelID == 0 {
-		channelId, err = GetDefaultChannel(c, us.db, userId)
+		channelId, err = GetDefaultChannel(ctx, us.db, userId)
 		if err != nil {
-			return nil, &types.AppError{Error: err}
+			return nil, err
 		}
 	} else {
 		channelId = uploadQuery.ChannelID
 	}
 
-	tokens, err := getBotsToken(c, us.db, userId, channelId)
+	tokens, err := getBotsToken(ctx, us.db, userId, channelId)
 
 	if err != nil {
-		return nil, &types.AppError{Error: err}
+		return nil, err
 	}
 
 	if len(tokens) == 0 {
-		client, _ = tgc.AuthClient(c, us.cnf, session)
+		client, _ = tgc.AuthClient(ctx, us.cnf, session)
 		channelUser = strconv.FormatInt(userId, 10)
 	} else {
 		us.worker.Set(tokens, channelId)
 		token, index = us.worker.Next(channelId)
-		client, _ = tgc.BotClient(c, us.kv, us.cnf, token)
+		client, _ = tgc.BotClient(ctx, us.kv, us.cnf, token)
 		channelUser = strings.Split(token, ":")[0]
 	}
 
-	logger := logging.FromContext(c)
+	partHash := checksum.New()
+
+	var hashWriter io.Writer = partHash
+
+	fileHash := us.fileHasher(userId, uploadId, uploadQuery.PartNo)
+
+	if fileHash != nil {
+		hashWriter = io.MultiWriter(partHash, fileHash)
+	}
+
+	fileStream = io.TeeReader(fileStream, hashWriter)
+
+	logger := logging.FromContext(ctx)
 
 	logger.Debugw("uploading file", "fileName", uploadQuery.FileName,
 		"partName", uploadQuery.PartName,
 		"bot", channelUser, "botNo", index,
 		"chunkNo", uploadQuery.PartNo, "partSize", fileSize)
 
-	err = tgc.RunWithAuth(c, client, token, func(ctx context.Context) error {
+	err = tgc.RunWithAuth(ctx, client, token, func(ctx context.Context) error {
 
 		channel, err := GetChannelById(ctx, client, channelId, channelUser)
 
@@ -164,67 +220,60 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 			return err
 		}
 
-		var salt string
+		var (
+			salt  string
+			keyId int64
+		)
 
 		if uploadQuery.Encrypted {
+			var password, folderPath string
+			folderPath, err = newNames(us.cnf).EncryptPath(userId, uploadQuery.Path)
+			if err != nil {
+				return err
+			}
+			keyId, password, err = newKeyring(us.db, us.cnf).ForFile(userId, folderPath)
+			if err != nil {
+				return err
+			}
 			//gen random Salt
 			salt, _ = generateRandomSalt()
-			cipher, _ := crypt.NewCipher(us.cnf.Uploads.EncryptionKey, salt)
+			cipher, _ := crypt.NewCipher(password, salt)
 			fileSize = crypt.EncryptedSize(fileSize)
 			fileStream, _ = cipher.EncryptData(fileStream)
 		}
 
 		api := client.API()
 
-		u := uploader.NewUploader(api).WithThreads(us.cnf.Uploads.Threads).WithPartSize(512 * 1024)
-
-		upload, err := u.Upload(c, uploader.NewUpload(uploadQuery.PartName, fileStream, fileSize))
-
-		if err != nil {
-			return err
-		}
-
-		document := message.UploadedDocument(upload).Filename(uploadQuery.PartName).ForceFile(true)
-
-		sender := message.NewSender(client.API())
-
-		target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
-			AccessHash: channel.AccessHash})
-
-		res, err := target.Media(c, document)
+		messageId, err := sendDocument(ctx, client, channel, us.cnf.Uploads.Threads, uploadQuery.PartName,
+			fileStream, fileSize)
 
 		if err != nil {
 			return err
 		}
 
-		updates := res.(*tg.Updates)
-
-		var message *tg.Message
-
-		for _, update := range updates.Updates {
-			channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
-			if ok {
-				message = channelMsg.Message.(*tg.Message)
-				break
-			}
-		}
-
 		partUpload := &models.Upload{
 			Name:      uploadQuery.PartName,
 			UploadId:  uploadId,
-			PartId:    message.ID,
+			PartId:    messageId,
 			ChannelID: channelId,
 			Size:      fileSize,
 			PartNo:    uploadQuery.PartNo,
 			UserId:    userId,
 			Encrypted: uploadQuery.Encrypted,
 			Salt:      salt,
+			KeyID:     keyId,
+		}
+
+		partUpload.Sha256, partUpload.Md5 = partHash.Sums()
+
+		if fileHash != nil {
+			partUpload.HashState, _ = fileHash.State()
 		}
 
 		if err := us.db.Create(partUpload).Error; err != nil {
 			//delete uploaded part if upload fails
-			if message.ID != 0 {
-				api.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: []int{message.ID}})
+			if messageId != 0 {
+				api.ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: []int{messageId}})
 			}
 			return err
 		}
@@ -235,7 +284,7 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 	})
 
 	if err != nil {
-		return nil, &types.AppError{Error: err}
+		return nil, err
 	}
 
 	logger.Debugw("upload finished", "fileName", uploadQuery.FileName,
@@ -245,6 +294,197 @@ func (us *UploadService) UploadFile(c *gin.Context) (*schemas.UploadPartOut, *ty
 	return out, nil
 }
 
+// sendDocument uploads size bytes from r as a document named name and posts it to channel.
+// It returns the ID of the message holding the document.
+func sendDocument(ctx context.Context, client *telegram.Client, channel *tg.InputChannel, threads int,
+	name string, r io.Reader, size int64) (int, error) {
+
+	u := uploader.NewUploader(client.API()).WithThreads(threads).WithPartSize(512 * 1024)
+
+	upload, err := u.Upload(ctx, uploader.NewUpload(name, r, size))
+
+	if err != nil {
+		return 0, err
+	}
+
+	document := message.UploadedDocument(upload).Filename(name).ForceFile(true)
+
+	sender := message.NewSender(client.API())
+
+	target := sender.To(&tg.InputPeerChannel{ChannelID: channel.ChannelID,
+		AccessHash: channel.AccessHash})
+
+	res, err := target.Media(ctx, document)
+
+	if err != nil {
+		return 0, err
+	}
+
+	updates := res.(*tg.Updates)
+
+	for _, update := range updates.Updates {
+		channelMsg, ok := update.(*tg.UpdateNewChannelMessage)
+		if ok {
+			return channelMsg.Message.(*tg.Message).ID, nil
+		}
+	}
+
+	return 0, errors.New("message not found in updates")
+}
+
+// fileHasher returns the hasher of the whole file continued from the previous part of
+// the upload, or nil when the parts are not uploaded in order.
+func (us *UploadService) fileHasher(userId int64, uploadId string, partNo int) *checksum.Hasher {
+	if partNo == 1 {
+		return checksum.New()
+	}
+
+	var prev models.Upload
+	if err := us.db.Where("upload_id = ?", uploadId).Where("user_id = ?", userId).
+		Where("part_no = ?", partNo-1).Take(&prev).Error; err != nil || prev.HashState == nil {
+		return nil
+	}
+
+	hasher, err := checksum.Resume(prev.HashState)
+	if err != nil {
+		return nil
+	}
+	return hasher
+}
+
+// putFile uploads size bytes from r as the file at filePath, replacing an existing file.
+func (us *UploadService) putFile(ctx context.Context, files *FileService, userId int64, session string,
+	filePath string, r io.Reader, size int64, mimeType string) (*schemas.FileOut, error) {
+
+	dir, fileName := path.Split(path.Clean(filePath))
+
+	added, err := uploadedFiles(us.db, files.names, userId, dir, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkQuota(us.db, us.quota, userId, size, added, true); err != nil {
+		return nil, err.Error
+	}
+
+	channelId, err := GetDefaultChannel(ctx, us.db, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadId := md5.FromString(fmt.Sprintf("%d:%s:%d", userId, filePath, time.Now().UnixNano()))
+
+	parts, err := us.uploadParts(ctx, userId, session, uploadId, fileName, channelId, r, size, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if mimeType == "" {
+		mimeType = mimeTypeByName(fileName)
+	}
+
+	out, err := files.replaceFile(ctx, userId, &schemas.FileIn{
+		Name:      fileName,
+		Type:      "file",
+		Parts:     parts,
+		MimeType:  mimeType,
+		ChannelID: channelId,
+		Path:      path.Clean(dir),
+		Size:      size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	us.db.Where("upload_id = ?", uploadId).Delete(&models.Upload{})
+
+	return out, nil
+}
+
+// uploadParts splits size bytes of r into parts of the configured size and uploads them in order.
+func (us *UploadService) uploadParts(ctx context.Context, userId int64, session string, uploadId string,
+	fileName string, channelId int64, r io.Reader, size int64, encrypted bool) ([]schemas.Part, error) {
+
+	partSize := us.cnf.Uploads.PartSize
+
+	totalParts := int((size + partSize - 1) / partSize)
+
+	parts := []schemas.Part{}
+
+	for i := 0; i < totalParts; i++ {
+		offset := int64(i) * partSize
+		length := min(partSize, size-offset)
+
+		uploadQuery := &schemas.UploadQuery{
+			PartName:  partName(fileName, i+1, totalParts),
+			FileName:  fileName,
+			PartNo:    i + 1,
+			ChannelID: channelId,
+			Encrypted: encrypted,
+		}
+
+		out, err := us.uploadPart(ctx, userId, session, uploadId, uploadQuery,
+			io.LimitReader(r, length), length)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, schemas.Part{ID: int64(out.PartId), Salt: out.Salt, KeyID: out.KeyID})
+	}
+	return parts, nil
+}
+
+// deleteUploads deletes uploaded parts together with their messages. Parts whose messages
+// can't be deleted are kept, the uploads cleanup deletes them once they expire.
+func (us *UploadService) deleteUploads(ctx context.Context, userId int64, session string, uploads []models.Upload) error {
+	if len(uploads) == 0 {
+		return nil
+	}
+
+	byChannel := map[int64][]int{}
+	for _, upload := range uploads {
+		byChannel[upload.ChannelID] = append(byChannel[upload.ChannelID], upload.PartId)
+	}
+
+	client, err := tgc.AuthClient(ctx, us.cnf, session)
+	if err != nil {
+		return err
+	}
+
+	channelUser := strconv.FormatInt(userId, 10)
+
+	return tgc.RunWithAuth(ctx, client, "", func(ctx context.Context) error {
+		for channelId, ids := range byChannel {
+			channel, err := GetChannelById(ctx, client, channelId, channelUser)
+			if err != nil {
+				return err
+			}
+			if _, err := client.API().ChannelsDeleteMessages(ctx,
+				&tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: ids}); err != nil {
+				return err
+			}
+			if err := us.db.Where("user_id = ?", userId).Where("channel_id = ?", channelId).
+				Where("part_id IN ?", ids).Delete(&models.Upload{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func partName(fileName string, partNo, totalParts int) string {
+	if totalParts > 1 {
+		return fmt.Sprintf("%s.part.%03d", fileName, partNo)
+	}
+	return fileName
+}
+
+func mimeTypeByName(name string) string {
+	if mimeType := mime.TypeByExtension(path.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
 func generateRandomSalt() (string, error) {
 	randomBytes := make([]byte, saltLength)
 	_, err := rand.Read(randomBytes)
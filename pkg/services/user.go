@@ -10,6 +10,7 @@ import (
 
 	"github.com/divyam234/teldrive/internal/cache"
 	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
 	"github.com/divyam234/teldrive/internal/kv"
 	"github.com/divyam234/teldrive/internal/tgc"
 	"github.com/divyam234/teldrive/pkg/logging"
@@ -93,7 +94,12 @@ func (us *UserService) GetStats(c *gin.Context) (*schemas.AccountStats, *types.A
 	if err != nil {
 		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
 	}
-	return &schemas.AccountStats{Bots: tokens, ChannelID: channelId}, nil
+
+	quota, err := getQuota(us.db, &us.cnf.Quota, userID)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+	return &schemas.AccountStats{Bots: tokens, ChannelID: channelId, Quota: quota}, nil
 }
 
 func (us *UserService) UpdateChannel(c *gin.Context) (*schemas.Message, *types.AppError) {
@@ -311,3 +317,62 @@ func (us *UserService) addBots(c context.Context, client *telegram.Client, userI
 	return &schemas.Message{Message: "bots added"}, nil
 
 }
+
+func (us *UserService) ListAccessKeys(c *gin.Context) ([]schemas.AccessKeyOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	keys := []schemas.AccessKeyOut{}
+
+	if err := us.db.Model(&models.AccessKey{}).Select("access_key_id", "name", "created_at").
+		Where("user_id = ?", userId).Order("created_at desc").Scan(&keys).Error; err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	return keys, nil
+}
+
+func (us *UserService) CreateAccessKey(c *gin.Context) (*schemas.AccessKeyOut, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	var payload schemas.AccessKeyIn
+
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusBadRequest}
+	}
+
+	accessKeyId, err := randomString(accessKeyIdChars, 20)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	secretKey, err := randomString(secretKeyChars, 40)
+	if err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	key := &models.AccessKey{AccessKeyID: accessKeyId, SecretKey: secretKey, Name: payload.Name, UserID: userId}
+
+	if err := us.db.Create(key).Error; err != nil {
+		return nil, &types.AppError{Error: err, Code: http.StatusInternalServerError}
+	}
+
+	return &schemas.AccessKeyOut{AccessKeyID: key.AccessKeyID, SecretKey: key.SecretKey, Name: key.Name,
+		CreatedAt: key.CreatedAt}, nil
+}
+
+func (us *UserService) DeleteAccessKey(c *gin.Context) (*schemas.Message, *types.AppError) {
+	userId, _ := GetUserAuth(c)
+
+	res := us.db.Where("access_key_id = ?", c.Param("id")).Where("user_id = ?", userId).
+		Delete(&models.AccessKey{})
+
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error, Code: http.StatusInternalServerError}
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+	}
+
+	return &schemas.Message{Message: "access key deleted"}, nil
+}
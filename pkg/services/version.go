@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/config"
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/pkg/models"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errVersionNotFound = errors.New("version not found")
+
+// overwriteFile replaces the content of the active file that conflicts with fileDB and
+// keeps the previous content as a version of it.
+func (fs *FileService) overwriteFile(ctx context.Context, fileDB *models.File) (*schemas.FileOut, *types.AppError) {
+	var file, previous models.File
+
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", fileDB.UserID).
+			Where("parent_id = ?", fileDB.ParentID).Where("name = ?", fileDB.Name).
+			Where("status = ?", "active").First(&file).Error; err != nil {
+			return err
+		}
+
+		if file.Type != "file" {
+			return database.ErrKeyConflict
+		}
+
+		if err := tx.Create(fs.newVersion(&file)).Error; err != nil {
+			return err
+		}
+
+		previous = file
+
+		file.Parts = fileDB.Parts
+		file.Size = fileDB.Size
+		file.ChannelID = fileDB.ChannelID
+		file.MimeType = fileDB.MimeType
+		file.Category = fileDB.Category
+		file.Encrypted = fileDB.Encrypted
+		file.Sha256 = fileDB.Sha256
+		file.Md5 = fileDB.Md5
+		file.Thumbnail = nil
+		file.UpdatedAt = time.Now().UTC()
+
+		return tx.Model(&file).Select("parts", "size", "channel_id", "mime_type", "category", "encrypted",
+			"sha256", "md5", "thumbnail", "updated_at").Updates(&file).Error
+	})
+
+	if err != nil {
+		if database.IsRecordNotFoundErr(err) || errors.Is(err, database.ErrKeyConflict) {
+			return nil, &types.AppError{Error: database.ErrKeyConflict, Code: http.StatusConflict}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	fs.invalidateParts(ctx, &previous)
+
+	fs.queueThumbnail(&file)
+
+	return fs.toFileOut(file), nil
+}
+
+// newVersion captures the current content of file. When versions are disabled the
+// version is created for deletion right away so that its parts are cleaned up.
+func (fs *FileService) newVersion(file *models.File) *models.FileVersion {
+	version := &models.FileVersion{
+		FileID:     file.ID,
+		UserID:     file.UserID,
+		Parts:      file.Parts,
+		MimeType:   file.MimeType,
+		Encrypted:  file.Encrypted,
+		Sha256:     file.Sha256,
+		Md5:        file.Md5,
+		Thumbnail:  file.Thumbnail,
+		Status:     "active",
+		ModifiedAt: file.UpdatedAt,
+	}
+	if file.Size != nil {
+		version.Size = *file.Size
+	}
+	if file.ChannelID != nil {
+		version.ChannelID = *file.ChannelID
+	}
+	if fs.versions.Keep == 0 {
+		version.Status = "pending_deletion"
+	}
+	return version
+}
+
+func (fs *FileService) ListVersions(userId int64, fileId string) ([]schemas.FileVersionOut, *types.AppError) {
+	if _, appErr := fs.getUserFile(fs.db, userId, fileId); appErr != nil {
+		return nil, appErr
+	}
+
+	var versions []models.FileVersion
+
+	if err := fs.db.Where("file_id = ?", fileId).Where("status = ?", "active").
+		Order("created_at DESC").Find(&versions).Error; err != nil {
+		return nil, &types.AppError{Error: err}
+	}
+
+	res := []schemas.FileVersionOut{}
+	for _, version := range versions {
+		out := schemas.FileVersionOut{
+			ID:        version.ID,
+			Size:      version.Size,
+			MimeType:  version.MimeType,
+			UpdatedAt: version.ModifiedAt,
+			CreatedAt: version.CreatedAt,
+		}
+		if version.Sha256 != nil {
+			out.Sha256 = *version.Sha256
+		}
+		if version.Md5 != nil {
+			out.Md5 = *version.Md5
+		}
+		res = append(res, out)
+	}
+	return res, nil
+}
+
+// RestoreVersion makes a version the current content of the file. The content it
+// replaces is kept as a new version.
+func (fs *FileService) RestoreVersion(c context.Context, userId int64, fileId, versionId string) (*schemas.FileOut, *types.AppError) {
+	var (
+		file     *models.File
+		previous models.File
+	)
+
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		var appErr *types.AppError
+		file, appErr = fs.getUserFile(tx.Clauses(clause.Locking{Strength: "UPDATE"}), userId, fileId)
+		if appErr != nil {
+			return appErr.Error
+		}
+
+		version, err := getVersion(tx, fileId, versionId)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(fs.newVersion(file)).Error; err != nil {
+			return err
+		}
+
+		previous = *file
+
+		file.Parts = version.Parts
+		file.Size = &version.Size
+		file.ChannelID = &version.ChannelID
+		file.MimeType = version.MimeType
+		file.Encrypted = version.Encrypted
+		file.Sha256 = version.Sha256
+		file.Md5 = version.Md5
+		file.Thumbnail = version.Thumbnail
+		file.UpdatedAt = time.Now().UTC()
+
+		if err := tx.Model(file).Select("parts", "size", "channel_id", "mime_type", "encrypted",
+			"sha256", "md5", "thumbnail", "updated_at").Updates(file).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(version).Error
+	})
+
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
+		}
+		if errors.Is(err, errVersionNotFound) {
+			return nil, &types.AppError{Error: err, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+
+	fs.invalidateParts(c, &previous)
+
+	fs.queueThumbnail(file)
+
+	return fs.toFileOut(*file), nil
+}
+
+func (fs *FileService) DeleteVersion(userId int64, fileId, versionId string) (*schemas.Message, *types.AppError) {
+	if _, appErr := fs.getUserFile(fs.db, userId, fileId); appErr != nil {
+		return nil, appErr
+	}
+
+	res := fs.db.Model(&models.FileVersion{}).Where("id = ?", versionId).Where("file_id = ?", fileId).
+		Where("status = ?", "active").Update("status", "pending_deletion")
+	if res.Error != nil {
+		return nil, &types.AppError{Error: res.Error}
+	}
+	if res.RowsAffected == 0 {
+		return nil, &types.AppError{Error: errVersionNotFound, Code: http.StatusNotFound}
+	}
+	return &schemas.Message{Message: "version deleted"}, nil
+}
+
+func (fs *FileService) getUserFile(db *gorm.DB, userId int64, fileId string) (*models.File, *types.AppError) {
+	var file models.File
+	if err := db.Where("id = ?", fileId).Where("user_id = ?", userId).Where("type = ?", "file").
+		Where("status = ?", "active").First(&file).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, &types.AppError{Error: database.ErrNotFound, Code: http.StatusNotFound}
+		}
+		return nil, &types.AppError{Error: err}
+	}
+	return &file, nil
+}
+
+func getVersion(db *gorm.DB, fileId, versionId string) (*models.FileVersion, error) {
+	var version models.FileVersion
+	if err := db.Where("id = ?", versionId).Where("file_id = ?", fileId).Where("status = ?", "active").
+		First(&version).Error; err != nil {
+		if database.IsRecordNotFoundErr(err) {
+			return nil, errVersionNotFound
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// PruneVersions marks versions beyond the newest cnf.Keep of each file, or older than
+// cnf.Retention, for deletion.
+func PruneVersions(db *gorm.DB, cnf *config.VersionsConfig) (int64, error) {
+	query := `UPDATE teldrive.file_versions SET status = 'pending_deletion' WHERE id IN (
+		SELECT id FROM (SELECT id, created_at,
+			row_number() OVER (PARTITION BY file_id ORDER BY created_at DESC) AS rn
+			FROM teldrive.file_versions WHERE status = 'active') AS v
+		WHERE v.rn > ? OR v.created_at < ?)`
+
+	cutoff := time.Time{}
+	if cnf.Retention > 0 {
+		cutoff = time.Now().UTC().Add(-cnf.Retention)
+	}
+
+	res := db.Exec(query, cnf.Keep, cutoff)
+	return res.RowsAffected, res.Error
+}
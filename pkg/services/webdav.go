@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/divyam234/teldrive/internal/database"
+	"github.com/divyam234/teldrive/internal/md5"
+	"github.com/divyam234/teldrive/pkg/logging"
+	"github.com/divyam234/teldrive/pkg/schemas"
+	"github.com/divyam234/teldrive/pkg/types"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/webdav"
+)
+
+const webdavPrefix = "/webdav"
+
+type WebdavService struct {
+	files   *FileService
+	uploads *UploadService
+	mu      sync.Mutex
+	locks   map[int64]webdav.LockSystem
+}
+
+func NewWebdavService(files *FileService, uploads *UploadService) *WebdavService {
+	return &WebdavService{files: files, uploads: uploads, locks: make(map[int64]webdav.LockSystem)}
+}
+
+func (ws *WebdavService) Handle(c *gin.Context) {
+	userId, session := GetUserAuth(c)
+
+	logger := logging.FromContext(c)
+
+	handler := &webdav.Handler{
+		Prefix:     webdavPrefix,
+		FileSystem: &webdavFS{ws: ws, userId: userId, session: session},
+		LockSystem: ws.lockSystem(userId),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Debugw("webdav", "method", r.Method, "path", r.URL.Path, "err", err)
+			}
+		},
+	}
+
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+func (ws *WebdavService) lockSystem(userId int64) webdav.LockSystem {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ls, ok := ws.locks[userId]
+	if !ok {
+		ls = webdav.NewMemLS()
+		ws.locks[userId] = ls
+	}
+	return ls
+}
+
+type webdavFS struct {
+	ws      *WebdavService
+	userId  int64
+	session string
+}
+
+func webdavError(err *types.AppError) error {
+	if err.Code == http.StatusNotFound || database.IsRecordNotFoundErr(err.Error) {
+		return os.ErrNotExist
+	}
+	if err.Code == http.StatusConflict {
+		return os.ErrExist
+	}
+	return err.Error
+}
+
+func (wfs *webdavFS) stat(name string) (*schemas.FileOutFull, error) {
+	file, err := wfs.ws.files.GetFileByPath(wfs.userId, name)
+	if err != nil {
+		return nil, webdavError(err)
+	}
+	return file, nil
+}
+
+func (wfs *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = path.Clean(name)
+
+	if _, err := wfs.stat(name); err == nil {
+		return os.ErrExist
+	}
+
+	parent, err := wfs.stat(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if parent.Type != "folder" {
+		return os.ErrNotExist
+	}
+
+	if _, err := wfs.ws.files.MakeDirectory(wfs.userId, &schemas.MkDir{Path: name}); err != nil {
+		return webdavError(err)
+	}
+	return nil
+}
+
+func (wfs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = path.Clean(name)
+
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		parent, err := wfs.stat(path.Dir(name))
+		if err != nil {
+			return nil, err
+		}
+		if parent.Type != "folder" {
+			return nil, os.ErrNotExist
+		}
+		if existing, err := wfs.stat(name); err == nil {
+			if existing.Type == "folder" || flag&os.O_EXCL != 0 {
+				return nil, os.ErrExist
+			}
+		}
+		return newWebdavWriter(ctx, wfs, name)
+	}
+
+	file, err := wfs.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &webdavFile{fileReadSeeker: wfs.ws.files.newFileReadSeeker(ctx, wfs.userId, wfs.session, file), fs: wfs}, nil
+}
+
+func (wfs *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	name = path.Clean(name)
+	if name == "/" {
+		return os.ErrPermission
+	}
+	file, err := wfs.stat(name)
+	if err != nil {
+		return err
+	}
+	if _, err := wfs.ws.files.DeleteFiles(wfs.userId, &schemas.FileOperation{Files: []string{file.ID}}); err != nil {
+		return webdavError(err)
+	}
+	return nil
+}
+
+func (wfs *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = path.Clean(oldName), path.Clean(newName)
+
+	if oldName == "/" || newName == "/" {
+		return os.ErrPermission
+	}
+
+	file, err := wfs.stat(oldName)
+	if err != nil {
+		return err
+	}
+
+	if file.Type == "folder" {
+		if _, err := wfs.ws.files.MoveDirectory(wfs.userId, &schemas.DirMove{Source: oldName,
+			Destination: newName}); err != nil {
+			return webdavError(err)
+		}
+		return nil
+	}
+
+	oldDir, oldBase := path.Split(oldName)
+	newDir, newBase := path.Split(newName)
+
+	if oldDir != newDir {
+		if _, err := wfs.ws.files.MoveFiles(wfs.userId, &schemas.FileOperation{Files: []string{file.ID},
+			Destination: path.Clean(newDir)}); err != nil {
+			return webdavError(err)
+		}
+	}
+
+	if oldBase != newBase {
+		if _, err := wfs.ws.files.UpdateFile(file.ID, wfs.userId, &schemas.FileUpdate{Name: newBase,
+			Type: "file"}); err != nil {
+			return webdavError(err)
+		}
+	}
+	return nil
+}
+
+func (wfs *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	file, err := wfs.stat(path.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	return &webdavFileInfo{file: file.FileOut}, nil
+}
+
+type webdavFileInfo struct {
+	file *schemas.FileOut
+}
+
+func (fi *webdavFileInfo) Name() string {
+	if fi.file.ParentID == "root" {
+		return "/"
+	}
+	return fi.file.Name
+}
+
+func (fi *webdavFileInfo) Size() int64 {
+	return fi.file.Size
+}
+
+func (fi *webdavFileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *webdavFileInfo) ModTime() time.Time {
+	return fi.file.UpdatedAt
+}
+
+func (fi *webdavFileInfo) IsDir() bool {
+	return fi.file.Type == "folder"
+}
+
+func (fi *webdavFileInfo) Sys() any {
+	return nil
+}
+
+// ContentType avoids content sniffing, which would download every file listed by PROPFIND.
+func (fi *webdavFileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.IsDir() {
+		return "", webdav.ErrNotImplemented
+	}
+	if fi.file.MimeType == "" {
+		return "application/octet-stream", nil
+	}
+	return fi.file.MimeType, nil
+}
+
+func (fi *webdavFileInfo) ETag(ctx context.Context) (string, error) {
+	return fmt.Sprintf("\"%s\"", md5.FromString(fi.file.ID+strconv.FormatInt(fi.file.Size, 10))), nil
+}
+
+// webdavFile serves reads and directory listings.
+type webdavFile struct {
+	*fileReadSeeker
+	fs *webdavFS
+}
+
+func (f *webdavFile) Read(p []byte) (int, error) {
+	if f.file.Type == "folder" {
+		return 0, os.ErrInvalid
+	}
+	return f.fileReadSeeker.Read(p)
+}
+
+func (f *webdavFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if f.file.Type != "folder" {
+		return nil, os.ErrInvalid
+	}
+
+	dirPath := f.file.Path
+
+	infos := []fs.FileInfo{}
+
+	fquery := &schemas.FileQuery{Path: dirPath, Op: "list", Sort: "name", Order: "asc", PerPage: 500}
+
+	for {
+		res, err := f.fs.ws.files.ListFiles(f.fs.userId, fquery)
+		if err != nil {
+			return nil, webdavError(err)
+		}
+		for i := range res.Files {
+			infos = append(infos, &webdavFileInfo{file: &res.Files[i]})
+		}
+		if res.NextPageToken == "" {
+			break
+		}
+		fquery.NextPageToken = res.NextPageToken
+	}
+	return infos, nil
+}
+
+func (f *webdavFile) Stat() (fs.FileInfo, error) {
+	return &webdavFileInfo{file: f.file.FileOut}, nil
+}
+
+func (f *webdavFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// webdavWriter spools the request body to a temporary file and uploads it in
+// parts through the regular upload pipeline once the client closes the file.
+type webdavWriter struct {
+	ctx     context.Context
+	fs      *webdavFS
+	name    string
+	tmp     *os.File
+	size    int64
+	modTime time.Time
+}
+
+func newWebdavWriter(ctx context.Context, wfs *webdavFS, name string) (*webdavWriter, error) {
+	tmp, err := os.CreateTemp("", "teldrive-webdav-*")
+	if err != nil {
+		return nil, err
+	}
+	return &webdavWriter{ctx: ctx, fs: wfs, name: name, tmp: tmp, modTime: time.Now().UTC()}, nil
+}
+
+func (w *webdavWriter) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *webdavWriter) Read(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (w *webdavWriter) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return w.size, nil
+	}
+	if offset == 0 && whence == io.SeekEnd {
+		return w.size, nil
+	}
+	return 0, os.ErrInvalid
+}
+
+func (w *webdavWriter) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *webdavWriter) Stat() (fs.FileInfo, error) {
+	return &webdavFileInfo{file: &schemas.FileOut{Name: path.Base(w.name), Type: "file",
+		Size: w.size, UpdatedAt: w.modTime}}, nil
+}
+
+func (w *webdavWriter) Close() error {
+	defer func() {
+		w.tmp.Close()
+		os.Remove(w.tmp.Name())
+	}()
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ws := w.fs.ws
+
+	_, err := ws.uploads.putFile(w.ctx, ws.files, w.fs.userId, w.fs.session, w.name, w.tmp, w.size, "")
+
+	return err
+}
@@ -16,6 +16,7 @@ type Part struct {
 	DecryptedSize int64
 	Size          int64
 	Salt          string
+	KeyID         int64
 }
 
 type JWTClaims struct {
@@ -26,8 +27,37 @@ type JWTClaims struct {
 	Bot       bool   `json:"bot"`
 	IsPremium bool   `json:"isPremium"`
 	Hash      string `json:"hash"`
+	// TokenID, Scopes and Path are only set for requests made with an API token.
+	TokenID string   `json:"tokenId,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Path    string   `json:"path,omitempty"`
 }
 
+// HasScope reports whether the claims allow scope. Sessions allow everything and the
+// write scope includes uploads.
+func (c *JWTClaims) HasScope(scope string) bool {
+	if c.TokenID == "" {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope || (s == ScopeWrite && scope == ScopeUpload) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes of API tokens.
+const (
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeUpload = "upload"
+	ScopeAdmin  = "admin"
+)
+
+// APITokenPrefix starts every API token, it tells them apart from session tokens.
+const APITokenPrefix = "tdt_"
+
 type SessionData struct {
 	Version int
 	Data    session.Data